@@ -46,10 +46,32 @@ var (
 	// should be handled by the module, and not reported to the user.
 	ErrInvalidConsensusChangeID = errors.New("consensus subscription has invalid id - files are inconsistent")
 
+	// ErrMissingFileContract indicates that a transaction revises or submits a
+	// storage proof for a file contract that does not exist in the consensus
+	// set. The file contract may have expired already, or it may be created
+	// by a transaction that has not been confirmed yet.
+	ErrMissingFileContract = errors.New("transaction references an unrecognized file contract")
+
+	// ErrMissingSiacoinOutput indicates that a transaction spends a siacoin
+	// output that does not exist in the consensus set. The output may have
+	// been spent already, or it may be created by a transaction that has not
+	// been seen yet.
+	ErrMissingSiacoinOutput = errors.New("transaction spends a nonexisting siacoin output")
+
 	// ErrNonExtendingBlock indicates that a block is valid but does not result
 	// in a fork that is the heaviest known fork - the consensus set has not
 	// changed as a result of seeing the block.
 	ErrNonExtendingBlock = errors.New("block does not extend the longest fork")
+
+	// ErrUnfinishedFileContract indicates that a transaction contains a
+	// storage proof for a file contract whose proof window has not opened
+	// yet. The proof may become valid once the blockchain reaches the window.
+	ErrUnfinishedFileContract = errors.New("file contract window has not yet opened")
+
+	// ErrWrongUnlockConditions indicates that a transaction provides unlock
+	// conditions that do not hash to the unlock hash of the output or file
+	// contract being spent.
+	ErrWrongUnlockConditions = errors.New("transaction contains incorrect unlock conditions")
 )
 
 type (
@@ -129,6 +151,12 @@ type (
 		// function to be called by a subscriber during
 		// ProcessConsensusChange.
 		TryTransactionSet func([]types.Transaction) (ConsensusChange, error)
+
+		// TryTrustedTransactionSet is the same as TryTransactionSet, except
+		// that the signatures of the transactions are not verified. It must
+		// only be used for transactions whose signatures have already been
+		// verified by the caller.
+		TryTrustedTransactionSet func([]types.Transaction) (ConsensusChange, error)
 	}
 
 	// A SiacoinOutputDiff indicates the addition or removal of a SiacoinOutput in
@@ -92,8 +92,9 @@ func (cs *ConsensusSet) computeConsensusChange(tx *bolt.Tx, ce changeEntry) (mod
 		cc.Synced = true
 	}
 
-	// Add the unexported tryTransactionSet function.
+	// Add the unexported tryTransactionSet functions.
 	cc.TryTransactionSet = cs.tryTransactionSet
+	cc.TryTrustedTransactionSet = cs.tryTrustedTransactionSet
 
 	return cc, nil
 }
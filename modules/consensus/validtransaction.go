@@ -18,13 +18,13 @@ var (
 	errInvalidStorageProof        = errors.New("provided storage proof is invalid")
 	errLateRevision               = errors.New("file contract revision submitted after deadline")
 	errLowRevisionNumber          = errors.New("transaction has a file contract with an outdated revision number")
-	errMissingSiacoinOutput       = errors.New("transaction spends a nonexisting siacoin output")
+	errMissingSiacoinOutput       = modules.ErrMissingSiacoinOutput
 	errMissingSiafundOutput       = errors.New("transaction spends a nonexisting siafund output")
 	errSiacoinInputOutputMismatch = errors.New("siacoin inputs do not equal siacoin outputs for transaction")
 	errSiafundInputOutputMismatch = errors.New("siafund inputs do not equal siafund outputs for transaction")
-	errUnfinishedFileContract     = errors.New("file contract window has not yet openend")
-	errUnrecognizedFileContractID = errors.New("cannot fetch storage proof segment for unknown file contract")
-	errWrongUnlockConditions      = errors.New("transaction contains incorrect unlock conditions")
+	errUnfinishedFileContract     = modules.ErrUnfinishedFileContract
+	errUnrecognizedFileContractID = modules.ErrMissingFileContract
+	errWrongUnlockConditions      = modules.ErrWrongUnlockConditions
 )
 
 // validSiacoins checks that the siacoin inputs and outputs are valid in the
@@ -210,7 +210,9 @@ func validStorageProofs(tx *bolt.Tx, t types.Transaction) error {
 func validFileContractRevisions(tx *bolt.Tx, t types.Transaction) error {
 	for _, fcr := range t.FileContractRevisions {
 		fc, err := getFileContract(tx, fcr.ParentID)
-		if err != nil {
+		if err == errNilItem {
+			return errUnrecognizedFileContractID
+		} else if err != nil {
 			return err
 		}
 
@@ -291,10 +293,37 @@ func validTransaction(tx *bolt.Tx, t types.Transaction) error {
 	if err != nil {
 		return err
 	}
+	return validTransactionComponents(tx, t)
+}
+
+// validTrustedTransaction performs the same checks as validTransaction, except
+// that signatures are not verified. It must only be used for transactions
+// whose signatures have already been verified.
+func validTrustedTransaction(tx *bolt.Tx, t types.Transaction) error {
+	err := t.StandaloneValidWithoutSignatures(blockHeight(tx))
+	if err != nil {
+		return err
+	}
+	return validTransactionComponents(tx, t)
+}
+
+// validTransactionAtHeight returns a function that performs the same checks as
+// validTransaction, except that the standalone checks, such as timelocks and
+// signatures, are performed as if the blockchain were at the provided height.
+func validTransactionAtHeight(height types.BlockHeight) func(*bolt.Tx, types.Transaction) error {
+	return func(tx *bolt.Tx, t types.Transaction) error {
+		err := t.StandaloneValid(height)
+		if err != nil {
+			return err
+		}
+		return validTransactionComponents(tx, t)
+	}
+}
 
-	// Check that each portion of the transaction is legal given the current
-	// consensus set.
-	err = validSiacoins(tx, t)
+// validTransactionComponents checks that each portion of the transaction is
+// legal given the current consensus set.
+func validTransactionComponents(tx *bolt.Tx, t types.Transaction) error {
+	err := validSiacoins(tx, t)
 	if err != nil {
 		return err
 	}
@@ -319,6 +348,18 @@ func validTransaction(tx *bolt.Tx, t types.Transaction) error {
 // is not checked. After the transactions have been validated, a consensus
 // change is returned detailing the diffs that the transactions set would have.
 func (cs *ConsensusSet) tryTransactionSet(txns []types.Transaction) (modules.ConsensusChange, error) {
+	return cs.tryTransactionSetWith(txns, validTransaction)
+}
+
+// tryTrustedTransactionSet is the same as tryTransactionSet, except that the
+// signatures of the transactions are not verified.
+func (cs *ConsensusSet) tryTrustedTransactionSet(txns []types.Transaction) (modules.ConsensusChange, error) {
+	return cs.tryTransactionSetWith(txns, validTrustedTransaction)
+}
+
+// tryTransactionSetWith applies the input transactions to the consensus set,
+// using validFn to check each transaction before it is applied.
+func (cs *ConsensusSet) tryTransactionSetWith(txns []types.Transaction, validFn func(*bolt.Tx, types.Transaction) error) (modules.ConsensusChange, error) {
 	// applyTransaction will apply the diffs from a transaction and store them
 	// in a block node. diffHolder is the blockNode that tracks the temporary
 	// changes. At the end of the function, all changes that were made to the
@@ -334,7 +375,7 @@ func (cs *ConsensusSet) tryTransactionSet(txns []types.Transaction) (modules.Con
 	err := cs.db.Update(func(tx *bolt.Tx) error {
 		diffHolder.Height = blockHeight(tx)
 		for _, txn := range txns {
-			err := validTransaction(tx, txn)
+			err := validFn(tx, txn)
 			if err != nil {
 				return err
 			}
@@ -371,6 +412,21 @@ func (cs *ConsensusSet) TryTransactionSet(txns []types.Transaction) (modules.Con
 	return cs.tryTransactionSet(txns)
 }
 
+// TryTransactionSetAtHeight is the same as TryTransactionSet, except that the
+// standalone checks of the transactions, such as timelocks, are performed as
+// if the blockchain were at the provided height. The objects spent by the
+// transactions must still exist in the current consensus set.
+func (cs *ConsensusSet) TryTransactionSetAtHeight(txns []types.Transaction, height types.BlockHeight) (modules.ConsensusChange, error) {
+	err := cs.tg.Add()
+	if err != nil {
+		return modules.ConsensusChange{}, err
+	}
+	defer cs.tg.Done()
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	return cs.tryTransactionSetWith(txns, validTransactionAtHeight(height))
+}
+
 // LockedTryTransactionSet calls fn while under read-lock, passing it a
 // version of TryTransactionSet that can be called under read-lock. This fixes
 // an edge case in the transaction pool.
@@ -384,3 +440,19 @@ func (cs *ConsensusSet) LockedTryTransactionSet(fn func(func(txns []types.Transa
 	defer cs.mu.RUnlock()
 	return fn(cs.tryTransactionSet)
 }
+
+// LockedTryTrustedTransactionSet is the same as LockedTryTransactionSet,
+// except that the function passed to fn does not verify the signatures of the
+// transactions. It must only be used for transactions that come from a fully
+// trusted source, such as transactions that were already verified by the
+// caller.
+func (cs *ConsensusSet) LockedTryTrustedTransactionSet(fn func(func(txns []types.Transaction) (modules.ConsensusChange, error)) error) error {
+	err := cs.tg.Add()
+	if err != nil {
+		return err
+	}
+	defer cs.tg.Done()
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	return fn(cs.tryTrustedTransactionSet)
+}
@@ -673,7 +673,7 @@ func TestValidFileContractRevisions(t *testing.T) {
 	// Submit a file contract revision pointing to an invalid parent.
 	txn.FileContractRevisions[0].ParentID[0]--
 	err = cst.cs.dbValidFileContractRevisions(txn)
-	if err != errNilItem {
+	if err != errUnrecognizedFileContractID {
 		t.Error(err)
 	}
 	txn.FileContractRevisions[0].ParentID[0]++
@@ -2,6 +2,7 @@ package modules
 
 import (
 	"errors"
+	"time"
 
 	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/encoding"
@@ -20,16 +21,29 @@ const (
 )
 
 var (
+	// ErrCyclicDependency is the error that gets returned if the
+	// transactions of a transaction set depend on each other cyclically.
+	ErrCyclicDependency = errors.New("transaction set contains a cycle of dependent transactions")
+
 	// ErrDuplicateTransactionSet is the error that gets returned if a
 	// duplicate transaction set is given to the transaction pool.
 	ErrDuplicateTransactionSet = errors.New("transaction set contains only duplicate transactions")
 
+	// ErrImmatureCoinbase is the error that gets returned if a transaction
+	// set spends a miner payout that has not reached the coinbase maturity of
+	// the transaction pool.
+	ErrImmatureCoinbase = errors.New("transaction set spends a miner payout that has not reached the coinbase maturity of the transaction pool")
+
 	// ErrInvalidArbPrefix is the error that gets returned if a transaction is
 	// submitted to the transaction pool which contains a prefix that is not
 	// recognized. This helps prevent miners on old versions from mining
 	// potentially illegal transactions in the event of a soft-fork.
 	ErrInvalidArbPrefix = errors.New("transaction contains non-standard arbitrary data")
 
+	// ErrInvalidFileContract is the error that gets returned if a
+	// transaction set creates a file contract that can never be confirmed.
+	ErrInvalidFileContract = errors.New("transaction set contains an invalid file contract")
+
 	// ErrLargeTransaction is the error that gets returned if a transaction
 	// provided to the transaction pool is larger than what is allowed by the
 	// IsStandard rules.
@@ -40,6 +54,30 @@ var (
 	// IsStandard rules of the transaction pool.
 	ErrLargeTransactionSet = errors.New("transaction set is too large for this transaction pool")
 
+	// ErrNotFinalYet is the error that gets returned if a transaction set
+	// spends outputs whose timelocks have not expired, and the transaction
+	// pool does not hold such sets.
+	ErrNotFinalYet = errors.New("transaction set spends outputs whose timelocks have not expired")
+
+	// ErrPendingValueExceeded is the error that gets returned if a
+	// transaction set would push the value of the unconfirmed transactions
+	// over the limit of the transaction pool.
+	ErrPendingValueExceeded = errors.New("transaction set would push the value of the unconfirmed transactions over the limit of the transaction pool")
+
+	// ErrRateLimited is the error that gets returned if the source of a
+	// transaction set has exceeded its rate limit.
+	ErrRateLimited = errors.New("source has submitted too many transaction sets, try again later")
+
+	// ErrTooManySignatures is the error that gets returned if a transaction
+	// provided to the transaction pool carries more signatures than what is
+	// allowed by the IsStandard rules.
+	ErrTooManySignatures = errors.New("transaction has too many signatures for this transaction pool")
+
+	// ErrTooManyReplacements is the error that gets returned if the objects
+	// spent by a transaction set have already been replaced the maximum
+	// number of times.
+	ErrTooManyReplacements = errors.New("the objects spent by the transaction set have been replaced too many times")
+
 	// PrefixNonSia defines the prefix that should be appended to any
 	// transactions that use the arbitrary data for reasons outside of the
 	// standard Sia protocol. This will prevent these transactions from being
@@ -83,6 +121,101 @@ type (
 		Sizes        []uint64
 		Transactions []types.Transaction
 	}
+
+	// TransactionPoolSettings control the behavior of the transaction pool.
+	TransactionPoolSettings struct {
+		// CoinbaseMaturity is the number of blocks that must be added on top
+		// of a block before transactions spending its miner payouts are
+		// accepted. Consensus already prevents miner payouts from being spent
+		// before types.MaturityDelay blocks have passed, so only values above
+		// types.MaturityDelay have an effect.
+		CoinbaseMaturity types.BlockHeight `json:"coinbaseMaturity"`
+
+		// ConflictGracePeriod is how long a transaction set that would replace
+		// conflicting transaction sets is held before the replacement takes
+		// place. If the conflicting sets are improved within the grace period,
+		// the replacement is discarded. It only has an effect when
+		// ReplaceConflictingPackages is set.
+		ConflictGracePeriod time.Duration `json:"conflictGracePeriod"`
+
+		// HoldOrphanSets determines whether transaction sets that spend
+		// siacoin outputs, or revise or prove file contracts, which do not
+		// exist yet are held until they appear instead of being rejected.
+		HoldOrphanSets bool `json:"holdOrphanSets"`
+
+		// HoldUnsyncedSets determines whether transaction sets with missing
+		// parents that arrive while the consensus set is not synced are held
+		// and retried after the next few consensus changes, since their
+		// parents are likely to be part of a block that has not been applied
+		// yet. Once the consensus set is synced, sets that are still missing
+		// parents are handled according to HoldOrphanSets.
+		HoldUnsyncedSets bool `json:"holdUnsyncedSets"`
+
+		// HoldStorageProofs determines whether transaction sets with storage
+		// proofs for file contracts whose proof windows have not opened yet
+		// are held until the windows open instead of being rejected. Held
+		// sets are validated again after every block, and dropped once they
+		// can no longer become valid, for example because the contract has
+		// expired or already been proven.
+		HoldStorageProofs bool `json:"holdStorageProofs"`
+
+		// HoldTimelockedSets determines whether transaction sets that spend
+		// outputs with unexpired timelocks are held until the timelocks expire
+		// instead of being rejected.
+		HoldTimelockedSets bool `json:"holdTimelockedSets"`
+
+		// MaxReplacements is the maximum number of times that the
+		// transaction sets spending an object may be replaced before the
+		// replacements are rejected. The count is kept until the object is
+		// no longer spent by any unconfirmed transaction, for example
+		// because the spend was confirmed. A value of zero disables the
+		// limit.
+		MaxReplacements int `json:"maxReplacements"`
+
+		// MaxPendingValue is the maximum combined value of the siacoin
+		// outputs created by the transactions in the unconfirmed set. A
+		// transaction set that would push the total over the limit is
+		// rejected, even if it would replace transactions in the pool. A
+		// value of zero disables the limit.
+		MaxPendingValue types.Currency `json:"maxPendingValue"`
+
+		// MaxPoolSize is the maximum combined size in bytes of the
+		// transactions in the unconfirmed set. A transaction set that would
+		// push the pool over the limit is only accepted if evicting the
+		// unpinned sets that pay a lower fee per byte would free enough
+		// space for it. Sets are then evicted in the same order as Trim,
+		// together with their dependents, until the pool fits the limit
+		// again. A value of zero disables the limit.
+		MaxPoolSize int `json:"maxPoolSize"`
+
+		// MaxSignatures is the maximum number of signatures that a single
+		// transaction may carry. Every signature requires hashing part of
+		// the transaction, so the limit bounds the cost of validating a
+		// transaction. A value of zero selects the default limit, so the
+		// limit cannot be disabled.
+		MaxSignatures int `json:"maxSignatures"`
+
+		// MinReplacementFeeBump is the percentage by which the fees of a
+		// replacement must exceed the combined fees of the transaction sets
+		// it replaces. Replacements always have to pay strictly more than the
+		// sets they replace, even when the bump is zero.
+		MinReplacementFeeBump uint64 `json:"minReplacementFeeBump"`
+
+		// ReplaceConflictingPackages determines whether a transaction set that
+		// double spends transactions in the pool may replace them by paying
+		// more in fees than all of the conflicting transactions and their
+		// descendants combined.
+		ReplaceConflictingPackages bool `json:"replaceConflictingPackages"`
+
+		// SourceRateLimit is the number of transaction sets per second that a
+		// single source, such as a peer, may submit to the transaction pool
+		// after exhausting its burst of SourceBurst sets. Sets beyond the
+		// limit are rejected without being validated. A rate of zero disables
+		// rate limiting; otherwise the rate must be positive and the burst
+		// must be at least 1.
+		SourceBurst     int     `json:"sourceBurst"`
+		SourceRateLimit float64 `json:"sourceRateLimit"`
+	}
 )
 
 type (
@@ -124,6 +257,12 @@ type (
 		// that make this condition necessary.
 		PurgeTransactionPool()
 
+		// SetSettings will update the settings for the transaction pool.
+		SetSettings(TransactionPoolSettings) error
+
+		// Settings returns the transaction pool's current settings.
+		Settings() (TransactionPoolSettings, error)
+
 		// Transaction returns the transaction and unconfirmed parents
 		// corresponding to the provided transaction id.
 		Transaction(id types.TransactionID) (txn types.Transaction, unconfirmedParents []types.Transaction, exists bool)
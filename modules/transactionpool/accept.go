@@ -4,7 +4,6 @@ package transactionpool
 // between a file contract revision and a file contract.
 
 import (
-	"errors"
 	"fmt"
 	"math"
 	"time"
@@ -14,15 +13,188 @@ import (
 	"github.com/NebulousLabs/Sia/encoding"
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/types"
+
+	"github.com/NebulousLabs/errors"
 )
 
 var (
 	errEmptySet            = errors.New("transaction set is empty")
+	errFullTimelockedSets  = errors.New("transaction pool cannot hold more timelocked transaction sets")
 	errFullTransactionPool = errors.New("transaction pool cannot accept more transactions")
 	errLowMinerFees        = errors.New("transaction set needs more miner fees to be accepted")
+	errLowReplacementFees  = errors.New("transaction set does not pay enough fees to replace the transaction sets it conflicts with")
 	errObjectConflict      = errors.New("transaction set conflicts with an existing transaction set")
+	errTransactionNotFound = errors.New("transaction is not in the transaction pool")
+	errTimelockedSetHeld   = errors.New("transaction set is not final yet and will be submitted once its timelocks expire")
 )
 
+type (
+	// timelockedSet is a transaction set that is being held by the transaction
+	// pool until the timelocks on all of its unlock conditions have expired.
+	timelockedSet struct {
+		height types.BlockHeight
+		size   int
+		set    []types.Transaction
+	}
+)
+
+// spentObjectIDs returns the ids of all of the objects that a transaction
+// spends, revises, or proves.
+func spentObjectIDs(t types.Transaction) []ObjectID {
+	var oids []ObjectID
+	for _, sci := range t.SiacoinInputs {
+		oids = append(oids, ObjectID(sci.ParentID))
+	}
+	for _, fcr := range t.FileContractRevisions {
+		oids = append(oids, ObjectID(fcr.ParentID))
+	}
+	for _, sp := range t.StorageProofs {
+		oids = append(oids, ObjectID(sp.ParentID))
+	}
+	for _, sfi := range t.SiafundInputs {
+		oids = append(oids, ObjectID(sfi.ParentID))
+	}
+	return oids
+}
+
+// createdObjectIDs returns the ids of all of the objects that a transaction
+// creates.
+func createdObjectIDs(t types.Transaction) []ObjectID {
+	var oids []ObjectID
+	for i := range t.SiacoinOutputs {
+		oids = append(oids, ObjectID(t.SiacoinOutputID(uint64(i))))
+	}
+	for i := range t.FileContracts {
+		oids = append(oids, ObjectID(t.FileContractID(uint64(i))))
+	}
+	for i := range t.SiafundOutputs {
+		oids = append(oids, ObjectID(t.SiafundOutputID(uint64(i))))
+	}
+	return oids
+}
+
+// setDependencies returns, for each transaction in the set, the indices of
+// the transactions in the set that create objects it spends.
+func setDependencies(ts []types.Transaction) [][]int {
+	creators := make(map[ObjectID]int)
+	for i, t := range ts {
+		for j := range t.SiacoinOutputs {
+			creators[ObjectID(t.SiacoinOutputID(uint64(j)))] = i
+		}
+		for j := range t.FileContracts {
+			creators[ObjectID(t.FileContractID(uint64(j)))] = i
+		}
+		for j := range t.SiafundOutputs {
+			creators[ObjectID(t.SiafundOutputID(uint64(j)))] = i
+		}
+	}
+
+	// A transaction may spend several objects created by the same parent, but
+	// each parent is only listed once.
+	parents := make([][]int, len(ts))
+	for i, t := range ts {
+		seen := make(map[int]struct{})
+		for _, oid := range spentObjectIDs(t) {
+			parent, exists := creators[oid]
+			if !exists {
+				continue
+			}
+			if _, dup := seen[parent]; dup {
+				continue
+			}
+			seen[parent] = struct{}{}
+			parents[i] = append(parents[i], parent)
+		}
+	}
+	return parents
+}
+
+// dependentTransactions returns the ids of the transactions of the set that
+// are in roots, along with the ids of every transaction of the set that
+// depends on one of them, directly or transitively.
+func dependentTransactions(tSet []types.Transaction, roots map[types.TransactionID]struct{}) map[types.TransactionID]struct{} {
+	parents := setDependencies(tSet)
+	order, err := topologicalOrder(parents)
+	if err != nil {
+		return roots
+	}
+	// Visiting the set in topological order ensures that every parent has been
+	// classified before its children.
+	dependent := make(map[int]bool)
+	ids := make(map[types.TransactionID]struct{})
+	for _, i := range order {
+		_, dependent[i] = roots[tSet[i].ID()]
+		for _, parent := range parents[i] {
+			dependent[i] = dependent[i] || dependent[parent]
+		}
+		if dependent[i] {
+			ids[tSet[i].ID()] = struct{}{}
+		}
+	}
+	return ids
+}
+
+// topologicalOrder returns an ordering of the nodes of a dependency graph in
+// which every node comes after all of its parents. parents[i] contains the
+// parents of node i. Nodes that are already correctly ordered keep their
+// relative order. modules.ErrCyclicDependency is returned if the graph
+// contains a cycle.
+func topologicalOrder(parents [][]int) ([]int, error) {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make([]int, len(parents))
+	order := make([]int, 0, len(parents))
+
+	// Visit the graph depth first. A node that is reached again while it is
+	// still being visited is part of a cycle.
+	var visit func(int) error
+	visit = func(i int) error {
+		switch state[i] {
+		case visiting:
+			return modules.ErrCyclicDependency
+		case visited:
+			return nil
+		}
+		state[i] = visiting
+		for _, parent := range parents[i] {
+			if parent == i {
+				return modules.ErrCyclicDependency
+			}
+			if err := visit(parent); err != nil {
+				return err
+			}
+		}
+		state[i] = visited
+		order = append(order, i)
+		return nil
+	}
+	for i := range parents {
+		if err := visit(i); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+// sortTransactionSet orders a transaction set so that every transaction comes
+// after the transactions that create the objects it spends, which is the
+// order that consensus requires. An error is returned if the transactions in
+// the set depend on each other cyclically.
+func sortTransactionSet(ts []types.Transaction) ([]types.Transaction, error) {
+	order, err := topologicalOrder(setDependencies(ts))
+	if err != nil {
+		return nil, err
+	}
+	sorted := make([]types.Transaction, 0, len(ts))
+	for _, i := range order {
+		sorted = append(sorted, ts[i])
+	}
+	return sorted, nil
+}
+
 // relatedObjectIDs determines all of the object ids related to a transaction.
 func relatedObjectIDs(ts []types.Transaction) []ObjectID {
 	oidMap := make(map[ObjectID]struct{})
@@ -57,6 +229,155 @@ func relatedObjectIDs(ts []types.Transaction) []ObjectID {
 	return oids
 }
 
+// timelockHeight returns the lowest block height at which all of the unlock
+// conditions in a transaction set have their timelocks satisfied.
+func timelockHeight(ts []types.Transaction) types.BlockHeight {
+	var height types.BlockHeight
+	for _, t := range ts {
+		for _, sci := range t.SiacoinInputs {
+			if sci.UnlockConditions.Timelock > height {
+				height = sci.UnlockConditions.Timelock
+			}
+		}
+		for _, fcr := range t.FileContractRevisions {
+			if fcr.UnlockConditions.Timelock > height {
+				height = fcr.UnlockConditions.Timelock
+			}
+		}
+		for _, sfi := range t.SiafundInputs {
+			if sfi.UnlockConditions.Timelock > height {
+				height = sfi.UnlockConditions.Timelock
+			}
+		}
+	}
+	return height
+}
+
+// validFileContract performs sanity checks on the parameters of a new file
+// contract, so that transactions creating contracts which can never be
+// confirmed are rejected before the more expensive validation happens.
+func validFileContract(fc types.FileContract, height types.BlockHeight) error {
+	if fc.Payout.IsZero() {
+		return errors.Extend(modules.ErrInvalidFileContract, types.ErrZeroOutput)
+	}
+	if fc.WindowStart <= height {
+		return errors.Extend(modules.ErrInvalidFileContract, types.ErrFileContractWindowStartViolation)
+	}
+	if fc.WindowEnd <= fc.WindowStart {
+		return errors.Extend(modules.ErrInvalidFileContract, types.ErrFileContractWindowEndViolation)
+	}
+	return nil
+}
+
+// consensusValidate is the default validation function of the transaction
+// pool, which validates the transaction set using the validation function of
+// the consensus set.
+func consensusValidate(ts []types.Transaction, txnFn func([]types.Transaction) (modules.ConsensusChange, error)) (modules.ConsensusChange, error) {
+	return txnFn(ts)
+}
+
+// holdTimelockedSet stores a transaction set that is not yet final so that it
+// can be submitted to the pool once the provided height is reached. The
+// standalone checks of the transactions, including their signatures and file
+// contracts, are performed at that height first, so that the queue only holds
+// sets that can become valid.
+func (tp *TransactionPool) holdTimelockedSet(ts []types.Transaction, height types.BlockHeight, setSize uint64) error {
+	if height > tp.blockHeight+maxTimelockHoldDepth {
+		return modules.ErrNotFinalYet
+	}
+	setID := TransactionSetID(crypto.HashObject(ts))
+	if _, exists := tp.timelockedSets[setID]; exists {
+		return modules.ErrDuplicateTransactionSet
+	}
+	if tp.timelockedSetsSize+int(setSize) > maxTimelockedSetsSize {
+		return errFullTimelockedSets
+	}
+	for _, txn := range ts {
+		if tp.signatures.contains(txn, height) {
+			continue
+		}
+		if err := tp.signatures.verify(txn, height); err != nil {
+			return modules.NewConsensusConflict("timelocked transaction set is invalid: " + err.Error())
+		}
+	}
+	tp.timelockedSets[setID] = timelockedSet{
+		height: height,
+		size:   int(setSize),
+		set:    ts,
+	}
+	tp.timelockedSetsSize += int(setSize)
+	return errTimelockedSetHeld
+}
+
+// promoteTimelockedSets submits all of the held transaction sets that have
+// become final to the transaction pool.
+func (tp *TransactionPool) promoteTimelockedSets(txnFn func([]types.Transaction) (modules.ConsensusChange, error)) {
+	for setID, ts := range tp.timelockedSets {
+		if ts.height > tp.blockHeight {
+			continue
+		}
+		delete(tp.timelockedSets, setID)
+		tp.timelockedSetsSize -= ts.size
+		if tp.acceptTransactionSet(ts.set, txnFn) == nil {
+			tp.setOrigin(ts.set, OriginHeld)
+		}
+	}
+}
+
+// transactionSetFees returns the sum of all miner fees in a transaction set.
+func transactionSetFees(ts []types.Transaction) types.Currency {
+	var fees types.Currency
+	for _, txn := range ts {
+		for _, fee := range txn.MinerFees {
+			fees = fees.Add(fee)
+		}
+	}
+	return fees
+}
+
+// transactionSetValue returns the sum of the values of all siacoin outputs
+// created by a transaction set.
+func transactionSetValue(ts []types.Transaction) types.Currency {
+	var value types.Currency
+	for _, txn := range ts {
+		for _, sco := range txn.SiacoinOutputs {
+			value = value.Add(sco.Value)
+		}
+	}
+	return value
+}
+
+// exceedsPendingValue returns true if adding the transactions of the provided
+// set that are not in the unconfirmed set yet would push the value of the
+// unconfirmed set over MaxPendingValue.
+func (tp *TransactionPool) exceedsPendingValue(ts []types.Transaction) bool {
+	if tp.maxPendingValue.IsZero() {
+		return false
+	}
+	var added []types.Transaction
+	for _, txn := range ts {
+		if _, exists := tp.findTransactionSet(txn.ID()); !exists {
+			added = append(added, txn)
+		}
+	}
+	return tp.transactionListValue.Add(transactionSetValue(added)).Cmp(tp.maxPendingValue) > 0
+}
+
+// spendsImmatureCoinbase returns true if any transaction in the set spends a
+// miner payout that, at the provided height, has fewer confirmations than the
+// coinbase maturity of the transaction pool.
+func (tp *TransactionPool) spendsImmatureCoinbase(ts []types.Transaction, currentHeight types.BlockHeight) bool {
+	for _, t := range ts {
+		for _, sci := range t.SiacoinInputs {
+			height, exists := tp.minerPayouts[sci.ParentID]
+			if exists && currentHeight-height < tp.coinbaseMaturity {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // requiredFeesToExtendTpool returns the amount of fees required to extend the
 // transaction pool to fit another transaction set. The amount returned has the
 // unit 'currency per byte'.
@@ -92,11 +413,21 @@ func (tp *TransactionPool) checkTransactionSetComposition(ts []types.Transaction
 	// fly.
 
 	// Check that all transactions follow 'Standard.md' guidelines.
-	setSize, err := isStandardTransactionSet(ts)
+	setSize, err := isStandardTransactionSet(ts, tp.maxSignatures)
 	if err != nil {
 		return 0, err
 	}
 
+	// Check that all new file contracts are sane.
+	for _, t := range ts {
+		for _, fc := range t.FileContracts {
+			err := validFileContract(fc, tp.blockHeight)
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+
 	return setSize, nil
 }
 
@@ -174,12 +505,7 @@ func (tp *TransactionPool) handleConflicts(ts []types.Transaction, conflicts []T
 	if err != nil {
 		return err
 	}
-	var setFees types.Currency
-	for _, txn := range superset {
-		for _, fee := range txn.MinerFees {
-			setFees = setFees.Add(fee)
-		}
-	}
+	setFees := transactionSetFees(superset)
 	if requiredFees.Cmp(setFees) > 0 {
 		// TODO: check if there is an existing set with lower fees that we can
 		// kick out.
@@ -187,45 +513,274 @@ func (tp *TransactionPool) handleConflicts(ts []types.Transaction, conflicts []T
 	}
 
 	// Check that the transaction set is valid.
-	cc, err := txnFn(superset)
+	cc, err := tp.validate(superset, txnFn)
 	if err != nil {
 		return modules.NewConsensusConflict("provided transaction set has prereqs, but is still invalid: " + err.Error())
 	}
 
 	// Remove the conflicts from the transaction pool.
 	for conflict := range supersetMap {
-		conflictSet := tp.transactionSets[conflict]
-		tp.transactionListSize -= len(encoding.Marshal(conflictSet))
-		delete(tp.transactionSets, conflict)
-		delete(tp.transactionSetDiffs, conflict)
+		tp.removeTransactionSet(conflict)
 	}
 
-	// Add the transaction set to the pool.
-	setID := TransactionSetID(crypto.HashObject(superset))
-	tp.transactionSets[setID] = superset
-	for _, diff := range cc.SiacoinOutputDiffs {
-		tp.knownObjects[ObjectID(diff.ID)] = setID
+	// Add the transaction set to the pool. The transactions of the
+	// conflicting sets keep their arrival times and heights, which removing
+	// the sets does not forget.
+	tp.addTransactionSet(superset, cc)
+	return nil
+}
+
+// replacedTransactions returns the transactions of the conflicting sets that
+// replacing them with the provided transaction set would evict: the
+// transactions that spend an object which the set spends as well, and the
+// transactions that depend on them. Transactions that are part of the set, and
+// transactions that were only merged into a conflicting set, are not
+// replaced.
+func (tp *TransactionPool) replacedTransactions(ts []types.Transaction, conflicts []TransactionSetID) []types.Transaction {
+	ids := make(map[types.TransactionID]struct{})
+	spent := make(map[ObjectID]struct{})
+	for _, txn := range ts {
+		ids[txn.ID()] = struct{}{}
+		for _, oid := range spentObjectIDs(txn) {
+			spent[oid] = struct{}{}
+		}
+	}
+	var replaced []types.Transaction
+	seen := make(map[TransactionSetID]struct{})
+	for _, conflict := range conflicts {
+		if _, exists := seen[conflict]; exists {
+			continue
+		}
+		seen[conflict] = struct{}{}
+		tSet := tp.transactionSets[conflict]
+		roots := make(map[types.TransactionID]struct{})
+		for _, txn := range tSet {
+			if _, exists := ids[txn.ID()]; exists {
+				continue
+			}
+			for _, oid := range spentObjectIDs(txn) {
+				if _, exists := spent[oid]; exists {
+					roots[txn.ID()] = struct{}{}
+					break
+				}
+			}
+		}
+		dependents := dependentTransactions(tSet, roots)
+		for _, txn := range tSet {
+			if _, exists := dependents[txn.ID()]; exists {
+				replaced = append(replaced, txn)
+			}
+		}
+	}
+	return replaced
+}
+
+// minReplacementFee returns the minimum total fee that a transaction set must
+// pay to replace the provided transactions. The replacement must pay
+// MinReplacementFeeBump percent more than the replaced transactions, and
+// always strictly more.
+func (tp *TransactionPool) minReplacementFee(replaced []types.Transaction) types.Currency {
+	packageFee := transactionSetFees(replaced)
+	minFee := packageFee.Mul64(100 + tp.minReplacementFeeBump).Div64(100)
+	if minFee.Cmp(packageFee) <= 0 {
+		minFee = packageFee.Add(types.NewCurrency64(1))
+	}
+	return minFee
+}
+
+// MinReplacementFee returns the minimum total fee that a replacement for the
+// transaction with the provided id must pay to evict it, along with the
+// transactions that depend on it, under the current replacement policy.
+func (tp *TransactionPool) MinReplacementFee(id types.TransactionID) (types.Currency, error) {
+	tp.mu.RLock()
+	defer tp.mu.RUnlock()
+	setID, exists := tp.findTransactionSet(id)
+	if !exists {
+		return types.Currency{}, errTransactionNotFound
+	}
+	tSet := tp.transactionSets[setID]
+	dependents := dependentTransactions(tSet, map[types.TransactionID]struct{}{id: {}})
+	var replaced []types.Transaction
+	for _, txn := range tSet {
+		if _, exists := dependents[txn.ID()]; exists {
+			replaced = append(replaced, txn)
+		}
+	}
+	return tp.minReplacementFee(replaced), nil
+}
+
+// contestedObjects returns the objects spent by the provided transaction set
+// that are also spent or created by one of the conflicting transaction sets.
+func (tp *TransactionPool) contestedObjects(ts []types.Transaction, conflicts []TransactionSetID) []ObjectID {
+	conflictSet := make(map[TransactionSetID]struct{})
+	for _, conflict := range conflicts {
+		conflictSet[conflict] = struct{}{}
+	}
+	var contested []ObjectID
+	for _, txn := range ts {
+		for _, oid := range spentObjectIDs(txn) {
+			if _, exists := conflictSet[tp.knownObjects[oid]]; exists {
+				contested = append(contested, oid)
+			}
+		}
+	}
+	return contested
+}
+
+// doubleSpentObjects returns the objects spent by the provided transaction set
+// that are also spent by a transaction in one of the conflicting transaction
+// sets.
+func (tp *TransactionPool) doubleSpentObjects(ts []types.Transaction, conflicts []TransactionSetID) []ObjectID {
+	spent := make(map[ObjectID]struct{})
+	for _, conflict := range conflicts {
+		for _, txn := range tp.transactionSets[conflict] {
+			for _, oid := range spentObjectIDs(txn) {
+				spent[oid] = struct{}{}
+			}
+		}
+	}
+	var doubleSpent []ObjectID
+	for _, txn := range ts {
+		for _, oid := range spentObjectIDs(txn) {
+			if _, exists := spent[oid]; exists {
+				doubleSpent = append(doubleSpent, oid)
+			}
+		}
+	}
+	return doubleSpent
+}
+
+// DoubleSpentOutputs returns the ids of the objects that are spent by a
+// transaction in the pool, and that at least one other transaction has
+// attempted to spend since, regardless of whether the attempt was rejected,
+// held, or replaced the original spend. An object is forgotten once no
+// unconfirmed transaction spends it anymore. The ids are not sorted.
+func (tp *TransactionPool) DoubleSpentOutputs() []types.OutputID {
+	tp.mu.RLock()
+	defer tp.mu.RUnlock()
+	ids := make([]types.OutputID, 0, len(tp.doubleSpends))
+	for oid := range tp.doubleSpends {
+		ids = append(ids, types.OutputID(oid))
+	}
+	return ids
+}
+
+// exceedsReplacementLimit returns true if any of the objects contested by the
+// provided transaction set has already been replaced MaxReplacements times.
+func (tp *TransactionPool) exceedsReplacementLimit(ts []types.Transaction, conflicts []TransactionSetID) bool {
+	if tp.maxReplacements <= 0 {
+		return false
+	}
+	for _, oid := range tp.contestedObjects(ts, conflicts) {
+		if tp.replacementCounts[oid] >= tp.maxReplacements {
+			return true
+		}
+	}
+	return false
+}
+
+// replaceConflictingPackage replaces the transactions of the provided
+// conflicting sets that double spend the new transaction set, along with the
+// transactions that depend on them, with the new set. The other transactions
+// of the conflicting sets stay in the pool. The new set must be valid on its
+// own, meaning that it has to include any of its unconfirmed ancestors, and it
+// must pay at least the minimum replacement fee of all of the replaced
+// transactions combined. Comparing the whole packages prevents a low fee
+// transaction with a high fee child from being replaced by a transaction that
+// only outbids the parent. If the new set is not accepted once the replaced
+// transactions are gone, the pool is rolled back.
+func (tp *TransactionPool) replaceConflictingPackage(ts []types.Transaction, conflicts []TransactionSetID, txnFn func([]types.Transaction) (modules.ConsensusChange, error)) error {
+	if tp.exceedsReplacementLimit(ts, conflicts) {
+		return modules.ErrTooManyReplacements
+	}
+	_, err := tp.validate(ts, txnFn)
+	if err != nil {
+		return modules.NewConsensusConflict("provided transaction set conflicts with the transaction pool and is invalid on its own: " + err.Error())
 	}
-	for _, diff := range cc.FileContractDiffs {
-		tp.knownObjects[ObjectID(diff.ID)] = setID
+	replaced := tp.replacedTransactions(ts, conflicts)
+	packageFee := transactionSetFees(replaced)
+	if transactionSetFees(ts).Cmp(tp.minReplacementFee(replaced)) < 0 {
+		return errLowReplacementFees
 	}
-	for _, diff := range cc.SiafundOutputDiffs {
-		tp.knownObjects[ObjectID(diff.ID)] = setID
+
+	saved := tp.saveState()
+	for _, oid := range tp.contestedObjects(ts, conflicts) {
+		tp.replacementCounts[oid]++
+	}
+	var removed []types.Transaction
+	for _, txn := range replaced {
+		removed = append(removed, tp.removeTransaction(txn.ID(), txnFn)...)
+	}
+	err = tp.acceptTransactionSet(ts, txnFn)
+	if err != nil {
+		tp.restoreState(saved)
+		return err
+	}
+
+	// Forget the replaced transactions, keeping the metadata of any
+	// transactions that are also part of the new set.
+	newTxns := make(map[types.TransactionID]struct{})
+	for _, txn := range ts {
+		newTxns[txn.ID()] = struct{}{}
+	}
+	for _, txn := range removed {
+		if _, exists := newTxns[txn.ID()]; !exists {
+			tp.forgetTransaction(txn.ID())
+			tp.events.LogEvict(transactionEvent(txn))
+		}
+	}
+	tp.log.Debugf("replacing %v conflicting transactions paying %v in fees\n", len(replaced), packageFee)
+	tp.metrics.addReplacement()
+	return nil
+}
+
+// addTransactionSet adds a validated transaction set to the transaction pool.
+func (tp *TransactionPool) addTransactionSet(ts []types.Transaction, cc modules.ConsensusChange) {
+	setID := TransactionSetID(crypto.HashObject(ts))
+	tp.transactionSets[setID] = ts
+	for _, txn := range ts {
+		tp.transactionSetIDs[txn.ID()] = setID
+		tp.transactionSizes[txn.ID()] = len(encoding.Marshal(txn))
+	}
+	for _, oid := range relatedObjectIDs(ts) {
+		tp.knownObjects[oid] = setID
 	}
 	tp.transactionSetDiffs[setID] = &cc
-	tsetSize := len(encoding.Marshal(superset))
+	if len(tp.orphanSets) > 0 {
+		for _, txn := range ts {
+			tp.appearedObjects = append(tp.appearedObjects, createdObjectIDs(txn)...)
+		}
+	}
+	for _, txn := range ts {
+		tp.poolFingerprint ^= transactionFingerprint(txn.ID())
+	}
+	// A set is encoded as its length followed by its transactions.
+	tsetSize := 8
+	for _, txn := range ts {
+		tsetSize += tp.transactionSizes[txn.ID()]
+	}
 	tp.transactionListSize += tsetSize
+	tp.transactionListFees = tp.transactionListFees.Add(transactionSetFees(ts))
+	tp.transactionListValue = tp.transactionListValue.Add(transactionSetValue(ts))
+	tp.unconfirmedVersion++
+	for _, txn := range ts {
+		if _, exists := tp.transactionHeights[txn.ID()]; !exists {
+			tp.transactionHeights[txn.ID()] = tp.blockHeight
+		}
+		if _, exists := tp.transactionArrivals[txn.ID()]; !exists {
+			tp.transactionArrivals[txn.ID()] = time.Now()
+		}
+	}
 
 	// debug logging
 	if build.DEBUG {
+		tp.checkTransactionListFees()
 		txLogs := ""
-		for i, t := range superset {
-			txLogs += fmt.Sprintf("superset transaction %v size: %vB\n", i, len(encoding.Marshal(t)))
+		for i, t := range ts {
+			txLogs += fmt.Sprintf("transaction %v size: %vB\n", i, tp.transactionSizes[t.ID()])
 		}
-		tp.log.Debugf("accepted transaction superset %v, size: %vB\ntpool size is %vB after accpeting transaction superset\ntransactions: \n%v\n", setID, tsetSize, tp.transactionListSize, txLogs)
+		tp.log.Debugf("accepted transaction set %v, size: %vB\ntpool size is %vB after accpeting transaction set\ntransactions: \n%v\n", setID, tsetSize, tp.transactionListSize, txLogs)
 	}
-
-	return nil
 }
 
 // acceptTransactionSet verifies that a transaction set is allowed to be in the
@@ -248,30 +803,57 @@ func (tp *TransactionPool) acceptTransactionSet(ts []types.Transaction, txnFn fu
 		return modules.ErrDuplicateTransactionSet
 	}
 
+	// Make sure that parents come before their children in the set.
+	ts, err := sortTransactionSet(ts)
+	if err != nil {
+		return err
+	}
+
 	// Check the composition of the transaction set.
 	setSize, err := tp.checkTransactionSetComposition(ts)
 	if err != nil {
 		return err
 	}
 
+	// Check that the transaction set is final, or hold it until it is.
+	if lockHeight := timelockHeight(ts); lockHeight > tp.blockHeight {
+		if !tp.holdTimelockedSets {
+			return modules.ErrNotFinalYet
+		}
+		return tp.holdTimelockedSet(ts, lockHeight, setSize)
+	}
+
+	// Check that the transaction set does not spend any miner payouts that are
+	// too recent.
+	if tp.spendsImmatureCoinbase(ts, tp.blockHeight) {
+		return modules.ErrImmatureCoinbase
+	}
+
 	// Check that the transaction set has enough fees to justify adding it to
 	// the transaction list.
 	requiredFees := tp.requiredFeesToExtendTpool().Mul64(setSize)
 	if err != nil {
 		return err
 	}
-	var setFees types.Currency
-	for _, txn := range ts {
-		for _, fee := range txn.MinerFees {
-			setFees = setFees.Add(fee)
-		}
-	}
+	setFees := transactionSetFees(ts)
 	if requiredFees.Cmp(setFees) > 0 {
 		// TODO: check if there is an existing set with lower fees that we can
 		// kick out.
 		return errLowMinerFees
 	}
 
+	// Check that the transaction set does not push the value of the
+	// unconfirmed set over the limit.
+	if tp.exceedsPendingValue(ts) {
+		return modules.ErrPendingValueExceeded
+	}
+
+	// Check that enough space can be freed for the transaction set if it
+	// would push the unconfirmed set over the size limit.
+	if !tp.canMakeRoom(ts, setSize) {
+		return errFullTransactionPool
+	}
+
 	// Check for conflicts with other transactions, which would indicate a
 	// double-spend. Legal children of a transaction set will also trigger the
 	// conflict-detector.
@@ -284,63 +866,156 @@ func (tp *TransactionPool) acceptTransactionSet(ts []types.Transaction, txnFn fu
 		}
 	}
 	if len(conflicts) > 0 {
-		return tp.handleConflicts(ts, conflicts, txnFn)
+		// Revisions of a file contract replace the revisions with lower
+		// revision numbers instead of being merged with them.
+		superseded, err := tp.supersededRevisions(ts, conflicts)
+		if err != nil {
+			return err
+		} else if len(superseded) > 0 {
+			return tp.replaceRevisions(ts, superseded, txnFn)
+		}
+
+		err = tp.handleConflicts(ts, conflicts, txnFn)
+		// Sets that could not be merged with the sets they conflict with are
+		// remembered as double spend attempts.
+		_, isConflict := err.(modules.ConsensusConflict)
+		if isConflict {
+			for _, oid := range tp.doubleSpentObjects(ts, conflicts) {
+				if len(tp.doubleSpends) < maxDoubleSpends {
+					tp.doubleSpends[oid] = struct{}{}
+				}
+			}
+		}
+		// If the set could not be merged with the sets it conflicts with, it
+		// may still be able to replace the transactions it double spends.
+		// Replacements may be held for a grace period first to give the
+		// submitters of the conflicting sets a chance to improve them.
+		if isConflict && tp.replaceConflictingPackages && len(tp.replacedTransactions(ts, conflicts)) > 0 {
+			if tp.conflictGracePeriod > 0 {
+				return tp.holdReplacement(ts, conflicts, txnFn)
+			}
+			return tp.replaceConflictingPackage(ts, conflicts, txnFn)
+		}
+		return err
 	}
-	cc, err := txnFn(ts)
-	if err != nil {
+	cc, err := tp.validate(ts, txnFn)
+	missingParent := err == modules.ErrMissingSiacoinOutput || err == modules.ErrMissingFileContract
+	if missingParent && !tp.synced && tp.holdUnsyncedSets {
+		return tp.holdUnsyncedSet(ts)
+	} else if missingParent && tp.holdOrphanSets {
+		return tp.holdOrphanSet(ts)
+	} else if err == modules.ErrUnfinishedFileContract && tp.holdStorageProofs {
+		return tp.holdProofSet(ts)
+	} else if err != nil {
 		return modules.NewConsensusConflict("provided transaction set is standalone and invalid: " + err.Error())
 	}
 
 	// Add the transaction set to the pool.
-	setID := TransactionSetID(crypto.HashObject(ts))
-	tp.transactionSets[setID] = ts
-	for _, oid := range oids {
-		tp.knownObjects[oid] = setID
-	}
-	tp.transactionSetDiffs[setID] = &cc
-	tsetSize := len(encoding.Marshal(ts))
-	tp.transactionListSize += tsetSize
-	for _, txn := range ts {
-		if _, exists := tp.transactionHeights[txn.ID()]; !exists {
-			tp.transactionHeights[txn.ID()] = tp.blockHeight
-		}
-	}
-
-	// debug logging
-	if build.DEBUG {
-		txLogs := ""
-		for i, t := range ts {
-			txLogs += fmt.Sprintf("transaction %v size: %vB\n", i, len(encoding.Marshal(t)))
-		}
-		tp.log.Debugf("accepted transaction set %v, size: %vB\ntpool size is %vB after accpeting transaction set\ntransactions: \n%v\n", setID, tsetSize, tp.transactionListSize, txLogs)
-	}
+	tp.addTransactionSet(ts, cc)
 	return nil
 }
 
 // AcceptTransactionSet adds a transaction to the unconfirmed set of
 // transactions. If the transaction is accepted, it will be relayed to
-// connected peers.
+// connected peers. If the transaction set is held instead, the returned error
+// satisfies IsHeld.
 //
 // TODO: Break into component sets when the set gets accepted.
 func (tp *TransactionPool) AcceptTransactionSet(ts []types.Transaction) error {
-	// assert on consensus set to get special method
-	cs, ok := tp.consensusSet.(interface {
+	return tp.managedAcceptTransactionSet(ts, PriorityNormal, OriginLocal, "")
+}
+
+// AcceptTransactionSetWithPriority adds a transaction set to the unconfirmed
+// set of transactions, the same as AcceptTransactionSet, and attaches a
+// priority hint to its transactions. The hint only affects the local pool; it
+// is not relayed to peers.
+func (tp *TransactionPool) AcceptTransactionSetWithPriority(ts []types.Transaction, prio Priority) error {
+	return tp.managedAcceptTransactionSet(ts, prio, OriginLocal, "")
+}
+
+// managedAcceptTransactionSet adds a transaction set with the provided
+// priority and origin to the unconfirmed set of transactions, and relays it to
+// connected peers if it is accepted.
+func (tp *TransactionPool) managedAcceptTransactionSet(ts []types.Transaction, prio Priority, origin Origin, source string) error {
+	setID := TransactionSetID(crypto.HashObject(ts))
+
+	// Verify the signatures of the set before taking any locks, so that
+	// concurrent submissions are not serialized by the cryptographic work.
+	// Sets that will be refused or answered from the seen cache are not
+	// verified.
+	tp.mu.RLock()
+	height := tp.blockHeight
+	seen, _ := tp.seen.lookup(setID, tp.unconfirmedVersion, time.Now())
+	_, quarantined := tp.quarantinedSources[source]
+	tp.mu.RUnlock()
+	if !seen && !(source != "" && quarantined) {
+		tp.verifySignatures(ts, height)
+	}
+
+	// assert on consensus set to get special method. The trusted validation
+	// function is preferred, because it lets validation use the signature
+	// cache.
+	var lockedTry func(fn func(func(txns []types.Transaction) (modules.ConsensusChange, error)) error) error
+	wrap := func(txnFn func([]types.Transaction) (modules.ConsensusChange, error)) func([]types.Transaction) (modules.ConsensusChange, error) {
+		return txnFn
+	}
+	if cs, ok := tp.consensusSet.(interface {
+		LockedTryTrustedTransactionSet(fn func(func(txns []types.Transaction) (modules.ConsensusChange, error)) error) error
+	}); ok {
+		lockedTry = cs.LockedTryTrustedTransactionSet
+		wrap = tp.cachedTxnFn
+	} else if cs, ok := tp.consensusSet.(interface {
 		LockedTryTransactionSet(fn func(func(txns []types.Transaction) (modules.ConsensusChange, error)) error) error
-	})
-	if !ok {
+	}); ok {
+		lockedTry = cs.LockedTryTransactionSet
+	} else {
 		return errors.New("consensus set does not support LockedTryTransactionSet method")
 	}
 
-	return cs.LockedTryTransactionSet(func(txnFn func(txns []types.Transaction) (modules.ConsensusChange, error)) error {
+	return lockedTry(func(txnFn func(txns []types.Transaction) (modules.ConsensusChange, error)) error {
+		txnFn = wrap(txnFn)
 		tp.log.Debugln("Beginning broadcast of transaction set")
 		tp.mu.Lock()
 		defer tp.mu.Unlock()
-		err := tp.acceptTransactionSet(ts, txnFn)
-		if err != nil {
+
+		// Sets from quarantined sources are refused outright.
+		if _, exists := tp.quarantinedSources[source]; source != "" && exists {
+			return errQuarantined
+		}
+
+		// Sets that were submitted recently, while the unconfirmed set has not
+		// changed, return their previous result without being validated
+		// again.
+		seen, err := tp.seen.lookup(setID, tp.unconfirmedVersion, time.Now())
+		if !seen {
+			err = tp.acceptTransactionSet(ts, txnFn)
+			tp.seen.add(setID, err, tp.unconfirmedVersion, time.Now())
+		}
+		if IsHeld(err) {
+			tp.log.Debugln("Transaction set is being held:", err)
+			tp.metrics.addHeld(ts)
+			return err
+		} else if err != nil {
 			tp.log.Debugln("Transaction set broadcast has failed:", err)
+			for _, txn := range ts {
+				id, fee, size := transactionEvent(txn)
+				tp.events.LogReject(id, fee, size, err)
+			}
 			return err
 		}
+		tp.setPriority(ts, prio)
+		tp.setOrigin(ts, origin)
+		tp.setSource(ts, source)
+		for _, txn := range ts {
+			tp.events.LogAccept(transactionEvent(txn))
+		}
+		// Make room for the new set by evicting lower fee sets.
+		if tp.maxPoolSize > 0 {
+			tp.trim(tp.maxPoolSize, ts)
+		}
 		go tp.gateway.Broadcast("RelayTransactionSet", ts, tp.gateway.Peers())
+		// The new set may provide the parents of held orphans.
+		tp.promoteOrphanSets(txnFn)
 		// Notify subscribers of an accepted transaction set
 		tp.updateSubscribersTransactions()
 		tp.log.Debugln("Transaction set broadcast appears to have succeeded")
@@ -348,6 +1023,110 @@ func (tp *TransactionPool) AcceptTransactionSet(ts []types.Transaction) error {
 	})
 }
 
+// CheckTransactionAtHeight checks whether the provided transaction would be
+// accepted by the transaction pool if the blockchain were at height h, without
+// adding it to the pool. The timelock, coinbase maturity, and standalone
+// consensus checks are performed at height h, while the objects spent by the
+// transaction must exist in the current consensus set. Miner payouts that are
+// not spendable in consensus yet are therefore reported as missing. The pool's
+// fee requirements and conflicts with unconfirmed transactions are not
+// checked.
+func (tp *TransactionPool) CheckTransactionAtHeight(t types.Transaction, h types.BlockHeight) error {
+	if err := tp.tg.Add(); err != nil {
+		return err
+	}
+	defer tp.tg.Done()
+	cs, ok := tp.consensusSet.(interface {
+		TryTransactionSetAtHeight([]types.Transaction, types.BlockHeight) (modules.ConsensusChange, error)
+	})
+	if !ok {
+		return errors.New("consensus set does not support TryTransactionSetAtHeight method")
+	}
+
+	ts := []types.Transaction{t}
+	tp.mu.RLock()
+	_, err := tp.checkTransactionSetComposition(ts)
+	immature := tp.spendsImmatureCoinbase(ts, h)
+	tp.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+	if timelockHeight(ts) > h {
+		return modules.ErrNotFinalYet
+	}
+	if immature {
+		return modules.ErrImmatureCoinbase
+	}
+	_, err = cs.TryTransactionSetAtHeight(ts, h)
+	if err != nil {
+		return modules.NewConsensusConflict("transaction is invalid at the provided height: " + err.Error())
+	}
+	return nil
+}
+
+// A SpendConflict is returned by CheckSet when two transactions spend, revise,
+// or prove the same object. First is the transaction that spends the object
+// first, which is part of the transaction pool if InPool is set, and Second is
+// the transaction of the checked set that spends it again.
+type SpendConflict struct {
+	Object ObjectID
+	First  types.TransactionID
+	Second types.TransactionID
+	InPool bool
+}
+
+// Error implements the error interface.
+func (sc SpendConflict) Error() string {
+	if sc.InPool {
+		return fmt.Sprintf("transaction %v spends object %v, which is already spent by transaction %v in the transaction pool", sc.Second, crypto.Hash(sc.Object), sc.First)
+	}
+	return fmt.Sprintf("transactions %v and %v of the set both spend object %v", sc.First, sc.Second, crypto.Hash(sc.Object))
+}
+
+// CheckSet checks that no two transactions of the provided set spend the same
+// object, and that none of the transactions spend an object that is already
+// spent by a different transaction in the transaction pool. The first
+// conflict that is found is returned as a SpendConflict. Neither the set nor
+// the pool is modified, and the set is not otherwise validated.
+func (tp *TransactionPool) CheckSet(ts []types.Transaction) error {
+	ids := make(map[types.TransactionID]struct{})
+	setSpends := make(map[ObjectID]types.TransactionID)
+	for _, txn := range ts {
+		id := txn.ID()
+		ids[id] = struct{}{}
+		for _, oid := range spentObjectIDs(txn) {
+			if first, exists := setSpends[oid]; exists && first != id {
+				return SpendConflict{Object: oid, First: first, Second: id}
+			}
+			setSpends[oid] = id
+		}
+	}
+
+	tp.mu.RLock()
+	defer tp.mu.RUnlock()
+	for _, txn := range ts {
+		id := txn.ID()
+		for _, oid := range spentObjectIDs(txn) {
+			setID, exists := tp.knownObjects[oid]
+			if !exists {
+				continue
+			}
+			for _, poolTxn := range tp.transactionSets[setID] {
+				poolID := poolTxn.ID()
+				if _, duplicate := ids[poolID]; duplicate {
+					continue
+				}
+				for _, poolOID := range spentObjectIDs(poolTxn) {
+					if poolOID == oid {
+						return SpendConflict{Object: oid, First: poolID, Second: id, InPool: true}
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
 // relayTransactionSet is an RPC that accepts a transaction set from a peer. If
 // the accept is successful, the transaction will be relayed to the gateway's
 // other peers.
@@ -377,5 +1156,5 @@ func (tp *TransactionPool) relayTransactionSet(conn modules.PeerConn) error {
 		return err
 	}
 
-	return tp.AcceptTransactionSet(ts)
+	return tp.AcceptTransactionSetFrom(conn.RPCAddr().Host(), ts)
 }
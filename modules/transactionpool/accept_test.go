@@ -1,10 +1,14 @@
 package transactionpool
 
 import (
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/types"
+	"github.com/NebulousLabs/errors"
 	"github.com/NebulousLabs/fastrand"
 )
 
@@ -485,6 +489,108 @@ func TestTransactionChild(t *testing.T) {
 	}
 }
 
+// TestMergedArrivals checks that a child merged into the set of its parent
+// gets an arrival time of its own, and that the parent keeps its arrival time.
+func TestMergedArrivals(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	tpt, err := createTpoolTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tpt.Close()
+
+	source, err := tpt.graphSource(types.SiacoinPrecision.Mul64(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	graph, err := types.TransactionGraph(source, []types.TransactionGraphEdge{
+		{Dest: 1, Fee: types.SiacoinPrecision.Mul64(10), Source: 0, Value: types.SiacoinPrecision.Mul64(90)},
+		{Dest: 2, Fee: types.SiacoinPrecision.Mul64(10), Source: 1, Value: types.SiacoinPrecision.Mul64(80)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parent, child := graph[0], graph[1]
+	err = tpt.tpool.AcceptTransactionSet([]types.Transaction{parent})
+	if err != nil {
+		t.Fatal(err)
+	}
+	arrival := time.Now().Add(-time.Hour)
+	tpt.tpool.transactionArrivals[parent.ID()] = arrival
+
+	// The child conflicts with the set of its parent, so the two are merged.
+	start := time.Now()
+	err = tpt.tpool.AcceptTransactionSet([]types.Transaction{child})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tpt.tpool.transactionSets) != 1 {
+		t.Fatal("expected the child to be merged into the set of its parent")
+	}
+	if !tpt.tpool.transactionArrivals[parent.ID()].Equal(arrival) {
+		t.Error("parent lost its arrival time in the merge")
+	}
+	if tpt.tpool.transactionArrivals[child.ID()].Before(start) {
+		t.Error("merged child has the wrong arrival time:", tpt.tpool.transactionArrivals[child.ID()])
+	}
+	if _, exists := tpt.tpool.transactionHeights[child.ID()]; !exists {
+		t.Error("merged child has no height")
+	}
+	for _, s := range tpt.tpool.Summaries() {
+		if s.ArrivalTime.IsZero() {
+			t.Error("summary has no arrival time:", s.ID)
+		}
+	}
+}
+
+// TestTransactionSetIndex checks that the index from transaction ids to
+// transaction sets follows merges and removals.
+func TestTransactionSetIndex(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	tpt, err := createTpoolTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tpt.Close()
+
+	source, err := tpt.graphSource(types.SiacoinPrecision.Mul64(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	graph, err := types.TransactionGraph(source, []types.TransactionGraphEdge{
+		{Dest: 1, Fee: types.SiacoinPrecision.Mul64(10), Source: 0, Value: types.SiacoinPrecision.Mul64(90)},
+		{Dest: 2, Fee: types.SiacoinPrecision.Mul64(10), Source: 1, Value: types.SiacoinPrecision.Mul64(80)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, txn := range graph {
+		err = tpt.tpool.AcceptTransactionSet([]types.Transaction{txn})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(tpt.tpool.transactionSets) != 1 || len(tpt.tpool.transactionSetIDs) != len(graph) {
+		t.Fatal("expected both transactions to be indexed in a single set")
+	}
+	for setID := range tpt.tpool.transactionSets {
+		for _, txn := range graph {
+			if id, exists := tpt.tpool.findTransactionSet(txn.ID()); !exists || id != setID {
+				t.Fatal("transaction is not indexed by the set that contains it")
+			}
+		}
+	}
+
+	tpt.tpool.Trim(0)
+	if len(tpt.tpool.transactionSetIDs) != 0 {
+		t.Fatal("evicted transactions are still indexed")
+	}
+}
+
 // TestNilAccept tries submitting a nil transaction set and a 0-len
 // transaction set to the transaction pool.
 func TestNilAccept(t *testing.T) {
@@ -776,3 +882,1213 @@ func TestPartialConfirmationWeave(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+// TestTimelockedTransactionSet checks that transaction sets spending outputs
+// with unexpired timelocks are rejected, or held and later submitted to the
+// pool if the transaction pool is configured to hold them.
+func TestTimelockedTransactionSet(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	tpt, err := createTpoolTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tpt.Close()
+
+	// Send money to an output that is timelocked until a few blocks into the
+	// future, and get that output confirmed.
+	uc := types.UnlockConditions{Timelock: tpt.cs.Height() + 4}
+	value := types.SiacoinPrecision.Mul64(100)
+	txns, err := tpt.wallet.SendSiacoins(value, uc.UnlockHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tpt.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lockedID types.SiacoinOutputID
+	for i, sco := range txns[len(txns)-1].SiacoinOutputs {
+		if sco.UnlockHash == uc.UnlockHash() {
+			lockedID = txns[len(txns)-1].SiacoinOutputID(uint64(i))
+		}
+	}
+	lockedSet := []types.Transaction{{
+		SiacoinInputs: []types.SiacoinInput{{
+			ParentID:         lockedID,
+			UnlockConditions: uc,
+		}},
+		SiacoinOutputs: []types.SiacoinOutput{{
+			Value:      value,
+			UnlockHash: types.UnlockConditions{}.UnlockHash(),
+		}},
+	}}
+
+	// By default the set should be rejected.
+	err = tpt.tpool.AcceptTransactionSet(lockedSet)
+	if err != modules.ErrNotFinalYet {
+		t.Fatal("expected modules.ErrNotFinalYet, got", err)
+	}
+
+	// Configure the pool to hold timelocked sets, and submit the set again.
+	err = tpt.tpool.SetSettings(modules.TransactionPoolSettings{HoldTimelockedSets: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tpt.tpool.AcceptTransactionSet(lockedSet)
+	if err != errTimelockedSetHeld || !IsHeld(err) {
+		t.Fatal("expected errTimelockedSetHeld, got", err)
+	}
+
+	// A timelocked set that is missing its signatures can never become valid,
+	// so it is rejected instead of being held.
+	unsigned := []types.Transaction{{
+		SiacoinInputs: []types.SiacoinInput{{
+			ParentID: types.SiacoinOutputID(crypto.Hash{1}),
+			UnlockConditions: types.UnlockConditions{
+				Timelock:           uc.Timelock,
+				PublicKeys:         []types.SiaPublicKey{{Algorithm: types.SignatureEd25519, Key: fastrand.Bytes(crypto.PublicKeySize)}},
+				SignaturesRequired: 1,
+			},
+		}},
+		SiacoinOutputs: []types.SiacoinOutput{{
+			Value:      value,
+			UnlockHash: types.UnlockConditions{}.UnlockHash(),
+		}},
+	}}
+	err = tpt.tpool.AcceptTransactionSet(unsigned)
+	if _, ok := err.(modules.ConsensusConflict); !ok || IsHeld(err) {
+		t.Fatal("expected a consensus conflict, got", err)
+	}
+	if len(tpt.tpool.timelockedSets) != 1 {
+		t.Fatal("invalid timelocked set was held")
+	}
+	err = tpt.tpool.AcceptTransactionSet(lockedSet)
+	if err != modules.ErrDuplicateTransactionSet {
+		t.Fatal("expected a duplicate error, got", err)
+	}
+	if len(tpt.tpool.TransactionList()) != 0 {
+		t.Fatal("held transaction set should not be in the unconfirmed set")
+	}
+
+	// Mine blocks until the timelock expires, at which point the set should
+	// appear in the transaction pool.
+	for tpt.cs.Height() < uc.Timelock {
+		if len(tpt.tpool.TransactionList()) != 0 {
+			t.Fatal("held transaction set was submitted before its timelock expired")
+		}
+		_, err = tpt.miner.AddBlock()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(tpt.tpool.TransactionList()) != 1 {
+		t.Fatal("held transaction set was not submitted after its timelock expired")
+	}
+	if len(tpt.tpool.timelockedSets) != 0 || tpt.tpool.timelockedSetsSize != 0 {
+		t.Fatal("held transaction set was not cleared after being submitted")
+	}
+
+	// The set should confirm in the next block.
+	_, err = tpt.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tpt.tpool.TransactionList()) != 0 {
+		t.Fatal("promoted transaction set was not confirmed")
+	}
+}
+
+// TestValidFileContract checks that validFileContract rejects each kind of
+// malformed file contract.
+func TestValidFileContract(t *testing.T) {
+	height := types.BlockHeight(10)
+	valid := types.FileContract{
+		Payout:      types.NewCurrency64(1e9),
+		WindowStart: height + 1,
+		WindowEnd:   height + 2,
+	}
+	if err := validFileContract(valid, height); err != nil {
+		t.Fatal("valid file contract was rejected:", err)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(*types.FileContract)
+	}{
+		{"zero payout", func(fc *types.FileContract) { fc.Payout = types.ZeroCurrency }},
+		{"window start in the past", func(fc *types.FileContract) { fc.WindowStart = height - 1 }},
+		{"window start at current height", func(fc *types.FileContract) { fc.WindowStart = height }},
+		{"window end before window start", func(fc *types.FileContract) { fc.WindowEnd = fc.WindowStart - 1 }},
+		{"window end at window start", func(fc *types.FileContract) { fc.WindowEnd = fc.WindowStart }},
+	}
+	for _, test := range tests {
+		fc := valid
+		test.modify(&fc)
+		err := validFileContract(fc, height)
+		if !errors.Contains(err, modules.ErrInvalidFileContract) {
+			t.Errorf("%v: expected modules.ErrInvalidFileContract, got %v", test.name, err)
+		}
+	}
+}
+
+// TestAcceptInvalidFileContract checks that the transaction pool rejects
+// transaction sets with malformed file contracts.
+func TestAcceptInvalidFileContract(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	tpt, err := createTpoolTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tpt.Close()
+
+	builder, err := tpt.wallet.StartTransaction()
+	if err != nil {
+		t.Fatal(err)
+	}
+	payout := types.NewCurrency64(1e9)
+	err = builder.FundSiacoins(payout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	builder.AddFileContract(types.FileContract{
+		WindowStart:        tpt.cs.Height() + 5,
+		WindowEnd:          tpt.cs.Height() + 2,
+		Payout:             payout,
+		ValidProofOutputs:  []types.SiacoinOutput{{Value: types.PostTax(tpt.cs.Height(), payout)}},
+		MissedProofOutputs: []types.SiacoinOutput{{Value: types.PostTax(tpt.cs.Height(), payout)}},
+		UnlockHash:         types.UnlockConditions{}.UnlockHash(),
+	})
+	tSet, err := builder.Sign(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tpt.tpool.AcceptTransactionSet(tSet)
+	if !errors.Contains(err, modules.ErrInvalidFileContract) {
+		t.Fatal("expected modules.ErrInvalidFileContract, got", err)
+	}
+}
+
+// TestReplaceConflictingPackage checks that a transaction set can replace the
+// transactions it conflicts with only when replacement is enabled and the new
+// set pays more in fees than the conflicting transactions and all of their
+// descendants.
+func TestReplaceConflictingPackage(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	tpt, err := createTpoolTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tpt.Close()
+
+	// Create a transaction sending money to an output that TransactionGraph can
+	// spend.
+	txns, err := tpt.wallet.SendSiacoins(types.SiacoinPrecision.Mul64(100), types.UnlockConditions{}.UnlockHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := txns[len(txns)-1].SiacoinOutputID(0)
+	_, err = tpt.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Create a low fee parent with a high fee child, and submit them together.
+	pkg, err := types.TransactionGraph(source, []types.TransactionGraphEdge{
+		{Dest: 1, Fee: types.SiacoinPrecision.Mul64(10), Source: 0, Value: types.SiacoinPrecision.Mul64(90)},
+		{Dest: 2, Fee: types.SiacoinPrecision.Mul64(50), Source: 1, Value: types.SiacoinPrecision.Mul64(40)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tpt.tpool.AcceptTransactionSet(pkg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Create two replacements for the parent, one that outbids only the parent
+	// and one that outbids the whole package.
+	lowReplacement, err := types.TransactionGraph(source, []types.TransactionGraphEdge{
+		{Dest: 1, Fee: types.SiacoinPrecision.Mul64(30), Source: 0, Value: types.SiacoinPrecision.Mul64(70)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	highReplacement, err := types.TransactionGraph(source, []types.TransactionGraphEdge{
+		{Dest: 1, Fee: types.SiacoinPrecision.Mul64(70), Source: 0, Value: types.SiacoinPrecision.Mul64(30)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// With replacement disabled, both replacements should be rejected.
+	err = tpt.tpool.AcceptTransactionSet(highReplacement)
+	if _, ok := err.(modules.ConsensusConflict); !ok {
+		t.Fatal("expected a consensus conflict, got", err)
+	}
+
+	err = tpt.tpool.SetSettings(modules.TransactionPoolSettings{ReplaceConflictingPackages: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tpt.tpool.AcceptTransactionSet(lowReplacement)
+	if err != errLowReplacementFees {
+		t.Fatal("expected errLowReplacementFees, got", err)
+	}
+	err = tpt.tpool.AcceptTransactionSet(highReplacement)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The original package should be gone from the pool.
+	for _, txn := range pkg {
+		if _, _, exists := tpt.tpool.Transaction(txn.ID()); exists {
+			t.Fatal("replaced transaction is still in the pool")
+		}
+	}
+	if _, _, exists := tpt.tpool.Transaction(highReplacement[0].ID()); !exists {
+		t.Fatal("replacement transaction is not in the pool")
+	}
+	if len(tpt.tpool.TransactionList()) != 1 {
+		t.Fatal("unexpected number of transactions in the pool:", len(tpt.tpool.TransactionList()))
+	}
+}
+
+// TestReplaceConflictingTransaction checks that a replacement only evicts the
+// transaction it double spends and the transactions that depend on it, and
+// keeps the other transactions of the conflicting set.
+func TestReplaceConflictingTransaction(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	tpt, err := createTpoolTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tpt.Close()
+	source, err := tpt.graphSource(types.SiacoinPrecision.Mul64(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tpt.tpool.SetSettings(modules.TransactionPoolSettings{ReplaceConflictingPackages: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Create a parent with two children, the first of which has a child of
+	// its own, and submit them as a single set.
+	graph, err := types.TransactionGraph(source, []types.TransactionGraphEdge{
+		{Dest: 1, Fee: types.SiacoinPrecision.Mul64(5), Source: 0, Value: types.SiacoinPrecision.Mul64(40)},
+		{Dest: 2, Fee: types.SiacoinPrecision.Mul64(5), Source: 0, Value: types.SiacoinPrecision.Mul64(50)},
+		{Dest: 3, Fee: types.SiacoinPrecision.Mul64(10), Source: 1, Value: types.SiacoinPrecision.Mul64(30)},
+		{Dest: 4, Fee: types.SiacoinPrecision.Mul64(10), Source: 2, Value: types.SiacoinPrecision.Mul64(40)},
+		{Dest: 5, Fee: types.SiacoinPrecision.Mul64(10), Source: 3, Value: types.SiacoinPrecision.Mul64(20)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(graph) != 4 {
+		t.Fatal("expected 4 transactions, got", len(graph))
+	}
+	err = tpt.tpool.AcceptTransactionSet(graph)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Replace the first child. Only the first child and its own child pay
+	// fees that the replacement has to outbid.
+	minFee, err := tpt.tpool.MinReplacementFee(graph[1].ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !minFee.Equals(types.SiacoinPrecision.Mul64(20).Add(types.NewCurrency64(1))) {
+		t.Fatal("unexpected minimum replacement fee:", minFee)
+	}
+	fee := types.SiacoinPrecision.Mul64(25)
+	replacement := types.Transaction{
+		SiacoinInputs:  []types.SiacoinInput{{ParentID: graph[0].SiacoinOutputID(0)}},
+		SiacoinOutputs: []types.SiacoinOutput{{Value: types.SiacoinPrecision.Mul64(40).Sub(fee), UnlockHash: types.UnlockConditions{}.UnlockHash()}},
+		MinerFees:      []types.Currency{fee},
+	}
+	err = tpt.tpool.AcceptTransactionSet([]types.Transaction{graph[0], replacement})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The replaced child and its child should be gone, while the parent and
+	// the other branch stay in the pool.
+	for i, txn := range graph {
+		_, _, exists := tpt.tpool.Transaction(txn.ID())
+		if replaced := i == 1 || i == 3; exists == replaced {
+			t.Fatalf("transaction %v: in pool %v, replaced %v", i, exists, replaced)
+		}
+	}
+	if _, _, exists := tpt.tpool.Transaction(replacement.ID()); !exists {
+		t.Fatal("replacement is not in the pool")
+	}
+	if len(tpt.tpool.TransactionList()) != 3 {
+		t.Fatal("unexpected number of transactions in the pool:", len(tpt.tpool.TransactionList()))
+	}
+}
+
+// TestTopologicalOrder checks that topologicalOrder places parents before
+// their children and rejects cyclic dependency graphs. Transaction ids commit
+// to the outputs that a transaction spends, so a cyclic transaction set cannot
+// actually be constructed; the cycles are instead fed to the dependency graph
+// directly.
+func TestTopologicalOrder(t *testing.T) {
+	tests := []struct {
+		parents [][]int
+		order   []int
+		err     error
+	}{
+		{parents: [][]int{}, order: []int{}},
+		{parents: [][]int{nil, {0}, {1}}, order: []int{0, 1, 2}},
+		{parents: [][]int{{1}, {2}, nil}, order: []int{2, 1, 0}},
+		{parents: [][]int{{1, 2}, nil, {1}}, order: []int{1, 2, 0}},
+		{parents: [][]int{{1}, {0}}, err: modules.ErrCyclicDependency},
+		{parents: [][]int{nil, {2}, {3}, {1}}, err: modules.ErrCyclicDependency},
+		{parents: [][]int{{0}}, err: modules.ErrCyclicDependency},
+	}
+	for i, test := range tests {
+		order, err := topologicalOrder(test.parents)
+		if err != test.err {
+			t.Fatalf("test %v: expected %v, got %v", i, test.err, err)
+		}
+		if err != nil {
+			continue
+		}
+		if len(order) != len(test.order) {
+			t.Fatalf("test %v: expected order %v, got %v", i, test.order, order)
+		}
+		for j := range order {
+			if order[j] != test.order[j] {
+				t.Fatalf("test %v: expected order %v, got %v", i, test.order, order)
+			}
+		}
+	}
+}
+
+// TestAcceptUnorderedSet checks that a transaction set that lists children
+// before their parents is sorted and accepted.
+func TestAcceptUnorderedSet(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	tpt, err := createTpoolTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tpt.Close()
+
+	txns, err := tpt.wallet.SendSiacoins(types.SiacoinPrecision.Mul64(100), types.UnlockConditions{}.UnlockHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	graphTxns, err := types.TransactionGraph(txns[len(txns)-1].SiacoinOutputID(0), []types.TransactionGraphEdge{
+		{Dest: 1, Fee: types.SiacoinPrecision.Mul64(10), Source: 0, Value: types.SiacoinPrecision.Mul64(90)},
+		{Dest: 2, Fee: types.SiacoinPrecision.Mul64(10), Source: 1, Value: types.SiacoinPrecision.Mul64(80)},
+		{Dest: 3, Fee: types.SiacoinPrecision.Mul64(10), Source: 2, Value: types.SiacoinPrecision.Mul64(70)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reversed := make([]types.Transaction, 0, len(graphTxns))
+	for i := len(graphTxns) - 1; i >= 0; i-- {
+		reversed = append(reversed, graphTxns[i])
+	}
+	err = tpt.tpool.AcceptTransactionSet(reversed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, txn := range graphTxns {
+		if _, _, exists := tpt.tpool.Transaction(txn.ID()); !exists {
+			t.Fatal("transaction from the unordered set is not in the pool")
+		}
+	}
+}
+
+// TestCoinbaseMaturity checks that transactions spending a miner payout are
+// rejected until the payout has reached the coinbase maturity of the
+// transaction pool.
+func TestCoinbaseMaturity(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	tpt, err := createTpoolTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tpt.Close()
+
+	maturity := types.MaturityDelay + 3
+	err = tpt.tpool.SetSettings(modules.TransactionPoolSettings{CoinbaseMaturity: maturity})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Mine a block with a payout that TransactionGraph can spend.
+	block, target, err := tpt.miner.BlockForWork()
+	if err != nil {
+		t.Fatal(err)
+	}
+	block.MinerPayouts[0].UnlockHash = types.UnlockConditions{}.UnlockHash()
+	solvedBlock, solved := tpt.miner.SolveBlock(block, target)
+	if !solved {
+		t.Fatal("failed to solve block")
+	}
+	err = tpt.cs.AcceptBlock(solvedBlock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payout := solvedBlock.MinerPayouts[0].Value
+	fee := types.SiacoinPrecision.Mul64(10)
+	graphTxns, err := types.TransactionGraph(solvedBlock.MinerPayoutID(0), []types.TransactionGraphEdge{{
+		Dest:   1,
+		Fee:    fee,
+		Source: 0,
+		Value:  payout.Sub(fee),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Mine enough blocks for the payout to mature in consensus, but not for it
+	// to reach the coinbase maturity.
+	for i := types.BlockHeight(0); i < types.MaturityDelay+1; i++ {
+		_, err = tpt.miner.AddBlock()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = tpt.tpool.AcceptTransactionSet(graphTxns)
+	if err != modules.ErrImmatureCoinbase {
+		t.Fatal("expected modules.ErrImmatureCoinbase, got", err)
+	}
+
+	// Mine the remaining blocks, after which the spend should be accepted.
+	for i := types.MaturityDelay + 1; i < maturity; i++ {
+		_, err = tpt.miner.AddBlock()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = tpt.tpool.AcceptTransactionSet(graphTxns)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestCheckTransactionAtHeight checks that transactions spending timelocked
+// outputs and young miner payouts are only valid from the right heights
+// onwards.
+func TestCheckTransactionAtHeight(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	tpt, err := createTpoolTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tpt.Close()
+
+	// Create a spend of an output that is timelocked a few blocks into the
+	// future.
+	lockHeight := tpt.cs.Height() + 4
+	uc := types.UnlockConditions{Timelock: lockHeight}
+	value := types.SiacoinPrecision.Mul64(100)
+	txns, err := tpt.wallet.SendSiacoins(value, uc.UnlockHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tpt.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lockedID types.SiacoinOutputID
+	for i, sco := range txns[len(txns)-1].SiacoinOutputs {
+		if sco.UnlockHash == uc.UnlockHash() {
+			lockedID = txns[len(txns)-1].SiacoinOutputID(uint64(i))
+		}
+	}
+	lockedTxn := types.Transaction{
+		SiacoinInputs: []types.SiacoinInput{{
+			ParentID:         lockedID,
+			UnlockConditions: uc,
+		}},
+		SiacoinOutputs: []types.SiacoinOutput{{
+			Value:      value,
+			UnlockHash: types.UnlockConditions{}.UnlockHash(),
+		}},
+	}
+	if err := tpt.tpool.CheckTransactionAtHeight(lockedTxn, lockHeight-1); err != modules.ErrNotFinalYet {
+		t.Fatal("expected modules.ErrNotFinalYet before the timelock, got", err)
+	}
+	if err := tpt.tpool.CheckTransactionAtHeight(lockedTxn, lockHeight); err != nil {
+		t.Fatal("transaction is not valid at the timelock height:", err)
+	}
+
+	// Create a spend of a miner payout that matures in consensus, but not yet
+	// according to the coinbase maturity of the pool.
+	maturity := types.MaturityDelay + 3
+	err = tpt.tpool.SetSettings(modules.TransactionPoolSettings{CoinbaseMaturity: maturity})
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, target, err := tpt.miner.BlockForWork()
+	if err != nil {
+		t.Fatal(err)
+	}
+	block.MinerPayouts[0].UnlockHash = types.UnlockConditions{}.UnlockHash()
+	solvedBlock, solved := tpt.miner.SolveBlock(block, target)
+	if !solved {
+		t.Fatal("failed to solve block")
+	}
+	err = tpt.cs.AcceptBlock(solvedBlock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payoutHeight := tpt.cs.Height()
+	payout := solvedBlock.MinerPayouts[0].Value
+	fee := types.SiacoinPrecision.Mul64(10)
+	graphTxns, err := types.TransactionGraph(solvedBlock.MinerPayoutID(0), []types.TransactionGraphEdge{{
+		Dest:   1,
+		Fee:    fee,
+		Source: 0,
+		Value:  payout.Sub(fee),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := types.BlockHeight(0); i < types.MaturityDelay+1; i++ {
+		_, err = tpt.miner.AddBlock()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tpt.tpool.CheckTransactionAtHeight(graphTxns[0], tpt.cs.Height()); err != modules.ErrImmatureCoinbase {
+		t.Fatal("expected modules.ErrImmatureCoinbase at the current height, got", err)
+	}
+	if err := tpt.tpool.CheckTransactionAtHeight(graphTxns[0], payoutHeight+maturity-1); err != modules.ErrImmatureCoinbase {
+		t.Fatal("expected modules.ErrImmatureCoinbase just before maturity, got", err)
+	}
+	if err := tpt.tpool.CheckTransactionAtHeight(graphTxns[0], payoutHeight+maturity); err != nil {
+		t.Fatal("transaction is not valid at the maturity height:", err)
+	}
+
+	// Checking a transaction should not add it to the pool.
+	if len(tpt.tpool.TransactionList()) != 0 {
+		t.Fatal("checked transactions were added to the pool")
+	}
+}
+
+// TestConsolidateParentOutputs checks the bookkeeping of a child that spends
+// two outputs of the same unconfirmed parent.
+func TestConsolidateParentOutputs(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	tpt, err := createTpoolTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tpt.Close()
+
+	txns, err := tpt.wallet.SendSiacoins(types.SiacoinPrecision.Mul64(100), types.UnlockConditions{}.UnlockHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tpt.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Create a parent with two outputs, both of which are spent by the child.
+	graphTxns, err := types.TransactionGraph(txns[len(txns)-1].SiacoinOutputID(0), []types.TransactionGraphEdge{
+		{Dest: 1, Fee: types.SiacoinPrecision.Mul64(10), Source: 0, Value: types.SiacoinPrecision.Mul64(90)},
+		{Dest: 2, Fee: types.SiacoinPrecision.Mul64(5), Source: 1, Value: types.SiacoinPrecision.Mul64(40)},
+		{Dest: 2, Fee: types.SiacoinPrecision.Mul64(5), Source: 1, Value: types.SiacoinPrecision.Mul64(40)},
+		{Dest: 3, Fee: types.SiacoinPrecision.Mul64(10), Source: 2, Value: types.SiacoinPrecision.Mul64(70)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(graphTxns) != 3 || len(graphTxns[2].SiacoinInputs) != 2 {
+		t.Fatal("graph was not built as expected")
+	}
+	deps := setDependencies(graphTxns)
+	if len(deps[2]) != 1 || deps[2][0] != 1 {
+		t.Fatal("child should depend on its parent exactly once:", deps[2])
+	}
+
+	// Submit the parents first, and then the child on its own.
+	err = tpt.tpool.AcceptTransactionSet(graphTxns[:2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tpt.tpool.AcceptTransactionSet(graphTxns[2:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tpt.tpool.transactionSets) != 1 {
+		t.Fatal("child was not merged with its parent:", len(tpt.tpool.transactionSets))
+	}
+	_, parents, exists := tpt.tpool.Transaction(graphTxns[2].ID())
+	if !exists {
+		t.Fatal("child is not in the pool")
+	}
+	ancestors := tpt.tpool.Ancestors(graphTxns[2].ID())
+	for _, list := range [][]types.Transaction{parents, ancestors} {
+		if len(list) != 2 || list[0].ID() != graphTxns[0].ID() || list[1].ID() != graphTxns[1].ID() {
+			t.Fatal("parents of the child are wrong:", len(list))
+		}
+	}
+
+	// Removing the set should clear all of the bookkeeping.
+	tpt.tpool.Trim(0)
+	if len(tpt.tpool.knownObjects) != 0 || len(tpt.tpool.transactionHeights) != 0 || tpt.tpool.transactionListSize != 0 {
+		t.Fatal("bookkeeping was not cleared")
+	}
+}
+
+// TestMinReplacementFee checks that MinReplacementFee reports the fee that a
+// replacement has to pay under the current MinReplacementFeeBump.
+func TestMinReplacementFee(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	tpt, err := createTpoolTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tpt.Close()
+
+	txns, err := tpt.wallet.SendSiacoins(types.SiacoinPrecision.Mul64(100), types.UnlockConditions{}.UnlockHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := txns[len(txns)-1].SiacoinOutputID(0)
+	_, err = tpt.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Submit a package paying 60 SC in fees.
+	pkg, err := types.TransactionGraph(source, []types.TransactionGraphEdge{
+		{Dest: 1, Fee: types.SiacoinPrecision.Mul64(10), Source: 0, Value: types.SiacoinPrecision.Mul64(90)},
+		{Dest: 2, Fee: types.SiacoinPrecision.Mul64(50), Source: 1, Value: types.SiacoinPrecision.Mul64(40)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tpt.tpool.AcceptTransactionSet(pkg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := tpt.tpool.MinReplacementFee(types.TransactionID{}); err != errTransactionNotFound {
+		t.Fatal("expected errTransactionNotFound, got", err)
+	}
+
+	// Without a bump, a replacement only has to pay more than the package.
+	minFee, err := tpt.tpool.MinReplacementFee(pkg[0].ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !minFee.Equals(types.SiacoinPrecision.Mul64(60).Add(types.NewCurrency64(1))) {
+		t.Fatal("unexpected minimum replacement fee:", minFee)
+	}
+
+	// Replacing the child only has to outbid the child.
+	minFee, err = tpt.tpool.MinReplacementFee(pkg[1].ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !minFee.Equals(types.SiacoinPrecision.Mul64(50).Add(types.NewCurrency64(1))) {
+		t.Fatal("unexpected minimum replacement fee for the child:", minFee)
+	}
+
+	// With a 50% bump, the whole package has to be outbid by half.
+	err = tpt.tpool.SetSettings(modules.TransactionPoolSettings{
+		MinReplacementFeeBump:      50,
+		ReplaceConflictingPackages: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	minFee, err = tpt.tpool.MinReplacementFee(pkg[0].ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !minFee.Equals(types.SiacoinPrecision.Mul64(90)) {
+		t.Fatal("unexpected minimum replacement fee:", minFee)
+	}
+
+	lowReplacement, err := types.TransactionGraph(source, []types.TransactionGraphEdge{
+		{Dest: 1, Fee: types.SiacoinPrecision.Mul64(80), Source: 0, Value: types.SiacoinPrecision.Mul64(20)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tpt.tpool.AcceptTransactionSet(lowReplacement)
+	if err != errLowReplacementFees {
+		t.Fatal("expected errLowReplacementFees, got", err)
+	}
+	replacement, err := types.TransactionGraph(source, []types.TransactionGraphEdge{
+		{Dest: 1, Fee: minFee, Source: 0, Value: types.SiacoinPrecision.Mul64(100).Sub(minFee)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tpt.tpool.AcceptTransactionSet(replacement)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestMaxReplacements checks that the transaction sets spending an output can
+// only be replaced MaxReplacements times.
+func TestMaxReplacements(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	tpt, err := createTpoolTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tpt.Close()
+
+	source, err := tpt.graphSource(types.SiacoinPrecision.Mul64(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tpt.tpool.SetSettings(modules.TransactionPoolSettings{
+		MaxReplacements:            2,
+		ReplaceConflictingPackages: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Each spend of the source pays a higher fee than the last, so each is a
+	// valid replacement of its predecessor.
+	spend := func(fee uint64) error {
+		graph, err := types.TransactionGraph(source, []types.TransactionGraphEdge{
+			{Dest: 1, Fee: types.SiacoinPrecision.Mul64(fee), Source: 0, Value: types.SiacoinPrecision.Mul64(100 - fee)},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tpt.tpool.AcceptTransactionSet(graph)
+	}
+	for _, fee := range []uint64{10, 20, 30} {
+		if err := spend(fee); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := spend(40); err != modules.ErrTooManyReplacements {
+		t.Fatal("expected modules.ErrTooManyReplacements, got", err)
+	}
+
+	// Once the spend is confirmed, the count should be forgotten.
+	_, err = tpt.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tpt.tpool.replacementCounts) != 0 {
+		t.Fatal("replacement counts were not cleared:", tpt.tpool.replacementCounts)
+	}
+}
+
+// TestDoubleSpentOutputs checks that DoubleSpentOutputs reports the outputs
+// that several transaction sets have attempted to spend.
+func TestDoubleSpentOutputs(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	tpt, err := createTpoolTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tpt.Close()
+
+	txns, err := tpt.wallet.SendSiacoins(types.SiacoinPrecision.Mul64(100), types.UnlockConditions{}.UnlockHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := txns[len(txns)-1].SiacoinOutputID(0)
+	_, err = tpt.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	spend := func(fee uint64) []types.Transaction {
+		graph, err := types.TransactionGraph(source, []types.TransactionGraphEdge{
+			{Dest: 1, Fee: types.SiacoinPrecision.Mul64(fee), Source: 0, Value: types.SiacoinPrecision.Mul64(100 - fee)},
+			{Dest: 2, Fee: types.SiacoinPrecision.Mul64(fee), Source: 1, Value: types.SiacoinPrecision.Mul64(100 - 2*fee)},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return graph
+	}
+
+	// A chain of transactions spending the source is not a double spend.
+	incumbent := spend(10)
+	err = tpt.tpool.AcceptTransactionSet(incumbent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := tpt.tpool.DoubleSpentOutputs(); len(ids) != 0 {
+		t.Fatal("expected no double spent outputs, got", ids)
+	}
+
+	// Several rejected attempts to spend the source should report it once.
+	for _, fee := range []uint64{20, 30} {
+		if err := tpt.tpool.AcceptTransactionSet(spend(fee)); err == nil {
+			t.Fatal("double spend was accepted")
+		}
+	}
+	ids := tpt.tpool.DoubleSpentOutputs()
+	if len(ids) != 1 || ids[0] != types.OutputID(source) {
+		t.Fatal("expected the source to be double spent, got", ids)
+	}
+
+	// Once the incumbent is confirmed, the source is forgotten.
+	_, err = tpt.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := tpt.tpool.DoubleSpentOutputs(); len(ids) != 0 {
+		t.Fatal("expected no double spent outputs after confirmation, got", ids)
+	}
+}
+
+// TestValidateOverride checks that the validation results of the transaction
+// pool can be controlled by overriding its validation function.
+func TestValidateOverride(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	tpt, err := createTpoolTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tpt.Close()
+
+	// Reject every set containing a specific transaction, regardless of
+	// whether it is valid.
+	rejected := types.Transaction{ArbitraryData: [][]byte{append(modules.PrefixNonSia[:], 1)}}
+	accepted := types.Transaction{ArbitraryData: [][]byte{append(modules.PrefixNonSia[:], 2)}}
+	errForced := errors.New("forced validation failure")
+	tpt.tpool.mu.Lock()
+	tpt.tpool.validate = func(ts []types.Transaction, txnFn func([]types.Transaction) (modules.ConsensusChange, error)) (modules.ConsensusChange, error) {
+		for _, txn := range ts {
+			if txn.ID() == rejected.ID() {
+				return modules.ConsensusChange{}, errForced
+			}
+		}
+		return consensusValidate(ts, txnFn)
+	}
+	tpt.tpool.mu.Unlock()
+
+	err = tpt.tpool.AcceptTransactionSet([]types.Transaction{rejected})
+	if err == nil || !strings.Contains(err.Error(), errForced.Error()) {
+		t.Fatal("expected the forced validation failure, got", err)
+	}
+	err = tpt.tpool.AcceptTransactionSet([]types.Transaction{accepted})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestCheckSet checks that CheckSet reports double spends within a set and
+// with the transaction pool.
+func TestCheckSet(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	tpt, err := createTpoolTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tpt.Close()
+
+	source, err := tpt.graphSource(types.SiacoinPrecision.Mul64(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	spend := func(fee uint64) types.Transaction {
+		graph, err := types.TransactionGraph(source, []types.TransactionGraphEdge{
+			{Dest: 1, Fee: types.SiacoinPrecision.Mul64(fee), Source: 0, Value: types.SiacoinPrecision.Mul64(100 - fee)},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return graph[0]
+	}
+	first, second := spend(10), spend(20)
+
+	// Two transactions of the set spending the source should collide.
+	err = tpt.tpool.CheckSet([]types.Transaction{first, second})
+	sc, ok := err.(SpendConflict)
+	if !ok {
+		t.Fatal("expected a SpendConflict, got", err)
+	}
+	if sc.InPool || sc.Object != ObjectID(source) || sc.First != first.ID() || sc.Second != second.ID() {
+		t.Fatal("wrong conflict:", sc)
+	}
+	if err := tpt.tpool.CheckSet([]types.Transaction{first}); err != nil {
+		t.Fatal("consistent set was reported as conflicting:", err)
+	}
+
+	// Once the first spend is in the pool, the second conflicts with it, but
+	// the first is a duplicate.
+	err = tpt.tpool.AcceptTransactionSet([]types.Transaction{first})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tpt.tpool.CheckSet([]types.Transaction{second})
+	sc, ok = err.(SpendConflict)
+	if !ok {
+		t.Fatal("expected a SpendConflict, got", err)
+	}
+	if !sc.InPool || sc.Object != ObjectID(source) || sc.First != first.ID() || sc.Second != second.ID() {
+		t.Fatal("wrong conflict:", sc)
+	}
+	if err := tpt.tpool.CheckSet([]types.Transaction{first}); err != nil {
+		t.Fatal("transaction conflicts with itself:", err)
+	}
+	if len(tpt.tpool.TransactionList()) != 1 {
+		t.Fatal("CheckSet modified the pool")
+	}
+}
+
+// TestMismatchedUnlockConditions checks that a transaction providing unlock
+// conditions which do not hash to the unlock hash of the spent output is
+// rejected with a clear reason.
+func TestMismatchedUnlockConditions(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	tpt, err := createTpoolTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tpt.Close()
+
+	txns, err := tpt.wallet.SendSiacoins(types.SiacoinPrecision.Mul64(100), types.UnlockConditions{}.UnlockHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tpt.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	graph, err := types.TransactionGraph(txns[len(txns)-1].SiacoinOutputID(0), []types.TransactionGraphEdge{
+		{Dest: 1, Fee: types.SiacoinPrecision.Mul64(10), Source: 0, Value: types.SiacoinPrecision.Mul64(90)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Provide unlock conditions that are valid on their own, but that do not
+	// hash to the unlock hash of the output.
+	graph[0].SiacoinInputs[0].UnlockConditions = types.UnlockConditions{
+		PublicKeys: []types.SiaPublicKey{{Algorithm: types.SignatureEntropy}},
+	}
+	err = tpt.tpool.AcceptTransactionSet(graph)
+	if err == nil || !strings.Contains(err.Error(), modules.ErrWrongUnlockConditions.Error()) {
+		t.Fatal("expected ErrWrongUnlockConditions, got", err)
+	}
+}
+
+// TestMixedStorageProofTransaction checks that a transaction containing both a
+// storage proof and siacoin inputs is handled as both, registering the file
+// contract and the siacoin inputs that it spends with the conflict detection.
+func TestMixedStorageProofTransaction(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	tpt, err := createTpoolTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tpt.Close()
+
+	// COMPATv0.4.0 - storage proofs below height 10 use the buggy pre-fork
+	// rules.
+	for tpt.cs.Height() <= 10 {
+		_, err := tpt.miner.AddBlock()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Create an output that the proof transaction can spend to pay its fee.
+	txns, err := tpt.wallet.SendSiacoins(types.SiacoinPrecision.Mul64(100), types.UnlockConditions{}.UnlockHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := txns[len(txns)-1].SiacoinOutputID(0)
+
+	// Create and confirm a file contract for a file consisting of a single
+	// segment.
+	file := fastrand.Bytes(crypto.SegmentSize)
+	payout := types.NewCurrency64(400e6)
+	height := tpt.cs.Height()
+	builder, err := tpt.wallet.StartTransaction()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = builder.FundSiacoins(payout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fcIndex := builder.AddFileContract(types.FileContract{
+		FileSize:           uint64(len(file)),
+		FileMerkleRoot:     crypto.MerkleRoot(file),
+		WindowStart:        height + 2,
+		WindowEnd:          height + 5,
+		Payout:             payout,
+		ValidProofOutputs:  []types.SiacoinOutput{{Value: types.PostTax(height, payout)}},
+		MissedProofOutputs: []types.SiacoinOutput{{Value: types.PostTax(height, payout)}},
+	})
+	fcSet, err := builder.Sign(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tpt.tpool.AcceptTransactionSet(fcSet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fcid := fcSet[len(fcSet)-1].FileContractID(fcIndex)
+	_, err = tpt.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Submit a proof that also spends the output, paying it as a fee.
+	segment, hashSet := crypto.MerkleProof(file, 0)
+	sp := types.StorageProof{
+		ParentID: fcid,
+		HashSet:  hashSet,
+	}
+	copy(sp.Segment[:], segment)
+	mixedTxn := types.Transaction{
+		SiacoinInputs: []types.SiacoinInput{{
+			ParentID:         source,
+			UnlockConditions: types.UnlockConditions{},
+		}},
+		MinerFees:     []types.Currency{types.SiacoinPrecision.Mul64(100)},
+		StorageProofs: []types.StorageProof{sp},
+	}
+	err = tpt.tpool.AcceptTransactionSet([]types.Transaction{mixedTxn})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Both the file contract and the output should be registered.
+	for _, oid := range []ObjectID{ObjectID(fcid), ObjectID(source)} {
+		if _, exists := tpt.tpool.knownObjects[oid]; !exists {
+			t.Fatal("object spent by the mixed transaction is not registered")
+		}
+	}
+
+	// A double spend of the output should conflict with the mixed
+	// transaction.
+	doubleSpend, err := types.TransactionGraph(source, []types.TransactionGraphEdge{
+		{Dest: 1, Fee: types.SiacoinPrecision.Mul64(10), Source: 0, Value: types.SiacoinPrecision.Mul64(90)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tpt.tpool.AcceptTransactionSet(doubleSpend)
+	if _, ok := err.(modules.ConsensusConflict); !ok {
+		t.Fatal("expected a consensus conflict, got", err)
+	}
+
+	// The mixed transaction should be confirmed in the next block.
+	_, err = tpt.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	confirmed, err := tpt.tpool.TransactionConfirmed(mixedTxn.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !confirmed {
+		t.Fatal("mixed transaction was not confirmed")
+	}
+}
+
+// TestMaxPendingValue checks that transaction sets are rejected once they
+// would push the value of the unconfirmed set over MaxPendingValue.
+func TestMaxPendingValue(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	tpt, err := createTpoolTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tpt.Close()
+
+	source, err := tpt.graphSource(types.SiacoinPrecision.Mul64(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tpt.tpool.SetSettings(modules.TransactionPoolSettings{MaxPendingValue: types.SiacoinPrecision.Mul64(100)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	graph, err := types.TransactionGraph(source, []types.TransactionGraphEdge{
+		{Dest: 1, Fee: types.SiacoinPrecision.Mul64(10), Source: 0, Value: types.SiacoinPrecision.Mul64(90)},
+		{Dest: 2, Fee: types.SiacoinPrecision.Mul64(10), Source: 1, Value: types.SiacoinPrecision.Mul64(80)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The parent stays under the limit, but the child would cross it.
+	err = tpt.tpool.AcceptTransactionSet(graph[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tpt.tpool.AcceptTransactionSet(graph)
+	if err != modules.ErrPendingValueExceeded {
+		t.Fatal("expected modules.ErrPendingValueExceeded, got", err)
+	}
+	tpt.tpool.mu.RLock()
+	value := tpt.tpool.transactionListValue
+	tpt.tpool.mu.RUnlock()
+	if !value.Equals(types.SiacoinPrecision.Mul64(90)) {
+		t.Fatal("unexpected pending value:", value)
+	}
+
+	// Raising the limit to exactly the combined value admits the child.
+	err = tpt.tpool.SetSettings(modules.TransactionPoolSettings{MaxPendingValue: types.SiacoinPrecision.Mul64(170)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tpt.tpool.AcceptTransactionSet(graph)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Confirming the transactions frees up the limit.
+	_, err = tpt.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpt.tpool.mu.RLock()
+	value = tpt.tpool.transactionListValue
+	tpt.tpool.mu.RUnlock()
+	if !value.IsZero() {
+		t.Fatal("pending value was not released by confirmation:", value)
+	}
+}
@@ -0,0 +1,106 @@
+package transactionpool
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sort"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// sortedTransactionIDs returns the ids of all transactions in the transaction
+// pool in ascending byte order. Sorting makes the order independent of the
+// order in which the transactions were received, so that pools holding the
+// same transactions produce the same commitment.
+func (tp *TransactionPool) sortedTransactionIDs() []types.TransactionID {
+	var ids []types.TransactionID
+	for _, tSet := range tp.transactionSets {
+		for _, txn := range tSet {
+			ids = append(ids, txn.ID())
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return bytes.Compare(ids[i][:], ids[j][:]) < 0
+	})
+	return ids
+}
+
+// MerkleRoot returns the Merkle root of the sorted ids of all transactions in
+// the transaction pool. Two transaction pools have the same root if and only
+// if they contain the same transactions.
+func (tp *TransactionPool) MerkleRoot() crypto.Hash {
+	tp.mu.RLock()
+	defer tp.mu.RUnlock()
+
+	tree := crypto.NewTree()
+	for _, id := range tp.sortedTransactionIDs() {
+		tree.PushObject(id)
+	}
+	return tree.Root()
+}
+
+// transactionFingerprint returns the contribution of a single transaction to
+// the fingerprint returned by Fingerprint.
+func transactionFingerprint(id types.TransactionID) uint64 {
+	return binary.LittleEndian.Uint64(id[:8])
+}
+
+// Fingerprint returns a cheap summary of the transactions in the transaction
+// pool, which peers can exchange to decide whether they need to reconcile
+// their pools at all. The fingerprint is the XOR of the first eight bytes of
+// every transaction id in the pool, which makes it independent of the order
+// in which the transactions were received, and allows it to be updated in
+// constant time as transactions are added and removed.
+//
+// Unlike MerkleRoot, the fingerprint is not a commitment. Equal fingerprints
+// only suggest that two pools are identical: an XOR of 64 bit values collides
+// by chance, the fingerprint of an empty pool equals the fingerprint of any
+// pool in which the contributions of the transactions cancel out, and
+// because transaction ids are chosen by whoever creates the transactions, a
+// peer can grind transactions that leave the fingerprint of a pool unchanged.
+// Pools with equal fingerprints should be compared with MerkleRoot before
+// being treated as identical.
+func (tp *TransactionPool) Fingerprint() uint64 {
+	tp.mu.RLock()
+	defer tp.mu.RUnlock()
+	return tp.poolFingerprint
+}
+
+// MerkleProof returns a proof that the transaction with the provided id is
+// part of the root returned by MerkleRoot, consisting of the position of the
+// transaction among the sorted ids, the total number of ids, and the hashes
+// needed to rebuild the root. The proof is only valid for as long as the
+// transaction pool does not change. false is returned if the transaction is
+// not in the transaction pool.
+func (tp *TransactionPool) MerkleProof(id types.TransactionID) (proofIndex uint64, numLeaves uint64, hashSet []crypto.Hash, exists bool) {
+	tp.mu.RLock()
+	defer tp.mu.RUnlock()
+
+	ids := tp.sortedTransactionIDs()
+	i := sort.Search(len(ids), func(i int) bool {
+		return bytes.Compare(ids[i][:], id[:]) >= 0
+	})
+	if i == len(ids) || ids[i] != id {
+		return 0, 0, nil, false
+	}
+
+	tree := crypto.NewTree()
+	tree.SetIndex(uint64(i))
+	for _, id := range ids {
+		tree.PushObject(id)
+	}
+	_, proof, _, _ := tree.Prove()
+	hashSet = make([]crypto.Hash, len(proof)-1)
+	for j, p := range proof[1:] {
+		copy(hashSet[j][:], p)
+	}
+	return uint64(i), uint64(len(ids)), hashSet, true
+}
+
+// VerifyMerkleProof checks a proof returned by MerkleProof, returning true if
+// the transaction with the provided id is part of the Merkle root.
+func VerifyMerkleProof(id types.TransactionID, proofIndex uint64, numLeaves uint64, hashSet []crypto.Hash, root crypto.Hash) bool {
+	return crypto.VerifySegment(encoding.Marshal(id), hashSet, numLeaves, proofIndex, root)
+}
@@ -0,0 +1,139 @@
+package transactionpool
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestMerkleRoot checks that the Merkle root of the transaction pool commits
+// to its transactions independently of the order they arrived in, and that
+// inclusion proofs verify against it.
+func TestMerkleRoot(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	tpt, err := createTpoolTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tpt.Close()
+
+	emptyRoot := tpt.tpool.MerkleRoot()
+	if emptyRoot != crypto.NewTree().Root() {
+		t.Fatal("empty pool has the wrong root")
+	}
+
+	// Add several transactions to the pool.
+	for i := 0; i < 3; i++ {
+		_, err := tpt.wallet.SendSiacoins(types.SiacoinPrecision, types.UnlockConditions{}.UnlockHash())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	root := tpt.tpool.MerkleRoot()
+	if root == emptyRoot {
+		t.Fatal("root did not change when transactions were added")
+	}
+
+	// The root should not depend on the order of the transaction sets.
+	for i := 0; i < 10; i++ {
+		if tpt.tpool.MerkleRoot() != root {
+			t.Fatal("root is not deterministic")
+		}
+	}
+	tree := crypto.NewTree()
+	for _, id := range tpt.tpool.sortedTransactionIDs() {
+		tree.PushObject(id)
+	}
+	if tree.Root() != root {
+		t.Fatal("root does not match the sorted transaction ids")
+	}
+
+	// Every transaction should have a valid proof.
+	txns := tpt.tpool.TransactionList()
+	for _, txn := range txns {
+		index, numLeaves, hashSet, exists := tpt.tpool.MerkleProof(txn.ID())
+		if !exists {
+			t.Fatal("no proof for a transaction in the pool")
+		}
+		if numLeaves != uint64(len(txns)) {
+			t.Fatal("proof has the wrong number of leaves:", numLeaves)
+		}
+		if !VerifyMerkleProof(txn.ID(), index, numLeaves, hashSet, root) {
+			t.Fatal("proof does not verify")
+		}
+	}
+	if _, _, _, exists := tpt.tpool.MerkleProof(types.TransactionID{}); exists {
+		t.Fatal("proof returned for a transaction that is not in the pool")
+	}
+}
+
+// TestFingerprint checks that pools holding the same transactions have the
+// same fingerprint regardless of the order the transactions arrived in, and
+// that the fingerprint is kept up to date as transactions come and go.
+func TestFingerprint(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	tpt, err := createTpoolTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tpt.Close()
+
+	txns, err := tpt.wallet.SendSiacoins(types.SiacoinPrecision.Mul64(100), types.UnlockConditions{}.UnlockHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tpt.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tpt.tpool.Fingerprint() != 0 {
+		t.Fatal("empty pool has a non-zero fingerprint")
+	}
+	graph, err := types.TransactionGraph(txns[len(txns)-1].SiacoinOutputID(0), []types.TransactionGraphEdge{
+		{Dest: 1, Fee: types.SiacoinPrecision.Mul64(10), Source: 0, Value: types.SiacoinPrecision.Mul64(40)},
+		{Dest: 2, Fee: types.SiacoinPrecision.Mul64(10), Source: 0, Value: types.SiacoinPrecision.Mul64(40)},
+		{Dest: 3, Fee: types.SiacoinPrecision.Mul64(10), Source: 1, Value: types.SiacoinPrecision.Mul64(30)},
+		{Dest: 4, Fee: types.SiacoinPrecision.Mul64(10), Source: 2, Value: types.SiacoinPrecision.Mul64(30)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var expected uint64
+	for _, txn := range graph {
+		expected ^= transactionFingerprint(txn.ID())
+	}
+
+	// Submit the graph as a whole, and then one transaction at a time in a
+	// different order, which merges the transactions into a single set.
+	err = tpt.tpool.AcceptTransactionSet(graph)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tpt.tpool.Fingerprint() != expected {
+		t.Fatal("fingerprint does not match the transactions in the pool")
+	}
+	tpt.tpool.PurgeTransactionPool()
+	if tpt.tpool.Fingerprint() != 0 {
+		t.Fatal("purged pool has a non-zero fingerprint")
+	}
+	for _, i := range []int{0, 2, 1} {
+		err = tpt.tpool.AcceptTransactionSet([]types.Transaction{graph[i]})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if tpt.tpool.Fingerprint() != expected {
+		t.Fatal("fingerprint depends on the order the transactions arrived in")
+	}
+
+	// Removing the transactions removes their contributions.
+	tpt.tpool.Trim(0)
+	if tpt.tpool.Fingerprint() != 0 {
+		t.Fatal("fingerprint was not updated when the transactions were removed")
+	}
+}
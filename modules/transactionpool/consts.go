@@ -10,8 +10,11 @@ import (
 
 // Consts related to the persisting structures of the transactoin pool.
 const (
-	dbFilename = "transactionpool.db"
-	logFile    = "transactionpool.log"
+	dbFilename   = "transactionpool.db"
+	logFile      = "transactionpool.log"
+	poolFilename = "transactionpool.txns"
+
+	proofSetsFilename = "transactionpool.proofs"
 )
 
 // Constants related to the size and ease-of-entry of the transaction pool.
@@ -37,6 +40,92 @@ const (
 	// TransactionPoolSizeTarget defines the target size of the pool when the
 	// transactions are paying 1 SC / kb in fees.
 	TransactionPoolSizeTarget = 3e6
+
+	// defaultMaxSignatures is the default limit on the number of signatures
+	// that a single transaction may carry. It is well above what any regular
+	// transaction needs.
+	defaultMaxSignatures = 200
+)
+
+// Constants related to block construction.
+const (
+	// blockTemplateOverhead is the space that BlockTransactions leaves free
+	// in a block for the block header and the miner payouts. It matches the
+	// space reserved by the miner.
+	blockTemplateOverhead = 5e3
+)
+
+// Constants related to block reconciliation reports.
+const (
+	// maxBlockReconciliations is the number of reconciliation reports that
+	// the transaction pool keeps for the most recently applied blocks.
+	maxBlockReconciliations = 144
+)
+
+// Constants related to transaction sets that are not yet final.
+const (
+	// maxTimelockHoldDepth is the number of blocks into the future that a
+	// transaction set's timelocks may expire and still have the set be held
+	// by the transaction pool. Sets that won't become final for longer are
+	// rejected.
+	maxTimelockHoldDepth = types.BlockHeight(144)
+
+	// maxTimelockedSetsSize is the maximum combined size of all transaction
+	// sets being held until their timelocks expire.
+	maxTimelockedSetsSize = 1e6
+)
+
+// Constants related to transaction sets with premature storage proofs.
+const (
+	// maxProofSetsSize is the maximum combined size of all transaction sets
+	// being held until the proof windows of their file contracts open.
+	maxProofSetsSize = 1e6
+)
+
+// Constants related to transaction sets whose parents are missing.
+const (
+	// maxOrphanSetsSize is the maximum combined size of all transaction sets
+	// being held until their missing parents appear.
+	maxOrphanSetsSize = 1e6
+)
+
+// Constants related to transaction sets whose parents are missing while the
+// consensus set is not synced.
+const (
+	// maxUnsyncedSetsSize is the maximum combined size of all transaction
+	// sets being held until the consensus set catches up.
+	maxUnsyncedSetsSize = 1e6
+
+	// maxUnsyncedRetries is the number of consensus changes after which a
+	// transaction set held while the consensus set was not synced is dropped
+	// if its parents are still missing.
+	maxUnsyncedRetries = 3
+)
+
+// Constants related to replacing conflicting transaction sets.
+const (
+	// maxPendingReplacementsSize is the maximum combined size of all
+	// transaction sets waiting for the conflict grace period to pass.
+	maxPendingReplacementsSize = 1e6
+
+	// maxDoubleSpends is the maximum number of double spent objects that are
+	// tracked for DoubleSpentOutputs.
+	maxDoubleSpends = 10e3
+)
+
+// Constants related to rate limiting transaction set submissions.
+const (
+	// maxSeenCacheSize is the maximum number of recently submitted
+	// transaction sets whose results are cached.
+	maxSeenCacheSize = 10e3
+
+	// maxSignatureCacheSize is the maximum number of transactions whose
+	// verified signatures are cached.
+	maxSignatureCacheSize = 100e3
+
+	// rateLimitPruneInterval is how often the rate limiter forgets about
+	// sources that have been idle.
+	rateLimitPruneInterval = 10 * time.Minute
 )
 
 // Constants related to fee estimation.
@@ -62,6 +151,22 @@ var (
 		Header:  "Sia Transaction Pool DB",
 		Version: "0.6.0",
 	}
+	poolMetadata = persist.Metadata{
+		Header:  "Sia Transaction Pool Transactions",
+		Version: "1.3.3",
+	}
+	proofSetsMetadata = persist.Metadata{
+		Header:  "Sia Transaction Pool Held Storage Proofs",
+		Version: "1.3.3",
+	}
+
+	// poolSaveInterval is how often the unconfirmed transactions are written
+	// to the pool file.
+	poolSaveInterval = build.Select(build.Var{
+		Standard: 10 * time.Minute,
+		Dev:      time.Minute,
+		Testing:  10 * time.Second,
+	}).(time.Duration)
 )
 
 // Variables related to the size and ease-of-entry of the transaction pool.
@@ -80,4 +185,13 @@ var (
 		Dev:      20 * time.Second,
 		Testing:  3 * time.Second,
 	}).(time.Duration)
+
+	// seenCacheTTL is how long the result of submitting a transaction set is
+	// cached. Resubmitting the same set within this window returns the
+	// cached result without validating the set again.
+	seenCacheTTL = build.Select(build.Var{
+		Standard: 30 * time.Second,
+		Dev:      10 * time.Second,
+		Testing:  3 * time.Second,
+	}).(time.Duration)
 )
@@ -30,6 +30,10 @@ var (
 	// median.
 	bucketFeeMedian = []byte("FeeMedian")
 
+	// bucketMinerPayouts maps the ids of the recent miner payouts tracked for
+	// the coinbase maturity to the heights of the blocks that created them.
+	bucketMinerPayouts = []byte("MinerPayouts")
+
 	// bucketRecentConsensusChange holds the most recent consensus change seen
 	// by the transaction pool.
 	bucketRecentConsensusChange = []byte("RecentConsensusChange")
@@ -85,6 +89,12 @@ func (tp *TransactionPool) deleteTransaction(tx *bolt.Tx, id types.TransactionID
 	return tx.Bucket(bucketConfirmedTransactions).Delete(id[:])
 }
 
+// deleteMinerPayout stops tracking a miner payout.
+func (tp *TransactionPool) deleteMinerPayout(tx *bolt.Tx, id types.SiacoinOutputID) error {
+	delete(tp.minerPayouts, id)
+	return tx.Bucket(bucketMinerPayouts).Delete(id[:])
+}
+
 // getBlockHeight returns the most recent block height from the database.
 func (tp *TransactionPool) getBlockHeight(tx *bolt.Tx) (bh types.BlockHeight, err error) {
 	err = encoding.Unmarshal(tx.Bucket(bucketBlockHeight).Get(fieldBlockHeight), &bh)
@@ -106,6 +116,23 @@ func (tp *TransactionPool) getFeeMedian(tx *bolt.Tx) (medianPersist, error) {
 	return mp, nil
 }
 
+// getMinerPayouts returns the miner payouts tracked in the database.
+func (tp *TransactionPool) getMinerPayouts(tx *bolt.Tx) (map[types.SiacoinOutputID]types.BlockHeight, error) {
+	payouts := make(map[types.SiacoinOutputID]types.BlockHeight)
+	err := tx.Bucket(bucketMinerPayouts).ForEach(func(k, v []byte) error {
+		var id types.SiacoinOutputID
+		copy(id[:], k)
+		var height types.BlockHeight
+		err := encoding.Unmarshal(v, &height)
+		if err != nil {
+			return err
+		}
+		payouts[id] = height
+		return nil
+	})
+	return payouts, err
+}
+
 // getRecentBlockID will fetch the most recent block id and most recent parent
 // id from the database.
 func (tp *TransactionPool) getRecentBlockID(tx *bolt.Tx) (recentID types.BlockID, err error) {
@@ -146,6 +173,12 @@ func (tp *TransactionPool) putFeeMedian(tx *bolt.Tx, mp medianPersist) error {
 	return tx.Bucket(bucketFeeMedian).Put(fieldFeeMedian, objBytes)
 }
 
+// putMinerPayout tracks a miner payout created at the provided height.
+func (tp *TransactionPool) putMinerPayout(tx *bolt.Tx, id types.SiacoinOutputID, height types.BlockHeight) error {
+	tp.minerPayouts[id] = height
+	return tx.Bucket(bucketMinerPayouts).Put(id[:], encoding.Marshal(height))
+}
+
 // putRecentBlockID will store the most recent block id and the parent id of
 // that block in the database.
 func (tp *TransactionPool) putRecentBlockID(tx *bolt.Tx, recentID types.BlockID) error {
@@ -0,0 +1,272 @@
+package transactionpool
+
+import (
+	"bytes"
+	"sort"
+	"time"
+
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// evictionOrder returns the ids of all transaction sets in the pool, sorted
+// so that the sets which should be evicted first come first. Sets are ordered
+// by their priority, lowest priority first, and then by their fee per byte,
+// lowest fee first. Fees per byte are rounded down, so sets that pay no fee
+// at all come before sets paying a fee that rounds down to the same fee per
+// byte. Sets with equal priorities and fees are ordered by their
+// arrival time, newest first, so that the transactions that have waited in the
+// pool the longest are kept. The arrival time of a set is the arrival time of
+// its oldest transaction. Any remaining ties are broken by set id, which makes
+// the order deterministic.
+func (tp *TransactionPool) evictionOrder() []TransactionSetID {
+	type setFee struct {
+		id      TransactionSetID
+		fee     types.Currency
+		prio    Priority
+		zero    bool
+		arrival time.Time
+	}
+	fees := make([]setFee, 0, len(tp.transactionSets))
+	for id, tSet := range tp.transactionSets {
+		var arrival time.Time
+		for _, txn := range tSet {
+			if t, exists := tp.transactionArrivals[txn.ID()]; exists && (arrival.IsZero() || t.Before(arrival)) {
+				arrival = t
+			}
+		}
+		fees = append(fees, setFee{
+			id:      id,
+			fee:     modules.CalculateFee(tSet),
+			prio:    tp.setPriorityOf(tSet),
+			zero:    transactionSetFees(tSet).IsZero(),
+			arrival: arrival,
+		})
+	}
+	sort.Slice(fees, func(i, j int) bool {
+		if fees[i].prio != fees[j].prio {
+			return fees[i].prio < fees[j].prio
+		}
+		if c := fees[i].fee.Cmp(fees[j].fee); c != 0 {
+			return c < 0
+		}
+		if fees[i].zero != fees[j].zero {
+			return fees[i].zero
+		}
+		if !fees[i].arrival.Equal(fees[j].arrival) {
+			return fees[i].arrival.After(fees[j].arrival)
+		}
+		return bytes.Compare(fees[i].id[:], fees[j].id[:]) < 0
+	})
+	ids := make([]TransactionSetID, 0, len(fees))
+	for _, sf := range fees {
+		ids = append(ids, sf.id)
+	}
+	return ids
+}
+
+// Trim evicts transaction sets from the transaction pool until the pool is no
+// larger than targetSize bytes. Sets with a lower priority are evicted first,
+// and sets of equal priority are evicted lowest fee per byte first. Dependent
+// transactions are always part of the same set as their parents, which means
+// that evicting a set also evicts all of its dependents. Unlike the fee
+// requirements that are applied when transactions are accepted, Trim is an
+// on-demand operation, intended to be called by a host application that is
+// under memory pressure. Sets containing pinned transactions are never
+// evicted, so the pool may remain larger than targetSize. The number of
+// transactions evicted and their combined size in bytes are returned.
+func (tp *TransactionPool) Trim(targetSize int) (evicted int, evictedSize int) {
+	if err := tp.tg.Add(); err != nil {
+		return 0, 0
+	}
+	defer tp.tg.Done()
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+
+	evicted, evictedSize = tp.trim(targetSize, nil)
+	if evicted > 0 {
+		tp.updateSubscribersTransactions()
+	}
+	return evicted, evictedSize
+}
+
+// trim evicts transaction sets in eviction order until the unconfirmed set is
+// no larger than targetSize bytes. Sets that are pinned, or that contain any
+// of the transactions in keep, are never evicted. Subscribers are not
+// notified. A pool that is already small enough is left untouched without
+// computing the eviction order.
+func (tp *TransactionPool) trim(targetSize int, keep []types.Transaction) (evicted int, evictedSize int) {
+	if tp.transactionListSize <= targetSize {
+		return 0, 0
+	}
+	kept := tp.keptSets(keep)
+	for _, setID := range tp.evictionOrder() {
+		if tp.transactionListSize <= targetSize {
+			break
+		}
+		tSet := tp.transactionSets[setID]
+		if !tp.evictable(setID, kept) {
+			continue
+		}
+		for _, txn := range tSet {
+			tp.forgetTransaction(txn.ID())
+			tp.events.LogEvict(transactionEvent(txn))
+		}
+		evicted += len(tSet)
+		evictedSize += len(encoding.Marshal(tSet))
+		tp.removeTransactionSet(setID)
+	}
+	if evicted > 0 {
+		tp.log.Debugf("trimmed %v transactions totaling %vB from the transaction pool\n", evicted, evictedSize)
+	}
+	return evicted, evictedSize
+}
+
+// keptSets returns the ids of the transaction sets that contain any of the
+// provided transactions.
+func (tp *TransactionPool) keptSets(keep []types.Transaction) map[TransactionSetID]struct{} {
+	kept := make(map[TransactionSetID]struct{})
+	for _, txn := range keep {
+		if setID, exists := tp.findTransactionSet(txn.ID()); exists {
+			kept[setID] = struct{}{}
+		}
+	}
+	return kept
+}
+
+// evictable returns true if trim may evict the transaction set with the
+// provided id, which is the case unless the set is pinned or kept.
+func (tp *TransactionPool) evictable(setID TransactionSetID, kept map[TransactionSetID]struct{}) bool {
+	_, exists := kept[setID]
+	return !exists && !tp.setPinned(tp.transactionSets[setID])
+}
+
+// canMakeRoom returns true if a transaction set of setSize bytes fits into the
+// unconfirmed set without exceeding MaxPoolSize, or if the sets that trim
+// would evict to make room for it all pay a lower fee per byte than the set.
+// The sets are visited in eviction order, skipping the same sets as trim, so
+// the first set that pays at least as much as the new set ends the search.
+func (tp *TransactionPool) canMakeRoom(ts []types.Transaction, setSize uint64) bool {
+	if tp.maxPoolSize <= 0 {
+		return true
+	}
+	needed := tp.transactionListSize + int(setSize) - tp.maxPoolSize
+	if needed <= 0 {
+		return true
+	}
+	kept := tp.keptSets(ts)
+	fee := modules.CalculateFee(ts)
+	for _, setID := range tp.evictionOrder() {
+		if !tp.evictable(setID, kept) {
+			continue
+		}
+		tSet := tp.transactionSets[setID]
+		if modules.CalculateFee(tSet).Cmp(fee) >= 0 {
+			return false
+		}
+		needed -= len(encoding.Marshal(tSet))
+		if needed <= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// LowPriorityTransactions returns up to n of the transactions that Trim would
+// evict first, in the order in which they would be evicted, without removing
+// them from the pool. Pinned transactions are never returned, since they are
+// never evicted. A node can hand the returned transactions off, for example to
+// a peer or to disk, before shutting down or trimming the pool.
+func (tp *TransactionPool) LowPriorityTransactions(n int) []types.Transaction {
+	tp.mu.RLock()
+	defer tp.mu.RUnlock()
+
+	var txns []types.Transaction
+	for _, setID := range tp.evictionOrder() {
+		if len(txns) >= n {
+			break
+		}
+		tSet := tp.transactionSets[setID]
+		if tp.setPinned(tSet) {
+			continue
+		}
+		txns = append(txns, tSet...)
+	}
+	if len(txns) > n {
+		txns = txns[:n]
+	}
+	return txns
+}
+
+// evictTransaction evicts the transaction with the provided id and all of the
+// transactions that depend on it. The other transactions of its set are added
+// back to the pool one at a time.
+func (tp *TransactionPool) evictTransaction(id types.TransactionID, txnFn func([]types.Transaction) (modules.ConsensusChange, error)) {
+	for _, txn := range tp.removeTransaction(id, txnFn) {
+		tp.forgetTransaction(txn.ID())
+		tp.events.LogEvict(transactionEvent(txn))
+	}
+}
+
+// removeTransaction removes the transaction with the provided id and all of
+// the transactions that depend on it from the unconfirmed set, adding the
+// other transactions of its set back to the pool one at a time. The removed
+// transactions are returned, including any of the other transactions that
+// could not be added back. Their metadata is kept, and no events are logged.
+func (tp *TransactionPool) removeTransaction(id types.TransactionID, txnFn func([]types.Transaction) (modules.ConsensusChange, error)) []types.Transaction {
+	setID, exists := tp.findTransactionSet(id)
+	if !exists {
+		return nil
+	}
+	tSet := tp.transactionSets[setID]
+	parents := setDependencies(tSet)
+	order, err := topologicalOrder(parents)
+	if err != nil {
+		return nil
+	}
+
+	// Visiting the set in topological order ensures that every parent has been
+	// classified before its children.
+	evicted := make(map[int]bool)
+	for _, i := range order {
+		evicted[i] = tSet[i].ID() == id
+		for _, parent := range parents[i] {
+			evicted[i] = evicted[i] || evicted[parent]
+		}
+	}
+
+	tp.removeTransactionSet(setID)
+	var removed []types.Transaction
+	for _, i := range order {
+		txn := tSet[i]
+		if !evicted[i] {
+			if err := tp.acceptTransactionSet([]types.Transaction{txn}, txnFn); err == nil {
+				continue
+			}
+		}
+		removed = append(removed, txn)
+	}
+	return removed
+}
+
+// lowestEvictableFee returns the lowest fee per byte paid by an unpinned
+// transaction set, and a bool indicating whether the pool is close enough to
+// MaxPoolSize that a transaction of the largest standard size would not fit
+// without evicting a set.
+func (tp *TransactionPool) lowestEvictableFee() (types.Currency, bool) {
+	if tp.maxPoolSize <= 0 || tp.transactionListSize+modules.TransactionSizeLimit <= tp.maxPoolSize {
+		return types.ZeroCurrency, false
+	}
+	var lowest types.Currency
+	found := false
+	for _, tSet := range tp.transactionSets {
+		if tp.setPinned(tSet) {
+			continue
+		}
+		if fee := modules.CalculateFee(tSet); !found || fee.Cmp(lowest) < 0 {
+			lowest, found = fee, true
+		}
+	}
+	return lowest, found
+}
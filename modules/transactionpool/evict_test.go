@@ -0,0 +1,754 @@
+package transactionpool
+
+import (
+	"testing"
+	"time"
+
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+	"github.com/NebulousLabs/fastrand"
+)
+
+// TestTrim checks that Trim evicts the lowest fee transaction sets first, and
+// that trimming to zero empties the transaction pool.
+func TestTrim(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	tpt, err := createTpoolTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tpt.Close()
+
+	// Create and confirm a transaction with several outputs that can be spent
+	// by independent transaction sets.
+	value := types.SiacoinPrecision.Mul64(100)
+	builder, err := tpt.wallet.StartTransaction()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = builder.FundSiacoins(value.Mul64(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		builder.AddSiacoinOutput(types.SiacoinOutput{
+			Value:      value,
+			UnlockHash: types.UnlockConditions{}.UnlockHash(),
+		})
+	}
+	txnSet, err := builder.Sign(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tpt.tpool.AcceptTransactionSet(txnSet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tpt.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Submit a set spending each output, each paying a different fee.
+	var sets [][]types.Transaction
+	for i := 0; i < 3; i++ {
+		fee := types.SiacoinPrecision.Mul64(uint64(i + 1))
+		graphTxns, err := types.TransactionGraph(txnSet[len(txnSet)-1].SiacoinOutputID(uint64(i)), []types.TransactionGraphEdge{{
+			Dest:   1,
+			Fee:    fee,
+			Source: 0,
+			Value:  value.Sub(fee),
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = tpt.tpool.AcceptTransactionSet(graphTxns)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sets = append(sets, graphTxns)
+	}
+	if len(tpt.tpool.transactionSets) != 3 {
+		t.Fatal("expected 3 transaction sets, got", len(tpt.tpool.transactionSets))
+	}
+
+	// Trim the pool by a single byte, which should evict only the lowest fee
+	// set.
+	evicted, evictedSize := tpt.tpool.Trim(tpt.tpool.transactionListSize - 1)
+	if evicted != 1 || evictedSize == 0 {
+		t.Fatal("wrong eviction results:", evicted, evictedSize)
+	}
+	if _, _, exists := tpt.tpool.Transaction(sets[0][0].ID()); exists {
+		t.Fatal("lowest fee transaction was not evicted")
+	}
+	for _, set := range sets[1:] {
+		if _, _, exists := tpt.tpool.Transaction(set[0].ID()); !exists {
+			t.Fatal("higher fee transaction was evicted")
+		}
+	}
+
+	// Trim the pool to zero.
+	sizeBefore := tpt.tpool.transactionListSize
+	evicted, evictedSize = tpt.tpool.Trim(0)
+	if evicted != 2 || evictedSize != sizeBefore {
+		t.Fatal("wrong eviction results:", evicted, evictedSize)
+	}
+	if len(tpt.tpool.TransactionList()) != 0 || tpt.tpool.transactionListSize != 0 {
+		t.Fatal("transaction pool was not emptied")
+	}
+	if len(tpt.tpool.knownObjects) != 0 {
+		t.Fatal("known objects were not cleared")
+	}
+
+	// Trimming an empty pool should do nothing.
+	evicted, evictedSize = tpt.tpool.Trim(0)
+	if evicted != 0 || evictedSize != 0 {
+		t.Fatal("empty pool reported evictions")
+	}
+}
+
+// TestTrimPriority checks that Trim evicts transactions with a lower priority
+// before transactions with a higher priority, regardless of their fees.
+func TestTrimPriority(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	tpt, err := createTpoolTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tpt.Close()
+
+	// Create and confirm a transaction with several outputs that can be spent
+	// by independent transaction sets.
+	value := types.SiacoinPrecision.Mul64(100)
+	builder, err := tpt.wallet.StartTransaction()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = builder.FundSiacoins(value.Mul64(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		builder.AddSiacoinOutput(types.SiacoinOutput{
+			Value:      value,
+			UnlockHash: types.UnlockConditions{}.UnlockHash(),
+		})
+	}
+	txnSet, err := builder.Sign(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tpt.tpool.AcceptTransactionSet(txnSet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tpt.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Submit a high priority set with a low fee, a normal priority set with a
+	// medium fee, and a low priority set with a high fee.
+	prios := []Priority{PriorityHigh, PriorityNormal, PriorityLow}
+	var sets [][]types.Transaction
+	for i, prio := range prios {
+		fee := types.SiacoinPrecision.Mul64(uint64(i + 1))
+		graphTxns, err := types.TransactionGraph(txnSet[len(txnSet)-1].SiacoinOutputID(uint64(i)), []types.TransactionGraphEdge{{
+			Dest:   1,
+			Fee:    fee,
+			Source: 0,
+			Value:  value.Sub(fee),
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = tpt.tpool.AcceptTransactionSetWithPriority(graphTxns, prio)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sets = append(sets, graphTxns)
+	}
+
+	// Sets should be evicted in order of priority.
+	for i := len(sets) - 1; i >= 0; i-- {
+		evicted, _ := tpt.tpool.Trim(tpt.tpool.transactionListSize - 1)
+		if evicted != 1 {
+			t.Fatal("expected a single eviction, got", evicted)
+		}
+		if _, _, exists := tpt.tpool.Transaction(sets[i][0].ID()); exists {
+			t.Fatalf("set with priority %v was not evicted", prios[i])
+		}
+		for _, set := range sets[:i] {
+			if _, _, exists := tpt.tpool.Transaction(set[0].ID()); !exists {
+				t.Fatal("higher priority set was evicted")
+			}
+		}
+	}
+	if len(tpt.tpool.transactionPriorities) != 0 {
+		t.Fatal("priorities of evicted transactions were not cleared")
+	}
+}
+
+// TestTrimPinned checks that a pinned low fee transaction survives repeated
+// trimming of the pool, and that it can be evicted again once unpinned.
+func TestTrimPinned(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	tpt, err := createTpoolTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tpt.Close()
+
+	// Create and confirm a transaction with several outputs that can be spent
+	// by independent transaction sets.
+	value := types.SiacoinPrecision.Mul64(100)
+	numSets := 5
+	builder, err := tpt.wallet.StartTransaction()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = builder.FundSiacoins(value.Mul64(uint64(numSets)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < numSets; i++ {
+		builder.AddSiacoinOutput(types.SiacoinOutput{
+			Value:      value,
+			UnlockHash: types.UnlockConditions{}.UnlockHash(),
+		})
+	}
+	txnSet, err := builder.Sign(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tpt.tpool.AcceptTransactionSet(txnSet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tpt.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Submit sets of increasing fees. The first set pays the lowest fee and
+	// consists of a parent and a child, of which the child is pinned.
+	var pinned []types.Transaction
+	for i := 0; i < numSets; i++ {
+		fee := types.SiacoinPrecision.Mul64(uint64(i + 1))
+		edges := []types.TransactionGraphEdge{{Dest: 1, Fee: fee, Source: 0, Value: value.Sub(fee)}}
+		if i == 0 {
+			edges = append(edges, types.TransactionGraphEdge{Dest: 2, Fee: fee, Source: 1, Value: value.Sub(fee).Sub(fee)})
+		}
+		graphTxns, err := types.TransactionGraph(txnSet[len(txnSet)-1].SiacoinOutputID(uint64(i)), edges)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = tpt.tpool.AcceptTransactionSet(graphTxns)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			pinned = graphTxns
+		}
+	}
+
+	if err := tpt.tpool.Pin(types.TransactionID{}); err != errTransactionNotFound {
+		t.Fatal("expected errTransactionNotFound, got", err)
+	}
+	err = tpt.tpool.Pin(pinned[1].ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Trimming the pool repeatedly should evict every set except the pinned
+	// one, including the pinned transaction's parent.
+	for i := 0; i < numSets; i++ {
+		tpt.tpool.Trim(0)
+	}
+	if len(tpt.tpool.TransactionList()) != len(pinned) {
+		t.Fatal("expected only the pinned set to remain, got", len(tpt.tpool.TransactionList()))
+	}
+	for _, txn := range pinned {
+		if _, _, exists := tpt.tpool.Transaction(txn.ID()); !exists {
+			t.Fatal("pinned set was evicted")
+		}
+	}
+
+	// Once unpinned, the set can be evicted.
+	err = tpt.tpool.Unpin(pinned[1].ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if evicted, _ := tpt.tpool.Trim(0); evicted != len(pinned) {
+		t.Fatal("expected the unpinned set to be evicted, got", evicted)
+	}
+}
+
+// TestPurgePinned checks that pins do not outlive PurgeTransactionPool, so
+// that a purged transaction is not pinned when it is submitted again.
+func TestPurgePinned(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	tpt, err := createTpoolTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tpt.Close()
+
+	txn := types.Transaction{ArbitraryData: [][]byte{append(modules.PrefixNonSia[:], 1)}}
+	err = tpt.tpool.AcceptTransactionSet([]types.Transaction{txn})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tpt.tpool.Pin(txn.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpt.tpool.PurgeTransactionPool()
+	err = tpt.tpool.AcceptTransactionSet([]types.Transaction{txn})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tpt.tpool.setPinned([]types.Transaction{txn}) {
+		t.Fatal("purged transaction is still pinned after being submitted again")
+	}
+}
+
+// TestTrimAge checks that Trim evicts the newest of several transaction sets
+// that pay the same fee.
+func TestTrimAge(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	tpt, err := createTpoolTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tpt.Close()
+
+	// Create and confirm an output for each transaction set.
+	value := types.SiacoinPrecision.Mul64(100)
+	outputs := make([]types.SiacoinOutput, 3)
+	for i := range outputs {
+		outputs[i] = types.SiacoinOutput{Value: value, UnlockHash: types.UnlockConditions{}.UnlockHash()}
+	}
+	txns, err := tpt.wallet.SendSiacoinsMulti(outputs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tpt.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Submit a set spending each output, all paying the same fee, and give
+	// each set a distinct arrival time, the first set being the oldest.
+	fee := types.SiacoinPrecision
+	var sets [][]types.Transaction
+	parent := txns[len(txns)-1]
+	for i := range parent.SiacoinOutputs {
+		if parent.SiacoinOutputs[i].UnlockHash != (types.UnlockConditions{}).UnlockHash() {
+			continue
+		}
+		graphTxns, err := types.TransactionGraph(parent.SiacoinOutputID(uint64(i)), []types.TransactionGraphEdge{{
+			Dest:   1,
+			Fee:    fee,
+			Source: 0,
+			Value:  value.Sub(fee),
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = tpt.tpool.AcceptTransactionSet(graphTxns)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sets = append(sets, graphTxns)
+	}
+	if len(sets) != 3 {
+		t.Fatal("expected 3 transaction sets, got", len(sets))
+	}
+	now := time.Now()
+	for i, set := range sets {
+		tpt.tpool.transactionArrivals[set[0].ID()] = now.Add(time.Duration(i) * time.Minute)
+	}
+
+	// Each trim should evict the newest remaining set.
+	for i := len(sets) - 1; i >= 0; i-- {
+		evicted, _ := tpt.tpool.Trim(tpt.tpool.transactionListSize - 1)
+		if evicted != 1 {
+			t.Fatal("expected a single eviction, got", evicted)
+		}
+		if _, _, exists := tpt.tpool.Transaction(sets[i][0].ID()); exists {
+			t.Fatalf("set %v should have been evicted", i)
+		}
+		for _, set := range sets[:i] {
+			if _, _, exists := tpt.tpool.Transaction(set[0].ID()); !exists {
+				t.Fatal("an older set was evicted first")
+			}
+		}
+	}
+}
+
+// TestLowPriorityTransactions checks that LowPriorityTransactions returns the
+// transactions in the order in which Trim evicts them.
+func TestLowPriorityTransactions(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	tpt, err := createTpoolTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tpt.Close()
+
+	// Create and confirm an output for each transaction set.
+	value := types.SiacoinPrecision.Mul64(100)
+	outputs := make([]types.SiacoinOutput, 4)
+	for i := range outputs {
+		outputs[i] = types.SiacoinOutput{Value: value, UnlockHash: types.UnlockConditions{}.UnlockHash()}
+	}
+	txns, err := tpt.wallet.SendSiacoinsMulti(outputs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tpt.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Submit a set spending each output, each paying a different fee. The
+	// set paying the lowest fee is pinned.
+	fees := []uint64{1, 3, 2, 4}
+	var sets [][]types.Transaction
+	parent := txns[len(txns)-1]
+	for i := range parent.SiacoinOutputs {
+		if parent.SiacoinOutputs[i].UnlockHash != (types.UnlockConditions{}).UnlockHash() {
+			continue
+		}
+		fee := types.SiacoinPrecision.Mul64(fees[len(sets)])
+		graphTxns, err := types.TransactionGraph(parent.SiacoinOutputID(uint64(i)), []types.TransactionGraphEdge{{
+			Dest:   1,
+			Fee:    fee,
+			Source: 0,
+			Value:  value.Sub(fee),
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = tpt.tpool.AcceptTransactionSet(graphTxns)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sets = append(sets, graphTxns)
+	}
+	if len(sets) != len(fees) {
+		t.Fatalf("expected %v transaction sets, got %v", len(fees), len(sets))
+	}
+	err = tpt.tpool.Pin(sets[0][0].ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if txns := tpt.tpool.LowPriorityTransactions(0); len(txns) != 0 {
+		t.Fatal("expected no transactions, got", len(txns))
+	}
+	if txns := tpt.tpool.LowPriorityTransactions(10); len(txns) != len(sets)-1 {
+		t.Fatalf("expected %v transactions, got %v", len(sets)-1, len(txns))
+	}
+
+	// The returned transactions should match the order of eviction, and
+	// should not be removed from the pool.
+	low := tpt.tpool.LowPriorityTransactions(2)
+	if len(low) != 2 {
+		t.Fatal("expected 2 transactions, got", len(low))
+	}
+	if low[0].ID() != sets[2][0].ID() || low[1].ID() != sets[1][0].ID() {
+		t.Fatal("transactions were not returned lowest fee first")
+	}
+	for _, txn := range low {
+		evicted, _ := tpt.tpool.Trim(tpt.tpool.transactionListSize - 1)
+		if evicted != 1 {
+			t.Fatal("expected a single eviction, got", evicted)
+		}
+		if _, _, exists := tpt.tpool.Transaction(txn.ID()); exists {
+			t.Fatal("Trim did not evict the transactions in the returned order")
+		}
+	}
+}
+
+// TestZeroFee checks that a transaction set paying exactly zero fees is
+// accepted while the pool is small, is ordered after a set whose fee rounds
+// down to zero per byte, is evicted first, and is rejected once the pool
+// requires fees.
+func TestZeroFee(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	tpt, err := createTpoolTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tpt.Close()
+
+	value := types.SiacoinPrecision.Mul64(100)
+	outputs := make([]types.SiacoinOutput, 3)
+	for i := range outputs {
+		outputs[i] = types.SiacoinOutput{Value: value, UnlockHash: types.UnlockConditions{}.UnlockHash()}
+	}
+	txns, err := tpt.wallet.SendSiacoinsMulti(outputs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tpt.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parent := txns[len(txns)-1]
+	var sources []types.SiacoinOutputID
+	for i := range parent.SiacoinOutputs {
+		if parent.SiacoinOutputs[i].UnlockHash == (types.UnlockConditions{}).UnlockHash() {
+			sources = append(sources, parent.SiacoinOutputID(uint64(i)))
+		}
+	}
+	spend := func(source types.SiacoinOutputID, fee types.Currency) []types.Transaction {
+		graphTxns, err := types.TransactionGraph(source, []types.TransactionGraphEdge{{
+			Dest:   1,
+			Fee:    fee,
+			Source: 0,
+			Value:  value.Sub(fee),
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return graphTxns
+	}
+
+	// A set paying a single hasting has the same fee per byte as a set
+	// paying nothing, and arrives after it.
+	zero := spend(sources[0], types.ZeroCurrency)
+	tiny := spend(sources[1], types.NewCurrency64(1))
+	if !modules.CalculateFee(zero).IsZero() || !modules.CalculateFee(tiny).IsZero() {
+		t.Fatal("expected both sets to pay zero fees per byte")
+	}
+	for _, set := range [][]types.Transaction{zero, tiny} {
+		err = tpt.tpool.AcceptTransactionSet(set)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	now := time.Now()
+	tpt.tpool.transactionArrivals[zero[0].ID()] = now
+	tpt.tpool.transactionArrivals[tiny[0].ID()] = now.Add(time.Minute)
+
+	// The zero fee set is listed last and is the first eviction candidate.
+	list := tpt.tpool.TransactionList()
+	if list[len(list)-1].ID() != zero[0].ID() {
+		t.Fatal("zero fee transaction is not listed last")
+	}
+	snapshot := tpt.tpool.Freeze()
+	template := snapshot.BlockTemplate(types.BlockSizeLimit)
+	snapshot.Release()
+	if len(template) != 2 || template[0].ID() != tiny[0].ID() {
+		t.Fatal("zero fee transaction is not placed last in the block template")
+	}
+	low := tpt.tpool.LowPriorityTransactions(1)
+	if len(low) != 1 || low[0].ID() != zero[0].ID() {
+		t.Fatal("zero fee transaction is not the first eviction candidate")
+	}
+
+	// Once the pool is large enough to require fees, zero fee sets are
+	// rejected.
+	tpt.tpool.PurgeTransactionPool()
+	for i := 0; i < TransactionPoolSizeForFee/10e3; i++ {
+		arbData := make([]byte, 10e3)
+		copy(arbData, modules.PrefixNonSia[:])
+		fastrand.Read(arbData[100:116])
+		err := tpt.tpool.AcceptTransactionSet([]types.Transaction{{ArbitraryData: [][]byte{arbData}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = tpt.tpool.AcceptTransactionSet(spend(sources[2], types.ZeroCurrency))
+	if err != errLowMinerFees {
+		t.Fatal("expected errLowMinerFees, got", err)
+	}
+}
+
+// TestMaxPoolSize checks that a full pool evicts lower fee sets to make room
+// for a new set, and rejects sets that pay too little to displace any.
+func TestMaxPoolSize(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	tpt, err := createTpoolTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tpt.Close()
+
+	value := types.SiacoinPrecision.Mul64(100)
+	outputs := make([]types.SiacoinOutput, 4)
+	for i := range outputs {
+		outputs[i] = types.SiacoinOutput{Value: value, UnlockHash: types.UnlockConditions{}.UnlockHash()}
+	}
+	txns, err := tpt.wallet.SendSiacoinsMulti(outputs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tpt.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parent := txns[len(txns)-1]
+	var sources []types.SiacoinOutputID
+	for i := range parent.SiacoinOutputs {
+		if parent.SiacoinOutputs[i].UnlockHash == (types.UnlockConditions{}).UnlockHash() {
+			sources = append(sources, parent.SiacoinOutputID(uint64(i)))
+		}
+	}
+	spend := func(source types.SiacoinOutputID, fee uint64) []types.Transaction {
+		graphTxns, err := types.TransactionGraph(source, []types.TransactionGraphEdge{{
+			Dest:   1,
+			Fee:    types.SiacoinPrecision.Mul64(fee),
+			Source: 0,
+			Value:  value.Sub(types.SiacoinPrecision.Mul64(fee)),
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return graphTxns
+	}
+	low, mid, high, lowest := spend(sources[0], 10), spend(sources[1], 20), spend(sources[2], 30), spend(sources[3], 5)
+
+	// Limit the pool to the size of two sets.
+	settings, err := tpt.tpool.Settings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings.MaxPoolSize = 2*len(encoding.Marshal(low)) + 1
+	err = tpt.tpool.SetSettings(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, set := range [][]types.Transaction{low, mid} {
+		err = tpt.tpool.AcceptTransactionSet(set)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A higher fee set displaces the lowest fee set.
+	err = tpt.tpool.AcceptTransactionSet(high)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, exists := tpt.tpool.Transaction(low[0].ID()); exists {
+		t.Error("lowest fee set was not evicted")
+	}
+	for _, set := range [][]types.Transaction{mid, high} {
+		if _, _, exists := tpt.tpool.Transaction(set[0].ID()); !exists {
+			t.Error("higher fee set was evicted")
+		}
+	}
+	if size := tpt.tpool.transactionListSize; size > settings.MaxPoolSize {
+		t.Error("pool exceeds the size limit:", size)
+	}
+
+	// A set paying less than every set in the pool is rejected.
+	err = tpt.tpool.AcceptTransactionSet(lowest)
+	if err != errFullTransactionPool {
+		t.Fatal("expected errFullTransactionPool, got", err)
+	}
+	if len(tpt.tpool.TransactionList()) != 2 {
+		t.Error("rejected set changed the pool")
+	}
+}
+
+// TestMaxPoolSizePriority checks that a set is only admitted to a full pool if
+// the sets that are evicted for it, which are chosen by priority first, pay a
+// lower fee than the set.
+func TestMaxPoolSizePriority(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	tpt, err := createTpoolTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tpt.Close()
+
+	value := types.SiacoinPrecision.Mul64(100)
+	outputs := make([]types.SiacoinOutput, 3)
+	for i := range outputs {
+		outputs[i] = types.SiacoinOutput{Value: value, UnlockHash: types.UnlockConditions{}.UnlockHash()}
+	}
+	txns, err := tpt.wallet.SendSiacoinsMulti(outputs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tpt.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parent := txns[len(txns)-1]
+	var sources []types.SiacoinOutputID
+	for i := range parent.SiacoinOutputs {
+		if parent.SiacoinOutputs[i].UnlockHash == (types.UnlockConditions{}).UnlockHash() {
+			sources = append(sources, parent.SiacoinOutputID(uint64(i)))
+		}
+	}
+	spend := func(source types.SiacoinOutputID, fee uint64) []types.Transaction {
+		graphTxns, err := types.TransactionGraph(source, []types.TransactionGraphEdge{{
+			Dest:   1,
+			Fee:    types.SiacoinPrecision.Mul64(fee),
+			Source: 0,
+			Value:  value.Sub(types.SiacoinPrecision.Mul64(fee)),
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return graphTxns
+	}
+	important, normal, newcomer := spend(sources[0], 10), spend(sources[1], 30), spend(sources[2], 20)
+
+	// Fill a pool limited to the size of two sets with a high priority set
+	// paying a low fee and a normal priority set paying a high fee.
+	settings, err := tpt.tpool.Settings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings.MaxPoolSize = 2*len(encoding.Marshal(important)) + 1
+	err = tpt.tpool.SetSettings(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tpt.tpool.AcceptTransactionSetWithPriority(important, PriorityHigh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tpt.tpool.AcceptTransactionSet(normal)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Making room for the new set would evict the normal priority set, which
+	// pays more than the new set, so the new set is rejected.
+	err = tpt.tpool.AcceptTransactionSet(newcomer)
+	if err != errFullTransactionPool {
+		t.Fatal("expected errFullTransactionPool, got", err)
+	}
+	for _, set := range [][]types.Transaction{important, normal} {
+		if _, _, exists := tpt.tpool.Transaction(set[0].ID()); !exists {
+			t.Error("rejected set evicted a set from the pool")
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package transactionpool
+
+import (
+	"sort"
+	"time"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+
+	"github.com/NebulousLabs/errors"
+)
+
+var (
+	errFullPendingReplacements = errors.New("transaction pool cannot hold more pending replacements")
+	errReplacementPending      = errors.New("transaction set will replace the transaction sets it conflicts with once the conflict grace period has passed")
+)
+
+type (
+	// pendingReplacement is a transaction set that outbids the transaction
+	// sets it conflicts with, and that is waiting for the conflict grace
+	// period to pass before replacing them.
+	pendingReplacement struct {
+		deadline time.Time
+		size     int
+		set      []types.Transaction
+	}
+)
+
+// holdReplacement stores a transaction set that would replace the provided
+// conflicting sets, giving the submitters of the conflicting sets until the
+// end of the conflict grace period to improve them.
+func (tp *TransactionPool) holdReplacement(ts []types.Transaction, conflicts []TransactionSetID, txnFn func([]types.Transaction) (modules.ConsensusChange, error)) error {
+	if tp.exceedsReplacementLimit(ts, conflicts) {
+		return modules.ErrTooManyReplacements
+	}
+	_, err := tp.validate(ts, txnFn)
+	if err != nil {
+		return modules.NewConsensusConflict("provided transaction set conflicts with the transaction pool and is invalid on its own: " + err.Error())
+	}
+	if transactionSetFees(ts).Cmp(tp.minReplacementFee(tp.replacedTransactions(ts, conflicts))) < 0 {
+		return errLowReplacementFees
+	}
+	setID := TransactionSetID(crypto.HashObject(ts))
+	if _, exists := tp.pendingReplacements[setID]; exists {
+		return modules.ErrDuplicateTransactionSet
+	}
+	setSize := len(encoding.Marshal(ts))
+	if tp.pendingReplacementsSize+setSize > maxPendingReplacementsSize {
+		return errFullPendingReplacements
+	}
+	tp.pendingReplacements[setID] = pendingReplacement{
+		deadline: time.Now().Add(tp.conflictGracePeriod),
+		size:     setSize,
+		set:      ts,
+	}
+	tp.pendingReplacementsSize += setSize
+	time.AfterFunc(tp.conflictGracePeriod, tp.managedPromotePendingReplacements)
+	return errReplacementPending
+}
+
+// promotePendingReplacements submits all of the pending replacements whose
+// grace period has passed. The replacements are submitted through
+// acceptTransactionSet and checked against the current state of the pool, so
+// a replacement is discarded if the sets it conflicts with were improved
+// during the grace period, or if it no longer fits the limits of the pool.
+// Replacements paying higher fees are submitted first.
+func (tp *TransactionPool) promotePendingReplacements(txnFn func([]types.Transaction) (modules.ConsensusChange, error), now time.Time) {
+	var due [][]types.Transaction
+	for setID, pr := range tp.pendingReplacements {
+		if pr.deadline.After(now) {
+			continue
+		}
+		delete(tp.pendingReplacements, setID)
+		tp.pendingReplacementsSize -= pr.size
+		due = append(due, pr.set)
+	}
+	sort.Slice(due, func(i, j int) bool {
+		return transactionSetFees(due[i]).Cmp(transactionSetFees(due[j])) > 0
+	})
+
+	// The grace period of the due replacements has passed, so they are not
+	// held again while they are submitted.
+	gracePeriod := tp.conflictGracePeriod
+	tp.conflictGracePeriod = 0
+	defer func() {
+		tp.conflictGracePeriod = gracePeriod
+	}()
+	for _, ts := range due {
+		err := tp.acceptTransactionSet(ts, txnFn)
+		if IsHeld(err) {
+			tp.log.Debugln("Pending replacement is being held:", err)
+			tp.metrics.addHeld(ts)
+			continue
+		} else if err != nil {
+			tp.log.Debugln("Pending replacement was discarded:", err)
+			for _, txn := range ts {
+				id, fee, size := transactionEvent(txn)
+				tp.events.LogReject(id, fee, size, err)
+			}
+			continue
+		}
+		tp.setOrigin(ts, OriginHeld)
+		for _, txn := range ts {
+			tp.events.LogAccept(transactionEvent(txn))
+		}
+		go tp.gateway.Broadcast("RelayTransactionSet", ts, tp.gateway.Peers())
+	}
+}
+
+// managedPromotePendingReplacements submits all of the pending replacements
+// whose grace period has passed, and notifies subscribers of the resulting
+// changes to the pool.
+func (tp *TransactionPool) managedPromotePendingReplacements() {
+	if err := tp.tg.Add(); err != nil {
+		return
+	}
+	defer tp.tg.Done()
+
+	// assert on consensus set to get special method
+	cs, ok := tp.consensusSet.(interface {
+		LockedTryTransactionSet(fn func(func(txns []types.Transaction) (modules.ConsensusChange, error)) error) error
+	})
+	if !ok {
+		return
+	}
+	cs.LockedTryTransactionSet(func(txnFn func(txns []types.Transaction) (modules.ConsensusChange, error)) error {
+		tp.mu.Lock()
+		defer tp.mu.Unlock()
+		tp.promotePendingReplacements(txnFn, time.Now())
+		tp.updateSubscribersTransactions()
+		return nil
+	})
+}
@@ -0,0 +1,161 @@
+package transactionpool
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestConflictGracePeriod checks that a replacement is held for the conflict
+// grace period, and that it replaces the conflicting set once the grace period
+// has passed.
+func TestConflictGracePeriod(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	tpt, err := createTpoolTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tpt.Close()
+
+	txns, err := tpt.wallet.SendSiacoins(types.SiacoinPrecision.Mul64(100), types.UnlockConditions{}.UnlockHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := txns[len(txns)-1].SiacoinOutputID(0)
+	_, err = tpt.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	incumbent, err := types.TransactionGraph(source, []types.TransactionGraphEdge{
+		{Dest: 1, Fee: types.SiacoinPrecision.Mul64(10), Source: 0, Value: types.SiacoinPrecision.Mul64(90)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	replacement, err := types.TransactionGraph(source, []types.TransactionGraphEdge{
+		{Dest: 1, Fee: types.SiacoinPrecision.Mul64(20), Source: 0, Value: types.SiacoinPrecision.Mul64(80)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tpt.tpool.AcceptTransactionSet(incumbent)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gracePeriod := 500 * time.Millisecond
+	err = tpt.tpool.SetSettings(modules.TransactionPoolSettings{
+		ConflictGracePeriod:        gracePeriod,
+		ReplaceConflictingPackages: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The replacement should be held, leaving the incumbent in the pool.
+	err = tpt.tpool.AcceptTransactionSet(replacement)
+	if err != errReplacementPending {
+		t.Fatal("expected errReplacementPending, got", err)
+	}
+	if _, _, exists := tpt.tpool.Transaction(incumbent[0].ID()); !exists {
+		t.Fatal("incumbent was evicted during the grace period")
+	}
+	if _, _, exists := tpt.tpool.Transaction(replacement[0].ID()); exists {
+		t.Fatal("replacement was added during the grace period")
+	}
+
+	// Once the grace period has passed, the replacement should take over.
+	time.Sleep(gracePeriod)
+	err = build.Retry(50, 100*time.Millisecond, func() error {
+		if _, _, exists := tpt.tpool.Transaction(replacement[0].ID()); !exists {
+			return errors.New("replacement has not been promoted")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, exists := tpt.tpool.Transaction(incumbent[0].ID()); exists {
+		t.Fatal("incumbent is still in the pool")
+	}
+	if len(tpt.tpool.pendingReplacements) != 0 || tpt.tpool.pendingReplacementsSize != 0 {
+		t.Fatal("pending replacement was not cleared")
+	}
+}
+
+// TestPendingReplacementLimits checks that a pending replacement is discarded
+// if it no longer fits the limits of the pool once its grace period has
+// passed.
+func TestPendingReplacementLimits(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	tpt, err := createTpoolTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tpt.Close()
+
+	source, err := tpt.graphSource(types.SiacoinPrecision.Mul64(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	incumbent, err := types.TransactionGraph(source, []types.TransactionGraphEdge{
+		{Dest: 1, Fee: types.SiacoinPrecision.Mul64(10), Source: 0, Value: types.SiacoinPrecision.Mul64(90)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	replacement, err := types.TransactionGraph(source, []types.TransactionGraphEdge{
+		{Dest: 1, Fee: types.SiacoinPrecision.Mul64(20), Source: 0, Value: types.SiacoinPrecision.Mul64(80)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tpt.tpool.AcceptTransactionSet(incumbent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings := modules.TransactionPoolSettings{
+		ConflictGracePeriod:        time.Hour,
+		ReplaceConflictingPackages: true,
+	}
+	err = tpt.tpool.SetSettings(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tpt.tpool.AcceptTransactionSet(replacement)
+	if err != errReplacementPending {
+		t.Fatal("expected errReplacementPending, got", err)
+	}
+
+	// Lower the pending value limit so that the replacement no longer fits
+	// next to the incumbent, and promote it.
+	settings.MaxPendingValue = types.SiacoinPrecision.Mul64(100)
+	err = tpt.tpool.SetSettings(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpt.tpool.mu.Lock()
+	tpt.tpool.promotePendingReplacements(tpt.cs.TryTransactionSet, time.Now().Add(2*time.Hour))
+	tpt.tpool.mu.Unlock()
+	if _, _, exists := tpt.tpool.Transaction(replacement[0].ID()); exists {
+		t.Fatal("replacement exceeding MaxPendingValue was promoted")
+	}
+	if _, _, exists := tpt.tpool.Transaction(incumbent[0].ID()); !exists {
+		t.Fatal("incumbent was evicted")
+	}
+	if len(tpt.tpool.pendingReplacements) != 0 {
+		t.Fatal("pending replacement was not cleared")
+	}
+	if tpt.tpool.conflictGracePeriod != time.Hour {
+		t.Fatal("conflict grace period was not restored")
+	}
+}
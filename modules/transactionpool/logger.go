@@ -0,0 +1,64 @@
+package transactionpool
+
+import (
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+type (
+	// A Logger receives structured events from the transaction pool. Events
+	// are delivered while the transaction pool is locked, so a Logger must not
+	// call back into the transaction pool.
+	Logger interface {
+		// LogAccept is called for each transaction of a set that is accepted
+		// into the transaction pool.
+		LogAccept(id types.TransactionID, fee types.Currency, size int)
+
+		// LogReject is called for each transaction of a set that is rejected
+		// by the transaction pool, along with the reason for the rejection.
+		// Sets that are held by the transaction pool are not rejected.
+		LogReject(id types.TransactionID, fee types.Currency, size int, reason error)
+
+		// LogEvict is called for each transaction that is removed from the
+		// transaction pool without being confirmed.
+		LogEvict(id types.TransactionID, fee types.Currency, size int)
+
+		// LogReorg is called for each transaction of a reverted block that is
+		// returned to the transaction pool.
+		LogReorg(id types.TransactionID, fee types.Currency, size int)
+	}
+
+	// noopLogger is the Logger used by the transaction pool until SetLogger is
+	// called. It discards all events.
+	noopLogger struct{}
+)
+
+// LogAccept implements Logger.
+func (noopLogger) LogAccept(types.TransactionID, types.Currency, int) {}
+
+// LogReject implements Logger.
+func (noopLogger) LogReject(types.TransactionID, types.Currency, int, error) {}
+
+// LogEvict implements Logger.
+func (noopLogger) LogEvict(types.TransactionID, types.Currency, int) {}
+
+// LogReorg implements Logger.
+func (noopLogger) LogReorg(types.TransactionID, types.Currency, int) {}
+
+// transactionEvent returns the fields that are provided to a Logger for a
+// transaction.
+func transactionEvent(txn types.Transaction) (types.TransactionID, types.Currency, int) {
+	return txn.ID(), transactionSetFees([]types.Transaction{txn}), len(encoding.Marshal(txn))
+}
+
+// SetLogger sets the Logger that receives structured events from the
+// transaction pool. Passing nil restores the default Logger, which discards
+// all events. Events are counted for Metrics regardless of the Logger.
+func (tp *TransactionPool) SetLogger(l Logger) {
+	if l == nil {
+		l = noopLogger{}
+	}
+	tp.mu.Lock()
+	tp.events = teeLogger{tp.metrics, l}
+	tp.mu.Unlock()
+}
@@ -0,0 +1,96 @@
+package transactionpool
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// recordingLogger is a Logger that records the ids of the transactions it
+// receives events for.
+type recordingLogger struct {
+	accepted []types.TransactionID
+	rejected []types.TransactionID
+	evicted  []types.TransactionID
+	reorged  []types.TransactionID
+	reasons  []error
+	fees     []types.Currency
+}
+
+func (rl *recordingLogger) LogAccept(id types.TransactionID, fee types.Currency, _ int) {
+	rl.accepted = append(rl.accepted, id)
+	rl.fees = append(rl.fees, fee)
+}
+func (rl *recordingLogger) LogReject(id types.TransactionID, _ types.Currency, _ int, reason error) {
+	rl.rejected = append(rl.rejected, id)
+	rl.reasons = append(rl.reasons, reason)
+}
+func (rl *recordingLogger) LogEvict(id types.TransactionID, _ types.Currency, _ int) {
+	rl.evicted = append(rl.evicted, id)
+}
+func (rl *recordingLogger) LogReorg(id types.TransactionID, _ types.Currency, _ int) {
+	rl.reorged = append(rl.reorged, id)
+}
+
+// TestLogger checks that a Logger set on the transaction pool receives events
+// when transactions are accepted, rejected, and evicted.
+func TestLogger(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	tpt, err := createTpoolTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tpt.Close()
+
+	// Create a transaction sending money to an output that TransactionGraph can
+	// spend, and confirm it.
+	txns, err := tpt.wallet.SendSiacoins(types.SiacoinPrecision.Mul64(100), types.UnlockConditions{}.UnlockHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tpt.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rl := new(recordingLogger)
+	tpt.tpool.SetLogger(rl)
+
+	graphTxns, err := types.TransactionGraph(txns[len(txns)-1].SiacoinOutputID(0), []types.TransactionGraphEdge{{
+		Dest:   1,
+		Fee:    types.SiacoinPrecision.Mul64(10),
+		Source: 0,
+		Value:  types.SiacoinPrecision.Mul64(90),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := graphTxns[0].ID()
+	err = tpt.tpool.AcceptTransactionSet(graphTxns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rl.accepted) != 1 || rl.accepted[0] != id {
+		t.Fatal("accept was not logged:", rl.accepted)
+	}
+	if !rl.fees[0].Equals(types.SiacoinPrecision.Mul64(10)) {
+		t.Fatal("wrong fee was logged:", rl.fees[0])
+	}
+
+	// Submitting the same set again should be logged as a rejection.
+	err = tpt.tpool.AcceptTransactionSet(graphTxns)
+	if err != modules.ErrDuplicateTransactionSet {
+		t.Fatal("expected ErrDuplicateTransactionSet, got", err)
+	}
+	if len(rl.rejected) != 1 || rl.rejected[0] != id || rl.reasons[0] != modules.ErrDuplicateTransactionSet {
+		t.Fatal("reject was not logged:", rl.rejected, rl.reasons)
+	}
+
+	// Trimming the pool should be logged as an eviction.
+	tpt.tpool.Trim(0)
+	if len(rl.evicted) != 1 || rl.evicted[0] != id {
+		t.Fatal("eviction was not logged:", rl.evicted)
+	}
+}
@@ -0,0 +1,171 @@
+package transactionpool
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+type (
+	// Metrics contains cumulative counters of the events that have occurred
+	// in the transaction pool since it was created, along with gauges of its
+	// current contents. Unlike Stats, which breaks down the current contents
+	// of the pool, Metrics is shaped to be exported to monitoring systems
+	// such as Prometheus.
+	Metrics struct {
+		// Counters, each counting individual transactions.
+		Accepted uint64
+		Evicted  uint64
+		Reorged  uint64
+
+		// Held counts the transactions of sets that were held instead of
+		// being added to the pool, for example because they are orphans or
+		// timelocked. Held sets are not counted as rejected.
+		Held uint64
+
+		// Rejected counts the rejected transactions by the reason for their
+		// rejection. All consensus conflicts share a single reason, since
+		// their messages contain transaction specific details.
+		Rejected map[string]uint64
+
+		// Replacements counts the number of times that transaction sets were
+		// replaced by a conflicting set or file contract revision.
+		Replacements uint64
+
+		// Gauges.
+		Size         int
+		Transactions int
+		OrphanSets   int
+	}
+
+	// poolMetrics is a Logger that maintains the counters of Metrics. It is
+	// always attached to the transaction pool, in addition to any Logger set
+	// with SetLogger.
+	poolMetrics struct {
+		accepted     uint64
+		evicted      uint64
+		held         uint64
+		reorged      uint64
+		replacements uint64
+
+		mu       sync.Mutex
+		rejected map[string]uint64
+	}
+
+	// teeLogger delivers every event to two Loggers.
+	teeLogger struct {
+		first, second Logger
+	}
+)
+
+// newPoolMetrics returns a poolMetrics with all counters set to zero.
+func newPoolMetrics() *poolMetrics {
+	return &poolMetrics{
+		rejected: make(map[string]uint64),
+	}
+}
+
+// IsHeld returns true if the error returned when submitting a transaction set
+// reports that the set is being held by the transaction pool rather than
+// rejected. A held set is not in the unconfirmed set yet, but is submitted
+// again by the transaction pool once the reason for holding it goes away.
+func IsHeld(err error) bool {
+	switch err {
+	case errOrphanSetHeld, errProofSetHeld, errReplacementPending, errTimelockedSetHeld, errUnsyncedSetHeld:
+		return true
+	}
+	return false
+}
+
+// rejectReason returns the key under which a rejection is counted.
+func rejectReason(err error) string {
+	if _, ok := err.(modules.ConsensusConflict); ok {
+		return "consensus conflict"
+	}
+	return err.Error()
+}
+
+// LogAccept implements Logger.
+func (pm *poolMetrics) LogAccept(types.TransactionID, types.Currency, int) {
+	atomic.AddUint64(&pm.accepted, 1)
+}
+
+// LogReject implements Logger.
+func (pm *poolMetrics) LogReject(_ types.TransactionID, _ types.Currency, _ int, reason error) {
+	pm.mu.Lock()
+	pm.rejected[rejectReason(reason)]++
+	pm.mu.Unlock()
+}
+
+// LogEvict implements Logger.
+func (pm *poolMetrics) LogEvict(types.TransactionID, types.Currency, int) {
+	atomic.AddUint64(&pm.evicted, 1)
+}
+
+// LogReorg implements Logger.
+func (pm *poolMetrics) LogReorg(types.TransactionID, types.Currency, int) {
+	atomic.AddUint64(&pm.reorged, 1)
+}
+
+// addHeld counts the transactions of a held transaction set.
+func (pm *poolMetrics) addHeld(ts []types.Transaction) {
+	atomic.AddUint64(&pm.held, uint64(len(ts)))
+}
+
+// addReplacement counts a replacement of transaction sets.
+func (pm *poolMetrics) addReplacement() {
+	atomic.AddUint64(&pm.replacements, 1)
+}
+
+// LogAccept implements Logger.
+func (tl teeLogger) LogAccept(id types.TransactionID, fee types.Currency, size int) {
+	tl.first.LogAccept(id, fee, size)
+	tl.second.LogAccept(id, fee, size)
+}
+
+// LogReject implements Logger.
+func (tl teeLogger) LogReject(id types.TransactionID, fee types.Currency, size int, reason error) {
+	tl.first.LogReject(id, fee, size, reason)
+	tl.second.LogReject(id, fee, size, reason)
+}
+
+// LogEvict implements Logger.
+func (tl teeLogger) LogEvict(id types.TransactionID, fee types.Currency, size int) {
+	tl.first.LogEvict(id, fee, size)
+	tl.second.LogEvict(id, fee, size)
+}
+
+// LogReorg implements Logger.
+func (tl teeLogger) LogReorg(id types.TransactionID, fee types.Currency, size int) {
+	tl.first.LogReorg(id, fee, size)
+	tl.second.LogReorg(id, fee, size)
+}
+
+// Metrics returns the cumulative counters and current gauges of the
+// transaction pool.
+func (tp *TransactionPool) Metrics() Metrics {
+	m := Metrics{
+		Accepted:     atomic.LoadUint64(&tp.metrics.accepted),
+		Evicted:      atomic.LoadUint64(&tp.metrics.evicted),
+		Held:         atomic.LoadUint64(&tp.metrics.held),
+		Reorged:      atomic.LoadUint64(&tp.metrics.reorged),
+		Replacements: atomic.LoadUint64(&tp.metrics.replacements),
+		Rejected:     make(map[string]uint64),
+	}
+	tp.metrics.mu.Lock()
+	for reason, n := range tp.metrics.rejected {
+		m.Rejected[reason] = n
+	}
+	tp.metrics.mu.Unlock()
+
+	tp.mu.RLock()
+	defer tp.mu.RUnlock()
+	m.Size = tp.transactionListSize
+	for _, tSet := range tp.transactionSets {
+		m.Transactions += len(tSet)
+	}
+	m.OrphanSets = len(tp.orphanSets)
+	return m
+}
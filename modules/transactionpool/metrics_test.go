@@ -0,0 +1,102 @@
+package transactionpool
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestMetrics checks that the counters and gauges of Metrics move as
+// transactions are accepted, rejected, replaced, and evicted.
+func TestMetrics(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	tpt, err := createTpoolTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tpt.Close()
+
+	// Setting a Logger should not stop the metrics from being counted.
+	tpt.tpool.SetLogger(nil)
+	if m := tpt.tpool.Metrics(); m.Accepted != 0 || m.Transactions != 0 || m.Size != 0 {
+		t.Fatal("new pool has non-zero metrics:", m)
+	}
+
+	txns, err := tpt.wallet.SendSiacoins(types.SiacoinPrecision.Mul64(100), types.UnlockConditions{}.UnlockHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := txns[len(txns)-1].SiacoinOutputID(0)
+	m := tpt.tpool.Metrics()
+	if m.Accepted != uint64(len(txns)) || m.Transactions != len(txns) || m.Size != tpt.tpool.transactionListSize {
+		t.Fatal("metrics do not reflect the accepted transactions:", m)
+	}
+	_, err = tpt.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	spend := func(fee uint64) []types.Transaction {
+		graph, err := types.TransactionGraph(source, []types.TransactionGraphEdge{
+			{Dest: 1, Fee: types.SiacoinPrecision.Mul64(fee), Source: 0, Value: types.SiacoinPrecision.Mul64(100 - fee)},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return graph
+	}
+	err = tpt.tpool.AcceptTransactionSet(spend(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A double spend should be counted as a consensus conflict.
+	err = tpt.tpool.AcceptTransactionSet(spend(20))
+	if _, ok := err.(modules.ConsensusConflict); !ok {
+		t.Fatal("expected a consensus conflict, got", err)
+	}
+	if m := tpt.tpool.Metrics(); m.Rejected["consensus conflict"] != 1 {
+		t.Fatal("rejection was not counted:", m.Rejected)
+	}
+
+	// A replacement should count the replacement and the eviction.
+	err = tpt.tpool.SetSettings(modules.TransactionPoolSettings{ReplaceConflictingPackages: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tpt.tpool.AcceptTransactionSet(spend(30))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m := tpt.tpool.Metrics(); m.Replacements != 1 || m.Evicted != 1 || m.Transactions != 1 {
+		t.Fatal("replacement was not counted:", m)
+	}
+
+	// Trimming the pool should count another eviction.
+	tpt.tpool.Trim(0)
+	if m := tpt.tpool.Metrics(); m.Evicted != 2 || m.Transactions != 0 || m.Size != 0 {
+		t.Fatal("trim was not counted:", m)
+	}
+
+	// A held orphan should be counted as held rather than rejected.
+	err = tpt.tpool.SetSettings(modules.TransactionPoolSettings{HoldOrphanSets: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	orphan, err := types.TransactionGraph(types.SiacoinOutputID{1}, []types.TransactionGraphEdge{
+		{Dest: 1, Fee: types.SiacoinPrecision.Mul64(10), Source: 0, Value: types.SiacoinPrecision.Mul64(90)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tpt.tpool.AcceptTransactionSet(orphan)
+	if err != errOrphanSetHeld {
+		t.Fatal("expected errOrphanSetHeld, got", err)
+	}
+	if m := tpt.tpool.Metrics(); m.Held != 1 || len(m.Rejected) != 1 || m.Rejected["consensus conflict"] != 1 {
+		t.Fatal("held orphan was not counted as held:", m.Held, m.Rejected)
+	}
+}
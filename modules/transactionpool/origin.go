@@ -0,0 +1,52 @@
+package transactionpool
+
+import (
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// An Origin describes how a transaction entered the transaction pool.
+type Origin int
+
+const (
+	// OriginLocal marks transactions that were submitted through
+	// AcceptTransactionSet, usually by the node itself.
+	OriginLocal Origin = iota
+	// OriginNetwork marks transactions that were relayed by a peer.
+	OriginNetwork
+	// OriginReorg marks transactions that were confirmed in a block which was
+	// later reverted.
+	OriginReorg
+	// OriginOrphan marks transactions that were held until their missing
+	// parents appeared.
+	OriginOrphan
+	// OriginHeld marks transactions that were held until their timelocks
+	// expired, or until the conflict grace period of a replacement passed.
+	OriginHeld
+	// OriginDisk marks transactions that were loaded from the pool file.
+	OriginDisk
+)
+
+// setOrigin records the origin of every transaction in a set. Transactions
+// that are already in the pool keep their original origin, so re-adding the
+// unconfirmed set after a consensus change does not affect it.
+func (tp *TransactionPool) setOrigin(ts []types.Transaction, origin Origin) {
+	for _, txn := range ts {
+		if _, exists := tp.transactionOrigins[txn.ID()]; !exists {
+			tp.transactionOrigins[txn.ID()] = origin
+		}
+	}
+}
+
+// Origin returns how the transaction with the provided id entered the
+// transaction pool, and a bool indicating whether the transaction is in the
+// pool.
+func (tp *TransactionPool) Origin(id types.TransactionID) (Origin, bool) {
+	if err := tp.tg.Add(); err != nil {
+		return 0, false
+	}
+	defer tp.tg.Done()
+	tp.mu.RLock()
+	defer tp.mu.RUnlock()
+	origin, exists := tp.transactionOrigins[id]
+	return origin, exists
+}
@@ -0,0 +1,168 @@
+package transactionpool
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestOrigin checks that each path into the transaction pool records the
+// origin of the transactions it adds.
+func TestOrigin(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	tpt, err := createTpoolTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tpt.Close()
+	err = tpt.tpool.SetSettings(modules.TransactionPoolSettings{HoldOrphanSets: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkOrigin := func(txn types.Transaction, expected Origin) {
+		t.Helper()
+		origin, exists := tpt.tpool.Origin(txn.ID())
+		if !exists {
+			t.Fatal("transaction has no origin")
+		} else if origin != expected {
+			t.Fatalf("expected origin %v, got %v", expected, origin)
+		}
+	}
+
+	// Local submission.
+	local := types.Transaction{ArbitraryData: [][]byte{append(modules.PrefixNonSia[:], 1)}}
+	err = tpt.tpool.AcceptTransactionSet([]types.Transaction{local})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkOrigin(local, OriginLocal)
+
+	// Network relay.
+	relayed := types.Transaction{ArbitraryData: [][]byte{append(modules.PrefixNonSia[:], 2)}}
+	err = tpt.tpool.AcceptTransactionSetFrom("peer", []types.Transaction{relayed})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkOrigin(relayed, OriginNetwork)
+
+	// Disk load, through WarmUp.
+	loaded := types.Transaction{ArbitraryData: [][]byte{append(modules.PrefixNonSia[:], 3)}}
+	failures, err := tpt.tpool.WarmUp([]types.Transaction{loaded})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range failures {
+		t.Fatal("valid transaction failed verification")
+	}
+	checkOrigin(loaded, OriginDisk)
+
+	// Orphan promotion.
+	txns, err := tpt.wallet.SendSiacoins(types.SiacoinPrecision.Mul64(100), types.UnlockConditions{}.UnlockHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tpt.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	graph, err := types.TransactionGraph(txns[len(txns)-1].SiacoinOutputID(0), []types.TransactionGraphEdge{
+		{Dest: 1, Fee: types.SiacoinPrecision.Mul64(10), Source: 0, Value: types.SiacoinPrecision.Mul64(90)},
+		{Dest: 2, Fee: types.SiacoinPrecision.Mul64(10), Source: 1, Value: types.SiacoinPrecision.Mul64(80)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tpt.tpool.AcceptTransactionSet(graph[1:])
+	if err != errOrphanSetHeld {
+		t.Fatal("expected errOrphanSetHeld, got", err)
+	}
+	err = tpt.tpool.AcceptTransactionSet(graph[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkOrigin(graph[0], OriginLocal)
+	checkOrigin(graph[1], OriginOrphan)
+
+	// Reorg. The anyone-can-spend siafund output of the genesis block exists
+	// on every chain, so a transaction spending it survives a reorg.
+	genesisTxn := types.GenesisBlock.Transactions[0]
+	sfTxn := types.Transaction{
+		SiafundInputs: []types.SiafundInput{{
+			ParentID:         genesisTxn.SiafundOutputID(2),
+			UnlockConditions: types.UnlockConditions{},
+		}},
+		SiafundOutputs: []types.SiafundOutput{{
+			Value:      genesisTxn.SiafundOutputs[2].Value,
+			UnlockHash: types.UnlockHash{1},
+		}},
+	}
+	err = tpt.tpool.AcceptTransactionSet([]types.Transaction{sfTxn})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tpt.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, exists := tpt.tpool.Origin(sfTxn.ID()); exists {
+		t.Fatal("confirmed transaction still has an origin")
+	}
+
+	// Build a longer chain without the transaction, and feed it to the
+	// tester.
+	fork, err := blankTpoolTester(t.Name() + "-fork")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fork.Close()
+	for fork.cs.Height() <= tpt.cs.Height() {
+		_, err = fork.miner.AddBlock()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for h := types.BlockHeight(1); h <= fork.cs.Height(); h++ {
+		block, _ := fork.cs.BlockAtHeight(h)
+		err = tpt.cs.AcceptBlock(block)
+		if err != nil && err != modules.ErrNonExtendingBlock {
+			t.Fatal(err)
+		}
+	}
+	if tpt.cs.CurrentBlock().ID() != fork.cs.CurrentBlock().ID() {
+		t.Fatal("tester did not reorg to the longer chain")
+	}
+	checkOrigin(sfTxn, OriginReorg)
+}
+
+// TestPurgeOrigin checks that purging the transaction pool forgets the origins
+// of the purged transactions.
+func TestPurgeOrigin(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	tpt, err := createTpoolTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tpt.Close()
+
+	txn := types.Transaction{ArbitraryData: [][]byte{append(modules.PrefixNonSia[:], 1)}}
+	err = tpt.tpool.AcceptTransactionSetWithPriority([]types.Transaction{txn}, PriorityHigh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, exists := tpt.tpool.Origin(txn.ID()); !exists {
+		t.Fatal("accepted transaction has no origin")
+	}
+	tpt.tpool.PurgeTransactionPool()
+	if _, exists := tpt.tpool.Origin(txn.ID()); exists {
+		t.Error("purged transaction still has an origin")
+	}
+	tp := tpt.tpool
+	if len(tp.transactionArrivals) != 0 || len(tp.transactionHeights) != 0 || len(tp.transactionOrigins) != 0 || len(tp.transactionSources) != 0 || len(tp.transactionPriorities) != 0 {
+		t.Error("metadata of the purged transactions was kept")
+	}
+}
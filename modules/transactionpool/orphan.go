@@ -0,0 +1,202 @@
+package transactionpool
+
+import (
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+
+	"github.com/NebulousLabs/errors"
+)
+
+var (
+	errFullOrphanSets = errors.New("transaction pool cannot hold more orphan transaction sets")
+	errOrphanSetHeld  = errors.New("transaction set depends on outputs or file contracts that do not exist yet and will be submitted once they appear")
+)
+
+type (
+	// orphanSet is a transaction set that spends outputs, or revises or proves
+	// file contracts, which are not known to the consensus set or the
+	// transaction pool yet. It is held until its missing parents appear.
+	orphanSet struct {
+		height types.BlockHeight
+		size   int
+		set    []types.Transaction
+	}
+)
+
+// orphanParentIDs returns the ids of the objects that the transaction set
+// spends, revises, or proves, and that it does not create itself.
+func orphanParentIDs(ts []types.Transaction) []ObjectID {
+	created := make(map[ObjectID]struct{})
+	for _, txn := range ts {
+		for _, oid := range createdObjectIDs(txn) {
+			created[oid] = struct{}{}
+		}
+	}
+	var parents []ObjectID
+	for _, txn := range ts {
+		for _, oid := range spentObjectIDs(txn) {
+			if _, exists := created[oid]; !exists {
+				parents = append(parents, oid)
+			}
+		}
+	}
+	return parents
+}
+
+// holdOrphanSet stores a transaction set whose parents are missing so that it
+// can be submitted to the pool once they appear.
+func (tp *TransactionPool) holdOrphanSet(ts []types.Transaction) error {
+	setID := TransactionSetID(crypto.HashObject(ts))
+	if _, exists := tp.orphanSets[setID]; exists {
+		return modules.ErrDuplicateTransactionSet
+	}
+	setSize := len(encoding.Marshal(ts))
+	if tp.orphanSetsSize+setSize > maxOrphanSetsSize {
+		return errFullOrphanSets
+	}
+	tp.orphanSets[setID] = orphanSet{
+		height: tp.blockHeight,
+		size:   setSize,
+		set:    ts,
+	}
+	tp.orphanSetsSize += setSize
+	for _, oid := range orphanParentIDs(ts) {
+		if tp.orphanParents[oid] == nil {
+			tp.orphanParents[oid] = make(map[TransactionSetID]struct{})
+		}
+		tp.orphanParents[oid][setID] = struct{}{}
+	}
+	return errOrphanSetHeld
+}
+
+// removeOrphanSet stops holding an orphan set.
+func (tp *TransactionPool) removeOrphanSet(setID TransactionSetID) {
+	orphan, exists := tp.orphanSets[setID]
+	if !exists {
+		return
+	}
+	delete(tp.orphanSets, setID)
+	tp.orphanSetsSize -= orphan.size
+	for _, oid := range orphanParentIDs(orphan.set) {
+		delete(tp.orphanParents[oid], setID)
+		if len(tp.orphanParents[oid]) == 0 {
+			delete(tp.orphanParents, oid)
+		}
+	}
+}
+
+// noteAppearedObjects records the objects that a consensus change added to
+// the consensus set, so that the orphans spending them are retried.
+func (tp *TransactionPool) noteAppearedObjects(cc modules.ConsensusChange) {
+	if len(tp.orphanSets) == 0 {
+		return
+	}
+	for _, diff := range cc.SiacoinOutputDiffs {
+		if diff.Direction == modules.DiffApply {
+			tp.appearedObjects = append(tp.appearedObjects, ObjectID(diff.ID))
+		}
+	}
+	for _, diff := range cc.FileContractDiffs {
+		if diff.Direction == modules.DiffApply {
+			tp.appearedObjects = append(tp.appearedObjects, ObjectID(diff.ID))
+		}
+	}
+	for _, diff := range cc.SiafundOutputDiffs {
+		if diff.Direction == modules.DiffApply {
+			tp.appearedObjects = append(tp.appearedObjects, ObjectID(diff.ID))
+		}
+	}
+}
+
+// expireOrphanSets drops the orphans that have been held for longer than
+// maxTxnAge blocks.
+func (tp *TransactionPool) expireOrphanSets() {
+	for setID, orphan := range tp.orphanSets {
+		if tp.blockHeight > orphan.height+maxTxnAge {
+			tp.removeOrphanSet(setID)
+		}
+	}
+}
+
+// promoteOrphanSets submits the held orphan sets that spend objects which
+// have appeared since the orphans were last promoted, either in the pool or in
+// the consensus set. The objects created by promoted orphans are retried in
+// turn, so that chains of orphans are promoted together. Orphans that are
+// still missing parents are held again. The promoted transaction sets are
+// relayed to peers.
+func (tp *TransactionPool) promoteOrphanSets(txnFn func([]types.Transaction) (modules.ConsensusChange, error)) {
+	for len(tp.appearedObjects) > 0 {
+		appeared := tp.appearedObjects
+		tp.appearedObjects = nil
+		candidates := make(map[TransactionSetID]struct{})
+		for _, oid := range appeared {
+			for setID := range tp.orphanParents[oid] {
+				candidates[setID] = struct{}{}
+			}
+		}
+
+		for setID := range candidates {
+			orphan, exists := tp.orphanSets[setID]
+			if !exists {
+				continue
+			}
+			// A storage proof cannot be valid before its file contract is
+			// confirmed, so proofs for contracts that are still in the pool
+			// remain held.
+			if tp.provesUnconfirmedContract(orphan.set) {
+				continue
+			}
+
+			tp.removeOrphanSet(setID)
+			err := tp.acceptTransactionSet(orphan.set, txnFn)
+			if err == errOrphanSetHeld {
+				// Keep the height at which the orphan was first seen.
+				held := tp.orphanSets[setID]
+				held.height = orphan.height
+				tp.orphanSets[setID] = held
+				continue
+			} else if err != nil {
+				tp.log.Debugln("Orphan transaction set was dropped:", err)
+				continue
+			}
+			tp.setOrigin(orphan.set, OriginOrphan)
+			for _, txn := range orphan.set {
+				tp.events.LogAccept(transactionEvent(txn))
+				for _, fn := range tp.orphanPromotedFns {
+					fn(txn)
+				}
+			}
+			go tp.gateway.Broadcast("RelayTransactionSet", orphan.set, tp.gateway.Peers())
+		}
+	}
+}
+
+// provesUnconfirmedContract returns true if the transaction set contains a
+// storage proof for a file contract that is created by a transaction in the
+// pool.
+func (tp *TransactionPool) provesUnconfirmedContract(ts []types.Transaction) bool {
+	for _, txn := range ts {
+		for _, sp := range txn.StorageProofs {
+			if _, exists := tp.knownObjects[ObjectID(sp.ParentID)]; exists {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// OnOrphanPromoted registers a function that is called for every transaction
+// of an orphan set that enters the transaction pool after its missing parents
+// appeared. The function is called while the transaction pool is locked, so it
+// must not call back into the transaction pool.
+func (tp *TransactionPool) OnOrphanPromoted(fn func(types.Transaction)) {
+	if err := tp.tg.Add(); err != nil {
+		return
+	}
+	defer tp.tg.Done()
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	tp.orphanPromotedFns = append(tp.orphanPromotedFns, fn)
+}
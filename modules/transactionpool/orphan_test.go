@@ -0,0 +1,321 @@
+package transactionpool
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+	"github.com/NebulousLabs/fastrand"
+)
+
+// TestOrphanPromotion checks that a child submitted before its parent is held
+// as an orphan, and that it is promoted into the pool once the parent arrives.
+func TestOrphanPromotion(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	tpt, err := createTpoolTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tpt.Close()
+
+	txns, err := tpt.wallet.SendSiacoins(types.SiacoinPrecision.Mul64(100), types.UnlockConditions{}.UnlockHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tpt.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	graph, err := types.TransactionGraph(txns[len(txns)-1].SiacoinOutputID(0), []types.TransactionGraphEdge{
+		{Dest: 1, Fee: types.SiacoinPrecision.Mul64(10), Source: 0, Value: types.SiacoinPrecision.Mul64(90)},
+		{Dest: 2, Fee: types.SiacoinPrecision.Mul64(10), Source: 1, Value: types.SiacoinPrecision.Mul64(80)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parent, child := graph[0], graph[1]
+
+	// Without holding orphans, the child is rejected.
+	err = tpt.tpool.AcceptTransactionSet([]types.Transaction{child})
+	if _, ok := err.(modules.ConsensusConflict); !ok {
+		t.Fatal("expected a consensus conflict, got", err)
+	}
+
+	err = tpt.tpool.SetSettings(modules.TransactionPoolSettings{HoldOrphanSets: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var promoted []types.TransactionID
+	tpt.tpool.OnOrphanPromoted(func(txn types.Transaction) {
+		promoted = append(promoted, txn.ID())
+	})
+
+	// The child should now be held as an orphan.
+	err = tpt.tpool.AcceptTransactionSet([]types.Transaction{child})
+	if err != errOrphanSetHeld {
+		t.Fatal("expected errOrphanSetHeld, got", err)
+	}
+	if _, _, exists := tpt.tpool.Transaction(child.ID()); exists {
+		t.Fatal("orphan was added to the pool")
+	}
+	if len(promoted) != 0 {
+		t.Fatal("orphan was promoted before its parent arrived")
+	}
+
+	// Once the parent arrives, the child should be promoted.
+	err = tpt.tpool.AcceptTransactionSet([]types.Transaction{parent})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, exists := tpt.tpool.Transaction(child.ID()); !exists {
+		t.Fatal("orphan was not promoted")
+	}
+	if len(promoted) != 1 || promoted[0] != child.ID() {
+		t.Fatal("promotion callback was not called for the orphan:", promoted)
+	}
+	if len(tpt.tpool.orphanSets) != 0 || tpt.tpool.orphanSetsSize != 0 {
+		t.Fatal("orphan is still being held")
+	}
+
+	// The promoted orphan should be confirmed along with its parent.
+	_, err = tpt.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	confirmed, err := tpt.tpool.TransactionConfirmed(child.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !confirmed {
+		t.Fatal("promoted orphan was not confirmed")
+	}
+}
+
+// TestOrphanIndex checks that only the orphans whose parents have appeared
+// are retried.
+func TestOrphanIndex(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	tpt, err := createTpoolTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tpt.Close()
+
+	var graphs [][]types.Transaction
+	for i := 0; i < 2; i++ {
+		source, err := tpt.graphSource(types.SiacoinPrecision.Mul64(100))
+		if err != nil {
+			t.Fatal(err)
+		}
+		graph, err := types.TransactionGraph(source, []types.TransactionGraphEdge{
+			{Dest: 1, Fee: types.SiacoinPrecision.Mul64(10), Source: 0, Value: types.SiacoinPrecision.Mul64(90)},
+			{Dest: 2, Fee: types.SiacoinPrecision.Mul64(10), Source: 1, Value: types.SiacoinPrecision.Mul64(80)},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		graphs = append(graphs, graph)
+	}
+	err = tpt.tpool.SetSettings(modules.TransactionPoolSettings{HoldOrphanSets: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, graph := range graphs {
+		err = tpt.tpool.AcceptTransactionSet(graph[1:])
+		if err != errOrphanSetHeld {
+			t.Fatal("expected errOrphanSetHeld, got", err)
+		}
+	}
+
+	// Accepting the parent of the first orphan should not retry the second.
+	validated := make(map[types.TransactionID]int)
+	tpt.tpool.validate = func(ts []types.Transaction, txnFn func([]types.Transaction) (modules.ConsensusChange, error)) (modules.ConsensusChange, error) {
+		for _, txn := range ts {
+			validated[txn.ID()]++
+		}
+		return consensusValidate(ts, txnFn)
+	}
+	err = tpt.tpool.AcceptTransactionSet(graphs[0][:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, exists := tpt.tpool.Transaction(graphs[0][1].ID()); !exists {
+		t.Fatal("orphan was not promoted")
+	}
+	if validated[graphs[1][1].ID()] != 0 {
+		t.Fatal("orphan whose parent is still missing was retried")
+	}
+	if len(tpt.tpool.orphanSets) != 1 || len(tpt.tpool.orphanParents) != 1 {
+		t.Fatal("expected 1 indexed orphan, got", len(tpt.tpool.orphanSets), len(tpt.tpool.orphanParents))
+	}
+	if _, exists := tpt.tpool.orphanParents[ObjectID(graphs[1][0].SiacoinOutputID(0))]; !exists {
+		t.Fatal("held orphan is not indexed by its missing parent")
+	}
+}
+
+// TestOrphanMergedParent checks that an orphan is promoted when its parent
+// enters the pool as part of a set that is merged with an existing pool set.
+func TestOrphanMergedParent(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	tpt, err := createTpoolTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tpt.Close()
+
+	var graphs [][]types.Transaction
+	for i := 0; i < 2; i++ {
+		source, err := tpt.graphSource(types.SiacoinPrecision.Mul64(100))
+		if err != nil {
+			t.Fatal(err)
+		}
+		graph, err := types.TransactionGraph(source, []types.TransactionGraphEdge{
+			{Dest: 1, Fee: types.SiacoinPrecision.Mul64(10), Source: 0, Value: types.SiacoinPrecision.Mul64(90)},
+			{Dest: 2, Fee: types.SiacoinPrecision.Mul64(10), Source: 1, Value: types.SiacoinPrecision.Mul64(80)},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		graphs = append(graphs, graph)
+	}
+	err = tpt.tpool.SetSettings(modules.TransactionPoolSettings{HoldOrphanSets: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	poolParent, poolChild := graphs[0][0], graphs[0][1]
+	parent, orphan := graphs[1][0], graphs[1][1]
+	err = tpt.tpool.AcceptTransactionSet([]types.Transaction{poolParent})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tpt.tpool.AcceptTransactionSet([]types.Transaction{orphan})
+	if err != errOrphanSetHeld {
+		t.Fatal("expected errOrphanSetHeld, got", err)
+	}
+
+	// Submit the parent of the orphan together with a child of the pool set,
+	// which merges it into the pool set.
+	err = tpt.tpool.AcceptTransactionSet([]types.Transaction{parent, poolChild})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, exists := tpt.tpool.Transaction(orphan.ID()); !exists {
+		t.Fatal("orphan was not promoted when its parent was merged into the pool")
+	}
+	if len(tpt.tpool.orphanSets) != 0 {
+		t.Fatal("orphan is still being held")
+	}
+}
+
+// TestOrphanStorageProof checks that a storage proof arriving before its file
+// contract is held, and that it is promoted once the file contract has been
+// confirmed.
+func TestOrphanStorageProof(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	tpt, err := createTpoolTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tpt.Close()
+	err = tpt.tpool.SetSettings(modules.TransactionPoolSettings{HoldOrphanSets: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// COMPATv0.4.0 - storage proofs below height 10 use the buggy pre-fork
+	// rules.
+	for tpt.cs.Height() <= 10 {
+		_, err := tpt.miner.AddBlock()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Create a file contract for a file consisting of a single segment, so
+	// that the storage proof can be created before the contract is confirmed.
+	file := fastrand.Bytes(crypto.SegmentSize)
+	payout := types.NewCurrency64(400e6)
+	height := tpt.cs.Height()
+	fc := types.FileContract{
+		FileSize:       uint64(len(file)),
+		FileMerkleRoot: crypto.MerkleRoot(file),
+		WindowStart:    height + 2,
+		WindowEnd:      height + 5,
+		Payout:         payout,
+		ValidProofOutputs: []types.SiacoinOutput{{
+			Value: types.PostTax(height, payout),
+		}},
+		MissedProofOutputs: []types.SiacoinOutput{{
+			Value: types.PostTax(height, payout),
+		}},
+	}
+	builder, err := tpt.wallet.StartTransaction()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = builder.FundSiacoins(payout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fcIndex := builder.AddFileContract(fc)
+	fcSet, err := builder.Sign(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fcid := fcSet[len(fcSet)-1].FileContractID(fcIndex)
+
+	// Submit the storage proof before the file contract is known.
+	segment, hashSet := crypto.MerkleProof(file, 0)
+	sp := types.StorageProof{
+		ParentID: fcid,
+		HashSet:  hashSet,
+	}
+	copy(sp.Segment[:], segment)
+	proofTxn := types.Transaction{StorageProofs: []types.StorageProof{sp}}
+	err = tpt.tpool.AcceptTransactionSet([]types.Transaction{proofTxn})
+	if err != errOrphanSetHeld {
+		t.Fatal("expected errOrphanSetHeld, got", err)
+	}
+
+	// While the file contract is unconfirmed, the proof should stay held.
+	err = tpt.tpool.AcceptTransactionSet(fcSet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, exists := tpt.tpool.Transaction(proofTxn.ID()); exists {
+		t.Fatal("storage proof was promoted before its file contract was confirmed")
+	}
+	if len(tpt.tpool.orphanSets) != 1 {
+		t.Fatal("storage proof is no longer held")
+	}
+
+	// Once the file contract is confirmed, the proof should be promoted and
+	// then confirmed itself.
+	_, err = tpt.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, exists := tpt.tpool.Transaction(proofTxn.ID()); !exists {
+		t.Fatal("storage proof was not promoted")
+	}
+	_, err = tpt.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	confirmed, err := tpt.tpool.TransactionConfirmed(proofTxn.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !confirmed {
+		t.Fatal("storage proof was not confirmed")
+	}
+}
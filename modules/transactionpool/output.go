@@ -0,0 +1,158 @@
+package transactionpool
+
+import (
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// An OutputState describes the effect that the transaction pool has on an
+// output.
+type OutputState int
+
+const (
+	// OutputUntouched means that no transaction in the pool creates or spends
+	// the output.
+	OutputUntouched OutputState = iota
+	// OutputCreated means that the output is created by a transaction in the
+	// pool, and not spent by any.
+	OutputCreated
+	// OutputSpent means that the output exists outside of the pool, and is
+	// spent by a transaction in the pool.
+	OutputSpent
+	// OutputCreatedAndSpent means that the output is both created and spent
+	// by transactions in the pool, as part of a chain of unconfirmed
+	// transactions.
+	OutputCreatedAndSpent
+)
+
+// OutputStatus describes the effect that the transaction pool has on an
+// output, along with the transactions that are responsible for it.
+type OutputStatus struct {
+	State OutputState
+
+	// Creator is the id of the transaction that creates the output, and is
+	// only set if the output is created by a transaction in the pool.
+	Creator types.TransactionID
+	// Spender is the id of the transaction that spends the output, and is
+	// only set if the output is spent by a transaction in the pool.
+	Spender types.TransactionID
+}
+
+// OutputStatus returns the effect that the transaction pool has on the
+// siacoin or siafund output with the provided id.
+func (tp *TransactionPool) OutputStatus(id types.OutputID) OutputStatus {
+	tp.mu.RLock()
+	defer tp.mu.RUnlock()
+
+	// Every output that is created or spent in the pool is a known object of
+	// the set that touches it.
+	var status OutputStatus
+	setID, exists := tp.knownObjects[ObjectID(id)]
+	if !exists {
+		return status
+	}
+	var created, spent bool
+	for _, txn := range tp.transactionSets[setID] {
+		for i := range txn.SiacoinOutputs {
+			if types.OutputID(txn.SiacoinOutputID(uint64(i))) == id {
+				created, status.Creator = true, txn.ID()
+			}
+		}
+		for i := range txn.SiafundOutputs {
+			if types.OutputID(txn.SiafundOutputID(uint64(i))) == id {
+				created, status.Creator = true, txn.ID()
+			}
+		}
+		for _, sci := range txn.SiacoinInputs {
+			if types.OutputID(sci.ParentID) == id {
+				spent, status.Spender = true, txn.ID()
+			}
+		}
+		for _, sfi := range txn.SiafundInputs {
+			if types.OutputID(sfi.ParentID) == id {
+				spent, status.Spender = true, txn.ID()
+			}
+		}
+	}
+
+	switch {
+	case created && spent:
+		status.State = OutputCreatedAndSpent
+	case created:
+		status.State = OutputCreated
+	case spent:
+		status.State = OutputSpent
+	}
+	return status
+}
+
+// CreatingTransaction returns the transaction in the pool that creates the
+// siacoin or siafund output with the provided id. The output's transaction set
+// is found through the known objects, so only that set is searched.
+func (tp *TransactionPool) CreatingTransaction(id types.OutputID) (types.Transaction, bool) {
+	tp.mu.RLock()
+	defer tp.mu.RUnlock()
+
+	setID, exists := tp.knownObjects[ObjectID(id)]
+	if !exists {
+		return types.Transaction{}, false
+	}
+	for _, txn := range tp.transactionSets[setID] {
+		for i := range txn.SiacoinOutputs {
+			if types.OutputID(txn.SiacoinOutputID(uint64(i))) == id {
+				return txn, true
+			}
+		}
+		for i := range txn.SiafundOutputs {
+			if types.OutputID(txn.SiafundOutputID(uint64(i))) == id {
+				return txn, true
+			}
+		}
+	}
+	return types.Transaction{}, false
+}
+
+// OutputAvailable returns false if a transaction in the pool spends the
+// siacoin or siafund output with the provided id, meaning that a new
+// transaction spending it would conflict with the pool. Whether the output
+// exists is not checked, so outputs that are neither in the consensus set nor
+// created by the pool are reported as available.
+func (tp *TransactionPool) OutputAvailable(id types.OutputID) bool {
+	state := tp.OutputStatus(id).State
+	return state != OutputSpent && state != OutputCreatedAndSpent
+}
+
+// UnconfirmedOutputDiffs returns the net effect of the unconfirmed set on the
+// siacoin outputs: an applied diff for every output created by the pool and a
+// reverted diff for every confirmed output it spends. Outputs that are both
+// created and spent by the pool are omitted, so the diffs can be combined
+// with the confirmed outputs to compute a pending balance. The diffs are not
+// returned in any particular order.
+func (tp *TransactionPool) UnconfirmedOutputDiffs() []modules.SiacoinOutputDiff {
+	tp.mu.RLock()
+	defer tp.mu.RUnlock()
+
+	var diffs []modules.SiacoinOutputDiff
+	for _, cc := range tp.transactionSetDiffs {
+		// Within a set, an output that is created and then spent has both
+		// an applied and a reverted diff.
+		applied := make(map[types.SiacoinOutputID]struct{})
+		reverted := make(map[types.SiacoinOutputID]struct{})
+		for _, diff := range cc.SiacoinOutputDiffs {
+			if diff.Direction == modules.DiffApply {
+				applied[diff.ID] = struct{}{}
+			} else {
+				reverted[diff.ID] = struct{}{}
+			}
+		}
+		for _, diff := range cc.SiacoinOutputDiffs {
+			_, isApplied := applied[diff.ID]
+			_, isReverted := reverted[diff.ID]
+			if isApplied && isReverted {
+				continue
+			}
+			diffs = append(diffs, diff)
+		}
+	}
+	return diffs
+}
@@ -0,0 +1,130 @@
+package transactionpool
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestOutputStatus checks that OutputStatus reports how the pool affects
+// outputs spent and created by a chain of unconfirmed transactions.
+func TestOutputStatus(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	tpt, err := createTpoolTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tpt.Close()
+
+	txns, err := tpt.wallet.SendSiacoins(types.SiacoinPrecision.Mul64(100), types.UnlockConditions{}.UnlockHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tpt.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := txns[len(txns)-1].SiacoinOutputID(0)
+	graph, err := types.TransactionGraph(source, []types.TransactionGraphEdge{
+		{Dest: 1, Fee: types.SiacoinPrecision.Mul64(10), Source: 0, Value: types.SiacoinPrecision.Mul64(90)},
+		{Dest: 2, Fee: types.SiacoinPrecision.Mul64(10), Source: 1, Value: types.SiacoinPrecision.Mul64(80)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tpt.tpool.AcceptTransactionSet(graph)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		id      types.SiacoinOutputID
+		state   OutputState
+		creator types.TransactionID
+		spender types.TransactionID
+	}{
+		{types.SiacoinOutputID{}, OutputUntouched, types.TransactionID{}, types.TransactionID{}},
+		{source, OutputSpent, types.TransactionID{}, graph[0].ID()},
+		{graph[0].SiacoinOutputID(0), OutputCreatedAndSpent, graph[0].ID(), graph[1].ID()},
+		{graph[1].SiacoinOutputID(0), OutputCreated, graph[1].ID(), types.TransactionID{}},
+	}
+	for i, test := range tests {
+		status := tpt.tpool.OutputStatus(types.OutputID(test.id))
+		if status.State != test.state || status.Creator != test.creator || status.Spender != test.spender {
+			t.Errorf("test %v: unexpected status %v", i, status)
+		}
+
+		// CreatingTransaction should agree with the creator in the status.
+		txn, exists := tpt.tpool.CreatingTransaction(types.OutputID(test.id))
+		if exists != (test.creator != types.TransactionID{}) {
+			t.Errorf("test %v: CreatingTransaction returned exists=%v", i, exists)
+		} else if exists && txn.ID() != test.creator {
+			t.Errorf("test %v: CreatingTransaction returned the wrong transaction", i)
+		}
+	}
+}
+
+// TestUnconfirmedOutputDiffs checks the net output diffs and the output
+// availability of a chain of unconfirmed transactions.
+func TestUnconfirmedOutputDiffs(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	tpt, err := createTpoolTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tpt.Close()
+
+	txns, err := tpt.wallet.SendSiacoins(types.SiacoinPrecision.Mul64(100), types.UnlockConditions{}.UnlockHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tpt.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := txns[len(txns)-1].SiacoinOutputID(0)
+	graph, err := types.TransactionGraph(source, []types.TransactionGraphEdge{
+		{Dest: 1, Fee: types.SiacoinPrecision.Mul64(10), Source: 0, Value: types.SiacoinPrecision.Mul64(90)},
+		{Dest: 2, Fee: types.SiacoinPrecision.Mul64(10), Source: 1, Value: types.SiacoinPrecision.Mul64(80)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tpt.tpool.AcceptTransactionSet(graph)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The intermediate output is created and spent by the pool, so only the
+	// source and the final output are affected.
+	diffs := tpt.tpool.UnconfirmedOutputDiffs()
+	if len(diffs) != 2 {
+		t.Fatalf("expected 2 diffs, got %v", len(diffs))
+	}
+	for _, diff := range diffs {
+		switch diff.ID {
+		case source:
+			if diff.Direction != modules.DiffRevert {
+				t.Error("spent output should be reverted")
+			}
+		case graph[1].SiacoinOutputID(0):
+			if diff.Direction != modules.DiffApply || !diff.SiacoinOutput.Value.Equals(types.SiacoinPrecision.Mul64(80)) {
+				t.Error("created output should be applied")
+			}
+		default:
+			t.Error("unexpected diff for output", diff.ID)
+		}
+	}
+
+	if tpt.tpool.OutputAvailable(types.OutputID(source)) || tpt.tpool.OutputAvailable(types.OutputID(graph[0].SiacoinOutputID(0))) {
+		t.Error("outputs spent by the pool should be unavailable")
+	}
+	if !tpt.tpool.OutputAvailable(types.OutputID(graph[1].SiacoinOutputID(0))) {
+		t.Error("unspent output created by the pool should be available")
+	}
+}
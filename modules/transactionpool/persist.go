@@ -1,12 +1,15 @@
 package transactionpool
 
 import (
+	"bytes"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"time"
 
 	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/encoding"
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/persist"
 	"github.com/NebulousLabs/Sia/types"
@@ -17,6 +20,37 @@ import (
 
 const tpoolSyncRate = time.Minute * 2
 
+var (
+	errBadPoolHeader  = errors.New("transaction pool file has the wrong header")
+	errBadPoolVersion = errors.New("transaction pool file has the wrong version")
+	errCorruptPool    = errors.New("transaction pool file is truncated or corrupt")
+	errNotSynced      = errors.New("consensus set is not synced yet")
+)
+
+// A LoadReport describes the result of loading the transaction pool file.
+type LoadReport struct {
+	// Recovered is the number of transactions that were decoded from the
+	// file, and Accepted is the number of those that were still valid and
+	// were added to the transaction pool.
+	Recovered int
+	Accepted  int
+
+	// Confirmed is the number of decoded transactions that were dropped
+	// because they have been confirmed, and Duplicates is the number that
+	// were already in the transaction pool.
+	Confirmed  int
+	Duplicates int
+
+	// ProofSets is the number of held transaction sets with premature
+	// storage proofs that were restored from the proof sets file.
+	ProofSets int
+
+	// SkippedBytes is the number of bytes at the end of the file that could
+	// not be decoded. Warning is set if any bytes were skipped.
+	SkippedBytes int
+	Warning      error
+}
+
 // threadedRegularSync will make sure that sync gets called on the database
 // every once in a while.
 func (tp *TransactionPool) threadedRegularSync() {
@@ -37,6 +71,28 @@ func (tp *TransactionPool) threadedRegularSync() {
 	}
 }
 
+// threadedRegularSave periodically writes the unconfirmed transactions to the
+// pool file, so that they survive a crash. The pool is also saved when it is
+// shut down. Neither happens before the pool file has been replayed, see
+// savePoolIfReplayed.
+func (tp *TransactionPool) threadedRegularSave() {
+	if err := tp.tg.Add(); err != nil {
+		return
+	}
+	defer tp.tg.Done()
+	for {
+		select {
+		case <-tp.tg.StopChan():
+			return
+		case <-time.After(poolSaveInterval):
+			err := tp.savePoolIfReplayed()
+			if err != nil {
+				tp.log.Println("ERROR: could not save the transaction pool:", err)
+			}
+		}
+	}
+}
+
 // syncDB commits the current global transaction and immediately begins a new
 // one.
 func (tp *TransactionPool) syncDB() {
@@ -59,6 +115,11 @@ func (tp *TransactionPool) resetDB(tx *bolt.Tx) error {
 	if err != nil {
 		return err
 	}
+	err = tx.DeleteBucket(bucketMinerPayouts)
+	if err != nil {
+		return err
+	}
+	tp.minerPayouts = make(map[types.SiacoinOutputID]types.BlockHeight)
 	err = tp.putRecentBlockID(tx, types.BlockID{})
 	if err != nil {
 		return err
@@ -72,6 +133,10 @@ func (tp *TransactionPool) resetDB(tx *bolt.Tx) error {
 		return err
 	}
 	_, err = tx.CreateBucket(bucketConfirmedTransactions)
+	if err != nil {
+		return err
+	}
+	_, err = tx.CreateBucket(bucketMinerPayouts)
 	return err
 }
 
@@ -130,6 +195,7 @@ func (tp *TransactionPool) initPersist() error {
 		bucketRecentConsensusChange,
 		bucketConfirmedTransactions,
 		bucketFeeMedian,
+		bucketMinerPayouts,
 	}
 	for _, bucket := range buckets {
 		_, err := tp.dbTx.CreateBucketIfNotExists(bucket)
@@ -176,6 +242,12 @@ func (tp *TransactionPool) initPersist() error {
 		tp.recentMedianFee = mp.RecentMedianFee
 	}
 
+	// Get the miner payouts that have not yet reached the coinbase maturity.
+	tp.minerPayouts, err = tp.getMinerPayouts(tp.dbTx)
+	if err != nil {
+		return build.ExtendErr("unable to load the miner payouts", err)
+	}
+
 	// Subscribe to the consensus set using the most recent consensus change.
 	err = tp.consensusSet.ConsensusSetSubscribe(tp, cc, tp.tg.StopChan())
 	if err == modules.ErrInvalidConsensusChangeID {
@@ -220,3 +292,340 @@ func (tp *TransactionPool) TransactionConfirmed(id types.TransactionID) (bool, e
 func (tp *TransactionPool) transactionConfirmed(tx *bolt.Tx, id types.TransactionID) bool {
 	return tx.Bucket(bucketConfirmedTransactions).Get(id[:]) != nil
 }
+
+// poolFilePath returns the path of the file that the unconfirmed transactions
+// are saved to.
+func (tp *TransactionPool) poolFilePath() string {
+	return filepath.Join(tp.persistDir, poolFilename)
+}
+
+// proofSetsFilePath returns the path of the file that the held transaction
+// sets with premature storage proofs are saved to.
+func (tp *TransactionPool) proofSetsFilePath() string {
+	return filepath.Join(tp.persistDir, proofSetsFilename)
+}
+
+// Save writes all of the unconfirmed transactions in the transaction pool to
+// disk. Each transaction is stored with a length prefix, in an order that
+// allows them to be re-added to the pool one at a time. The held transaction
+// sets with premature storage proofs are written to a separate file, one set
+// at a time. The files are replaced atomically.
+func (tp *TransactionPool) Save() error {
+	if err := tp.tg.Add(); err != nil {
+		return err
+	}
+	defer tp.tg.Done()
+	return tp.savePool()
+}
+
+// savePool writes the unconfirmed transactions to the pool file and the held
+// transaction sets with premature storage proofs to the proof sets file,
+// without registering with the thread group, so that it can also be called
+// while the transaction pool is shutting down.
+func (tp *TransactionPool) savePool() error {
+	tp.mu.RLock()
+	var buf, proofBuf bytes.Buffer
+	err := encoding.WriteObject(&buf, poolMetadata)
+	for _, tSet := range tp.transactionSets {
+		for _, txn := range tSet {
+			err = errors.Compose(err, encoding.WriteObject(&buf, txn))
+		}
+	}
+	err = errors.Compose(err, encoding.WriteObject(&proofBuf, proofSetsMetadata))
+	for _, ps := range tp.proofSets {
+		err = errors.Compose(err, encoding.WriteObject(&proofBuf, ps.set))
+	}
+	tp.mu.RUnlock()
+	if err != nil {
+		return build.ExtendErr("unable to encode the transaction pool", err)
+	}
+
+	err = writePoolFile(tp.poolFilePath(), buf.Bytes())
+	if err != nil {
+		return err
+	}
+	return writePoolFile(tp.proofSetsFilePath(), proofBuf.Bytes())
+}
+
+// writePoolFile atomically replaces the file at path with b.
+func writePoolFile(path string, b []byte) error {
+	f, err := persist.NewSafeFile(path)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		return errors.Compose(err, f.Close())
+	}
+	return f.CommitSync()
+}
+
+// savePoolIfReplayed saves the pool once the pool file has been replayed by
+// ReplayAfterSync. Saving before that would replace the saved transactions
+// with the ones that arrived while the consensus set was catching up.
+func (tp *TransactionPool) savePoolIfReplayed() error {
+	tp.mu.RLock()
+	replayed := tp.poolReplayed
+	tp.mu.RUnlock()
+	if !replayed {
+		return nil
+	}
+	return tp.savePool()
+}
+
+// readPoolFile decodes the transactions of a transaction pool file. Decoding
+// stops at the first transaction that cannot be decoded, so that the
+// transactions before it can still be recovered if the file was truncated or
+// corrupted, for example by a crash during Save. The number of bytes that
+// could not be decoded is returned along with the transactions.
+func readPoolFile(b []byte) ([]types.Transaction, int, error) {
+	r := bytes.NewReader(b)
+	err := readPoolMetadata(r, poolMetadata)
+	if err == errCorruptPool {
+		return nil, len(b), err
+	} else if err != nil {
+		return nil, 0, err
+	}
+
+	var txns []types.Transaction
+	for r.Len() > 0 {
+		remaining := r.Len()
+		var txn types.Transaction
+		err := encoding.ReadObject(r, &txn, types.BlockSizeLimit)
+		if err != nil {
+			return txns, remaining, errCorruptPool
+		}
+		txns = append(txns, txn)
+	}
+	return txns, 0, nil
+}
+
+// readProofSetsFile decodes the held transaction sets of a proof sets file.
+// Like readPoolFile, decoding stops at the first set that cannot be decoded,
+// and the number of bytes that could not be decoded is returned along with
+// the sets.
+func readProofSetsFile(b []byte) ([][]types.Transaction, int, error) {
+	r := bytes.NewReader(b)
+	err := readPoolMetadata(r, proofSetsMetadata)
+	if err == errCorruptPool {
+		return nil, len(b), err
+	} else if err != nil {
+		return nil, 0, err
+	}
+
+	var sets [][]types.Transaction
+	for r.Len() > 0 {
+		remaining := r.Len()
+		var set []types.Transaction
+		err := encoding.ReadObject(r, &set, types.BlockSizeLimit)
+		if err != nil {
+			return sets, remaining, errCorruptPool
+		}
+		sets = append(sets, set)
+	}
+	return sets, 0, nil
+}
+
+// readPoolMetadata decodes the metadata at the start of a pool file and checks
+// it against the expected metadata.
+func readPoolMetadata(r *bytes.Reader, expected persist.Metadata) error {
+	var meta persist.Metadata
+	err := encoding.ReadObject(r, &meta, uint64(r.Len()))
+	if err != nil {
+		return errCorruptPool
+	}
+	if meta.Header != expected.Header {
+		return errBadPoolHeader
+	}
+	if meta.Version != expected.Version {
+		return errBadPoolVersion
+	}
+	return nil
+}
+
+// Load reads the transactions that were written to disk by Save and adds them
+// back to the transaction pool. Transactions that have been confirmed or have
+// become invalid in the meantime are dropped. The saved transaction sets with
+// premature storage proofs are held again, and are submitted by the next
+// consensus change that opens their proof windows. A truncated or corrupt file
+// is not treated as an error; the transactions that can be decoded are loaded,
+// and the problem is reported in the Warning field of the LoadReport. An error
+// is only returned if the file exists but cannot be read, or belongs to a
+// different version of the transaction pool.
+func (tp *TransactionPool) Load() (LoadReport, error) {
+	if err := tp.tg.Add(); err != nil {
+		return LoadReport{}, err
+	}
+	defer tp.tg.Done()
+
+	var report LoadReport
+	var txns []types.Transaction
+	b, err := ioutil.ReadFile(tp.poolFilePath())
+	if err == nil {
+		var skipped int
+		txns, skipped, err = readPoolFile(b)
+		if err == errCorruptPool {
+			report.Warning = err
+		} else if err != nil {
+			return LoadReport{}, err
+		}
+		report.Recovered = len(txns)
+		report.SkippedBytes = skipped
+	} else if !os.IsNotExist(err) {
+		return LoadReport{}, err
+	}
+	var proofSets [][]types.Transaction
+	b, err = ioutil.ReadFile(tp.proofSetsFilePath())
+	if err == nil {
+		var skipped int
+		proofSets, skipped, err = readProofSetsFile(b)
+		if err == errCorruptPool {
+			report.Warning = err
+		} else if err != nil {
+			return LoadReport{}, err
+		}
+		report.SkippedBytes += skipped
+	} else if !os.IsNotExist(err) {
+		return LoadReport{}, err
+	}
+	if report.Warning != nil {
+		tp.log.Printf("WARN: transaction pool file is damaged: recovered %v transactions and %v held storage proof sets, skipped %v bytes\n", report.Recovered, len(proofSets), report.SkippedBytes)
+	}
+	if len(txns) == 0 && len(proofSets) == 0 {
+		return report, nil
+	}
+
+	// The signatures of the transactions in the pool file are verified
+	// before they are added, unless skipSignatureCheck is enabled, in which
+	// case they are verified in the background and the transactions are
+	// withheld from subscribers and block templates until then.
+	var lockedTry func(fn func(func(txns []types.Transaction) (modules.ConsensusChange, error)) error) error
+	trusted := false
+	if cs, ok := tp.consensusSet.(interface {
+		LockedTryTrustedTransactionSet(fn func(func(txns []types.Transaction) (modules.ConsensusChange, error)) error) error
+	}); ok && tp.skipSignatureCheck {
+		lockedTry = cs.LockedTryTrustedTransactionSet
+		trusted = true
+	} else if cs, ok := tp.consensusSet.(interface {
+		LockedTryTransactionSet(fn func(func(txns []types.Transaction) (modules.ConsensusChange, error)) error) error
+	}); ok {
+		lockedTry = cs.LockedTryTransactionSet
+	} else {
+		return report, errors.New("consensus set does not support LockedTryTransactionSet method")
+	}
+	var accepted []types.TransactionID
+	err = lockedTry(func(txnFn func(txns []types.Transaction) (modules.ConsensusChange, error)) error {
+		tp.mu.Lock()
+		defer tp.mu.Unlock()
+		for _, txn := range txns {
+			if tp.transactionConfirmed(tp.dbTx, txn.ID()) {
+				report.Confirmed++
+				continue
+			} else if _, exists := tp.findTransactionSet(txn.ID()); exists {
+				report.Duplicates++
+				continue
+			}
+			err := tp.acceptTransactionSet([]types.Transaction{txn}, txnFn)
+			if err == nil {
+				tp.setOrigin([]types.Transaction{txn}, OriginDisk)
+				if trusted {
+					tp.unverified[txn.ID()] = struct{}{}
+				}
+				accepted = append(accepted, txn.ID())
+				report.Accepted++
+			}
+		}
+		for _, set := range proofSets {
+			confirmed := false
+			for _, txn := range set {
+				confirmed = confirmed || tp.transactionConfirmed(tp.dbTx, txn.ID())
+			}
+			if confirmed {
+				continue
+			}
+			if tp.holdProofSet(set) == errProofSetHeld {
+				report.ProofSets++
+			}
+		}
+		tp.updateSubscribersTransactions()
+		return nil
+	})
+	if trusted && len(accepted) > 0 {
+		go tp.threadedVerifySignatures(accepted, lockedTry, nil)
+	}
+	tp.log.Printf("loaded %v of %v saved transactions into the transaction pool, held %v storage proof sets\n", report.Accepted, report.Recovered, report.ProofSets)
+	return report, err
+}
+
+// A ReplayReport describes the result of replaying the transaction pool
+// against the consensus set with ReplayAfterSync.
+type ReplayReport struct {
+	// Kept is the number of transactions in the transaction pool after the
+	// replay.
+	Kept int
+
+	// Confirmed is the number of transactions that were dropped because they
+	// were confirmed while the consensus set was catching up, and Invalid is
+	// the number that were dropped because they are no longer valid. Both
+	// include the transactions of the pool file and the transactions that
+	// were already in the pool.
+	Confirmed int
+	Invalid   int
+
+	// Load is the report of loading the pool file.
+	Load LoadReport
+}
+
+// ReplayAfterSync brings the transaction pool up to date with a consensus set
+// that has just finished its initial blockchain download, which is the
+// startup flow for a node that was shut down while syncing. The transactions
+// already in the pool are reconciled against the consensus set first, and the
+// transactions saved by Save are loaded afterwards, so that transactions
+// confirmed during the catch-up are dropped instead of being added, and the
+// remaining transactions are validated against the current state. The
+// transaction pool calls ReplayAfterSync by itself after the first synced
+// consensus change. errNotSynced is returned if the consensus set is still
+// syncing.
+func (tp *TransactionPool) ReplayAfterSync() (ReplayReport, error) {
+	if !tp.consensusSet.Synced() {
+		return ReplayReport{}, errNotSynced
+	}
+	reconciled, err := tp.Reconcile()
+	if err != nil {
+		return ReplayReport{}, err
+	}
+	loaded, err := tp.Load()
+	if err != nil {
+		return ReplayReport{}, err
+	}
+	tp.mu.Lock()
+	tp.poolReplayed = true
+	tp.mu.Unlock()
+
+	tp.mu.RLock()
+	var kept int
+	for _, tSet := range tp.transactionSets {
+		kept += len(tSet)
+	}
+	tp.mu.RUnlock()
+	report := ReplayReport{
+		Kept:      kept,
+		Confirmed: len(reconciled.Confirmed) + loaded.Confirmed,
+		Invalid:   len(reconciled.Invalid) + loaded.Recovered - loaded.Accepted - loaded.Confirmed - loaded.Duplicates,
+		Load:      loaded,
+	}
+	tp.log.Printf("replayed transaction pool after sync: kept %v transactions, dropped %v confirmed and %v invalid transactions\n", report.Kept, report.Confirmed, report.Invalid)
+	return report, nil
+}
+
+// threadedReplayAfterSync calls ReplayAfterSync after the first synced
+// consensus change.
+func (tp *TransactionPool) threadedReplayAfterSync() {
+	if err := tp.tg.Add(); err != nil {
+		return
+	}
+	defer tp.tg.Done()
+	_, err := tp.ReplayAfterSync()
+	if err != nil {
+		tp.log.Println("WARN: could not replay the transaction pool after sync:", err)
+	}
+}
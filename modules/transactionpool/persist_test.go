@@ -1,10 +1,16 @@
 package transactionpool
 
 import (
+	"bytes"
+	"errors"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/encoding"
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/persist"
 	"github.com/NebulousLabs/Sia/types"
@@ -93,3 +99,533 @@ func TestRescan(t *testing.T) {
 		t.Fatal("expecting modules.ErrDuplicateTransactionSet, got:", err)
 	}
 }
+
+// TestPersistAcrossRestart checks that the unconfirmed transactions are
+// saved when the transaction pool shuts down, and restored when it starts.
+func TestPersistAcrossRestart(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	tpt, err := createTpoolTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tpt.Close()
+
+	txns, err := tpt.wallet.SendSiacoins(types.SiacoinPrecision.Mul64(100), types.UnlockConditions{}.UnlockHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tpt.tpool.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpt.tpool, err = New(tpt.cs, tpt.gateway, tpt.tpool.persistDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, txn := range txns {
+		if _, _, exists := tpt.tpool.Transaction(txn.ID()); !exists {
+			t.Fatal("transaction was not restored after a restart")
+		}
+		if origin, _ := tpt.tpool.Origin(txn.ID()); origin != OriginDisk {
+			t.Error("restored transaction has origin", origin)
+		}
+	}
+}
+
+// TestPersistMinerPayouts checks that the miner payouts tracked for the
+// coinbase maturity survive a restart.
+func TestPersistMinerPayouts(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	tpt, err := createTpoolTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tpt.Close()
+
+	settings := modules.TransactionPoolSettings{CoinbaseMaturity: types.MaturityDelay + 3}
+	err = tpt.tpool.SetSettings(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Mine a block with a payout that TransactionGraph can spend.
+	block, target, err := tpt.miner.BlockForWork()
+	if err != nil {
+		t.Fatal(err)
+	}
+	block.MinerPayouts[0].UnlockHash = types.UnlockConditions{}.UnlockHash()
+	solvedBlock, solved := tpt.miner.SolveBlock(block, target)
+	if !solved {
+		t.Fatal("failed to solve block")
+	}
+	err = tpt.cs.AcceptBlock(solvedBlock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payout := solvedBlock.MinerPayouts[0].Value
+	fee := types.SiacoinPrecision.Mul64(10)
+	graphTxns, err := types.TransactionGraph(solvedBlock.MinerPayoutID(0), []types.TransactionGraphEdge{{
+		Dest:   1,
+		Fee:    fee,
+		Source: 0,
+		Value:  payout.Sub(fee),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Restart the transaction pool before the payout matures.
+	err = tpt.tpool.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpt.tpool, err = New(tpt.cs, tpt.gateway, tpt.tpool.persistDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tpt.tpool.SetSettings(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Once the payout has matured in consensus, the spend should still be
+	// held to the coinbase maturity.
+	for i := types.BlockHeight(0); i < types.MaturityDelay+1; i++ {
+		_, err = tpt.miner.AddBlock()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = tpt.tpool.AcceptTransactionSet(graphTxns)
+	if err != modules.ErrImmatureCoinbase {
+		t.Fatal("expected modules.ErrImmatureCoinbase, got", err)
+	}
+}
+
+// TestSaveBeforeSync checks that the pool file is not overwritten before the
+// transaction pool has replayed it.
+func TestSaveBeforeSync(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	tpt, err := createTpoolTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tpt.Close()
+
+	_, err = tpt.wallet.SendSiacoins(types.SiacoinPrecision.Mul64(100), types.UnlockConditions{}.UnlockHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tpt.tpool.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved, err := ioutil.ReadFile(tpt.tpool.poolFilePath())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Until the pool has been replayed, the pool file is left alone.
+	tpt.tpool.PurgeTransactionPool()
+	tpt.tpool.mu.Lock()
+	tpt.tpool.poolReplayed = false
+	tpt.tpool.mu.Unlock()
+	err = tpt.tpool.savePoolIfReplayed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(tpt.tpool.poolFilePath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, saved) {
+		t.Fatal("pool file was overwritten before the pool was replayed")
+	}
+}
+
+// TestReplayAfterSync checks that replaying a saved pool drops the
+// transactions that were confirmed or invalidated while the node was catching
+// up, and keeps the rest.
+func TestReplayAfterSync(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	tpt, err := createTpoolTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tpt.Close()
+	err = build.Retry(50, 100*time.Millisecond, func() error {
+		if !tpt.cs.Synced() {
+			return errors.New("consensus set is not synced")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Fill the pool with three independent transactions and save it.
+	var sources []types.SiacoinOutputID
+	for i := 0; i < 3; i++ {
+		txns, err := tpt.wallet.SendSiacoins(types.SiacoinPrecision.Mul64(100), types.UnlockConditions{}.UnlockHash())
+		if err != nil {
+			t.Fatal(err)
+		}
+		sources = append(sources, txns[len(txns)-1].SiacoinOutputID(0))
+	}
+	_, err = tpt.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	spend := func(source types.SiacoinOutputID, fee uint64) types.Transaction {
+		graphTxns, err := types.TransactionGraph(source, []types.TransactionGraphEdge{{
+			Dest:   1,
+			Fee:    types.SiacoinPrecision.Mul64(fee),
+			Source: 0,
+			Value:  types.SiacoinPrecision.Mul64(100 - fee),
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return graphTxns[0]
+	}
+	var saved []types.Transaction
+	for _, source := range sources {
+		txn := spend(source, 10)
+		err = tpt.tpool.AcceptTransactionSet([]types.Transaction{txn})
+		if err != nil {
+			t.Fatal(err)
+		}
+		saved = append(saved, txn)
+	}
+	err = tpt.tpool.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// While the node catches up, the first transaction is confirmed and the
+	// second one is double spent by a confirmed transaction.
+	tpt.tpool.PurgeTransactionPool()
+	err = tpt.tpool.AcceptTransactionSet([]types.Transaction{saved[0], spend(sources[1], 20)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tpt.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := tpt.tpool.ReplayAfterSync()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Kept != 1 || report.Confirmed != 1 || report.Invalid != 1 {
+		t.Fatal("unexpected replay report:", report)
+	}
+	if _, _, exists := tpt.tpool.Transaction(saved[2].ID()); !exists {
+		t.Fatal("valid transaction was not kept")
+	}
+	for _, txn := range saved[:2] {
+		if _, _, exists := tpt.tpool.Transaction(txn.ID()); exists {
+			t.Fatal("confirmed or invalid transaction was kept")
+		}
+	}
+}
+
+// TestLoadCorruptPoolFile checks that Load recovers the transactions of a pool
+// file that was truncated, both at a transaction boundary and in the middle of
+// a transaction.
+func TestLoadCorruptPoolFile(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	tpt, err := createTpoolTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tpt.Close()
+
+	// Loading without a pool file should do nothing.
+	report, err := tpt.tpool.Load()
+	if err != nil || report.Recovered != 0 || report.Warning != nil {
+		t.Fatal("unexpected result when loading a missing file:", report, err)
+	}
+
+	// Fill the pool with three independent transactions and save it.
+	var sources []types.SiacoinOutputID
+	for i := 0; i < 3; i++ {
+		txns, err := tpt.wallet.SendSiacoins(types.SiacoinPrecision.Mul64(100), types.UnlockConditions{}.UnlockHash())
+		if err != nil {
+			t.Fatal(err)
+		}
+		sources = append(sources, txns[len(txns)-1].SiacoinOutputID(0))
+	}
+	_, err = tpt.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, source := range sources {
+		graphTxns, err := types.TransactionGraph(source, []types.TransactionGraphEdge{{
+			Dest:   1,
+			Fee:    types.SiacoinPrecision.Mul64(10),
+			Source: 0,
+			Value:  types.SiacoinPrecision.Mul64(90),
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = tpt.tpool.AcceptTransactionSet(graphTxns)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = tpt.tpool.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+	poolFile := filepath.Join(tpt.tpool.persistDir, poolFilename)
+	full, err := ioutil.ReadFile(poolFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An intact file should be loaded completely.
+	tpt.tpool.PurgeTransactionPool()
+	report, err = tpt.tpool.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Recovered != 3 || report.Accepted != 3 || report.Warning != nil {
+		t.Fatal("unexpected result when loading an intact file:", report)
+	}
+
+	// Determine where the first transaction in the file ends.
+	headerLen := len(encoding.Marshal(encoding.Marshal(poolMetadata)))
+	firstLen := 8 + int(encoding.DecUint64(full[headerLen:headerLen+8]))
+	boundary := headerLen + firstLen
+
+	// A file truncated at a transaction boundary looks like a smaller pool.
+	err = ioutil.WriteFile(poolFile, full[:boundary], 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpt.tpool.PurgeTransactionPool()
+	report, err = tpt.tpool.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Recovered != 1 || report.Accepted != 1 || report.Warning != nil {
+		t.Fatal("unexpected result when loading a file truncated at a boundary:", report)
+	}
+
+	// A file truncated in the middle of a transaction should recover the
+	// transactions before it, and report the damage.
+	err = ioutil.WriteFile(poolFile, full[:boundary+10], 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpt.tpool.PurgeTransactionPool()
+	report, err = tpt.tpool.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Recovered != 1 || report.Accepted != 1 || report.SkippedBytes != 10 || report.Warning != errCorruptPool {
+		t.Fatal("unexpected result when loading a file truncated mid-transaction:", report)
+	}
+	if len(tpt.tpool.TransactionList()) != 1 {
+		t.Fatal("expected 1 transaction in the pool, got", len(tpt.tpool.TransactionList()))
+	}
+}
+
+// TestReplayOnSync checks that the transaction pool is replayed against the
+// consensus set by the first synced consensus change.
+func TestReplayOnSync(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	tpt, err := createTpoolTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tpt.Close()
+	err = build.Retry(50, 100*time.Millisecond, func() error {
+		if !tpt.cs.Synced() {
+			return errors.New("consensus set is not synced")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Save a transaction, and remove it from the pool.
+	txns, err := tpt.wallet.SendSiacoins(types.SiacoinPrecision.Mul64(100), types.UnlockConditions{}.UnlockHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tpt.tpool.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpt.tpool.PurgeTransactionPool()
+
+	// Pretend that the pool has not seen a synced consensus change yet. The
+	// next block should replay the saved transaction into the pool. The miner
+	// is told about the purge so that the block does not confirm it.
+	tpt.tpool.mu.Lock()
+	tpt.tpool.updateSubscribersTransactions()
+	tpt.tpool.synced = false
+	tpt.tpool.replayedAfterSync = false
+	tpt.tpool.mu.Unlock()
+	_, err = tpt.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = build.Retry(50, 100*time.Millisecond, func() error {
+		for _, txn := range txns {
+			if _, _, exists := tpt.tpool.Transaction(txn.ID()); !exists {
+				return errors.New("saved transaction was not replayed")
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestLoadSkipSignatureCheck checks that Load verifies the signatures of the
+// transactions in the pool file, in the background when skipSignatureCheck is
+// enabled.
+func TestLoadSkipSignatureCheck(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	tpt, err := createTpoolTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tpt.Close()
+
+	// Put a signed transaction in the pool, and save the pool.
+	txns, err := tpt.wallet.SendSiacoins(types.SiacoinPrecision, types.UnlockConditions{}.UnlockHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tpt.tpool.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Replace the pool file with one in which every signature is corrupt.
+	var buf bytes.Buffer
+	err = encoding.WriteObject(&buf, poolMetadata)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var corrupt []types.Transaction
+	for _, txn := range txns {
+		txn.TransactionSignatures = append([]types.TransactionSignature(nil), txn.TransactionSignatures...)
+		for i := range txn.TransactionSignatures {
+			sig := append([]byte(nil), txn.TransactionSignatures[i].Signature...)
+			sig[0]++
+			txn.TransactionSignatures[i].Signature = sig
+		}
+		corrupt = append(corrupt, txn)
+		err = encoding.WriteObject(&buf, txn)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = ioutil.WriteFile(filepath.Join(tpt.tpool.persistDir, poolFilename), buf.Bytes(), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// With signature checks enabled, the transactions should be rejected.
+	tpt.tpool.PurgeTransactionPool()
+	tpt.tpool.skipSignatureCheck = false
+	report, err := tpt.tpool.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Recovered != len(txns) || report.Accepted != 0 {
+		t.Fatal("transactions with corrupt signatures were accepted:", report)
+	}
+
+	// With signature checks skipped, the transactions are added to the pool,
+	// but never reach a block template, and are evicted once their
+	// signatures have been verified in the background.
+	tpt.tpool.skipSignatureCheck = true
+	report, err = tpt.tpool.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Accepted != len(txns) {
+		t.Fatal("trusted transactions were not accepted:", report)
+	}
+	if len(tpt.tpool.BlockTransactions()) != 0 {
+		t.Fatal("unverified transactions were included in a block template")
+	}
+	err = build.Retry(100, 10*time.Millisecond, func() error {
+		if len(tpt.tpool.TransactionList()) != 0 {
+			return errors.New("transactions with corrupt signatures were not evicted")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Transactions submitted through AcceptTransactionSet are always
+	// verified.
+	tpt.tpool.PurgeTransactionPool()
+	err = tpt.tpool.AcceptTransactionSet(corrupt)
+	if err == nil {
+		t.Fatal("transactions with corrupt signatures were accepted")
+	}
+}
+
+// BenchmarkLoad compares loading a pool file with and without verifying the
+// signatures of its transactions.
+func BenchmarkLoad(b *testing.B) {
+	tpt, err := createTpoolTester(b.Name())
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer tpt.Close()
+	for i := 0; i < 25; i++ {
+		_, err := tpt.wallet.SendSiacoins(types.SiacoinPrecision, types.UnlockConditions{}.UnlockHash())
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+	err = tpt.tpool.Save()
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	for _, skip := range []bool{false, true} {
+		name := "Verified"
+		if skip {
+			name = "Trusted"
+		}
+		b.Run(name, func(b *testing.B) {
+			tpt.tpool.skipSignatureCheck = skip
+			for i := 0; i < b.N; i++ {
+				tpt.tpool.PurgeTransactionPool()
+				_, err := tpt.tpool.Load()
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package transactionpool
+
+import (
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// Pin marks a transaction so that its transaction set, which includes all of
+// its unconfirmed ancestors, is never evicted by Trim and never expires. A
+// pinned transaction is still removed from the pool once it is confirmed, or
+// once it is no longer valid, and PurgeTransactionPool removes the pin along
+// with the transaction.
+func (tp *TransactionPool) Pin(id types.TransactionID) error {
+	if err := tp.tg.Add(); err != nil {
+		return err
+	}
+	defer tp.tg.Done()
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	if _, exists := tp.findTransactionSet(id); !exists {
+		return errTransactionNotFound
+	}
+	tp.pinnedTransactions[id] = struct{}{}
+	return nil
+}
+
+// Unpin removes the mark placed on a transaction by Pin.
+func (tp *TransactionPool) Unpin(id types.TransactionID) error {
+	if err := tp.tg.Add(); err != nil {
+		return err
+	}
+	defer tp.tg.Done()
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	if _, exists := tp.findTransactionSet(id); !exists {
+		return errTransactionNotFound
+	}
+	delete(tp.pinnedTransactions, id)
+	return nil
+}
+
+// setPinned returns true if any transaction of the set is pinned.
+func (tp *TransactionPool) setPinned(ts []types.Transaction) bool {
+	for _, txn := range ts {
+		if _, exists := tp.pinnedTransactions[txn.ID()]; exists {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,53 @@
+package transactionpool
+
+import (
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// A Priority is a hint that influences the order in which transactions are
+// evicted from the transaction pool, independent of the fees that they pay.
+// Transactions with a higher priority are evicted after transactions with a
+// lower priority.
+type Priority int
+
+const (
+	// PriorityLow marks transactions that should be evicted before any
+	// others.
+	PriorityLow Priority = iota - 1
+	// PriorityNormal is the priority of transactions that are submitted
+	// without a hint, including transactions relayed by peers.
+	PriorityNormal
+	// PriorityHigh marks transactions that should be kept in the pool for as
+	// long as possible, such as the node's own transactions.
+	PriorityHigh
+)
+
+// setPriority attaches a priority to every transaction in a set. A
+// transaction that already has a higher priority keeps it.
+func (tp *TransactionPool) setPriority(ts []types.Transaction, prio Priority) {
+	if prio == PriorityNormal {
+		return
+	}
+	for _, txn := range ts {
+		current, exists := tp.transactionPriorities[txn.ID()]
+		if !exists || prio > current {
+			tp.transactionPriorities[txn.ID()] = prio
+		}
+	}
+}
+
+// setPriorityOf returns the priority of a transaction set, which is the
+// highest priority of any of its transactions.
+func (tp *TransactionPool) setPriorityOf(ts []types.Transaction) Priority {
+	prio := PriorityLow
+	for _, txn := range ts {
+		current, exists := tp.transactionPriorities[txn.ID()]
+		if !exists {
+			current = PriorityNormal
+		}
+		if current > prio {
+			prio = current
+		}
+	}
+	return prio
+}
@@ -0,0 +1,81 @@
+package transactionpool
+
+import (
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+
+	"github.com/NebulousLabs/errors"
+)
+
+var (
+	errQuarantined = errors.New("source has been quarantined, its transaction sets are refused")
+)
+
+// setSource records the source that submitted every transaction in a set.
+// Transactions that are already in the pool keep their original source.
+func (tp *TransactionPool) setSource(ts []types.Transaction, source string) {
+	if source == "" {
+		return
+	}
+	for _, txn := range ts {
+		if _, exists := tp.transactionSources[txn.ID()]; !exists {
+			tp.transactionSources[txn.ID()] = source
+		}
+	}
+}
+
+// QuarantineSource removes every transaction that was submitted by the
+// provided source through AcceptTransactionSetFrom from the transaction pool,
+// along with any transactions that depend on them, and refuses the transaction
+// sets that the source submits until UnquarantineSource is called. Sets from
+// the source that are being held outside of the unconfirmed set, for example
+// as orphans, are not removed. Quarantined sources are not persisted.
+func (tp *TransactionPool) QuarantineSource(source string) error {
+	if err := tp.tg.Add(); err != nil {
+		return err
+	}
+	defer tp.tg.Done()
+	cs, ok := tp.consensusSet.(interface {
+		LockedTryTransactionSet(fn func(func(txns []types.Transaction) (modules.ConsensusChange, error)) error) error
+	})
+	if !ok {
+		return errors.New("consensus set does not support LockedTryTransactionSet method")
+	}
+
+	return cs.LockedTryTransactionSet(func(txnFn func(txns []types.Transaction) (modules.ConsensusChange, error)) error {
+		tp.mu.Lock()
+		defer tp.mu.Unlock()
+		tp.quarantinedSources[source] = struct{}{}
+
+		var ids []types.TransactionID
+		for id, s := range tp.transactionSources {
+			if s == source {
+				ids = append(ids, id)
+			}
+		}
+		for _, id := range ids {
+			// The transaction may already have been evicted as a dependent
+			// of another transaction from the same source.
+			if _, exists := tp.findTransactionSet(id); exists {
+				tp.evictTransaction(id, txnFn)
+			}
+		}
+		if len(ids) > 0 {
+			tp.log.Printf("quarantined source %v, evicting %v of its transactions\n", source, len(ids))
+			tp.updateSubscribersTransactions()
+		}
+		return nil
+	})
+}
+
+// UnquarantineSource allows the provided source to submit transaction sets
+// again. Transactions that were removed by QuarantineSource are not restored.
+func (tp *TransactionPool) UnquarantineSource(source string) {
+	if err := tp.tg.Add(); err != nil {
+		return
+	}
+	defer tp.tg.Done()
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	delete(tp.quarantinedSources, source)
+}
@@ -0,0 +1,99 @@
+package transactionpool
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestQuarantineSource checks that quarantining a source removes the
+// transactions it submitted and their dependents, and refuses the sets it
+// submits until it is unquarantined.
+func TestQuarantineSource(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	tpt, err := createTpoolTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tpt.Close()
+
+	value := types.SiacoinPrecision.Mul64(100)
+	outputs := make([]types.SiacoinOutput, 2)
+	for i := range outputs {
+		outputs[i] = types.SiacoinOutput{Value: value, UnlockHash: types.UnlockConditions{}.UnlockHash()}
+	}
+	txns, err := tpt.wallet.SendSiacoinsMulti(outputs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tpt.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parent := txns[len(txns)-1]
+	var chains [][]types.Transaction
+	for i := range parent.SiacoinOutputs {
+		if parent.SiacoinOutputs[i].UnlockHash != (types.UnlockConditions{}).UnlockHash() {
+			continue
+		}
+		graph, err := types.TransactionGraph(parent.SiacoinOutputID(uint64(i)), []types.TransactionGraphEdge{
+			{Dest: 1, Fee: types.SiacoinPrecision.Mul64(10), Source: 0, Value: types.SiacoinPrecision.Mul64(90)},
+			{Dest: 2, Fee: types.SiacoinPrecision.Mul64(10), Source: 1, Value: types.SiacoinPrecision.Mul64(80)},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		chains = append(chains, graph)
+	}
+
+	// In the first chain, the bad peer submits the child of a good parent. In
+	// the second chain, the bad peer submits the parent of a good child.
+	submissions := []struct {
+		source string
+		txn    types.Transaction
+	}{
+		{"good", chains[0][0]},
+		{"bad", chains[0][1]},
+		{"bad", chains[1][0]},
+		{"good", chains[1][1]},
+	}
+	for _, s := range submissions {
+		err = tpt.tpool.AcceptTransactionSetFrom(s.source, []types.Transaction{s.txn})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = tpt.tpool.QuarantineSource("bad")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, exists := tpt.tpool.Transaction(chains[0][0].ID()); !exists {
+		t.Fatal("parent submitted by a good source was removed")
+	}
+	for _, txn := range []types.Transaction{chains[0][1], chains[1][0], chains[1][1]} {
+		if _, _, exists := tpt.tpool.Transaction(txn.ID()); exists {
+			t.Fatal("transaction from or depending on a quarantined source was kept")
+		}
+	}
+
+	// The quarantined source cannot resubmit its transactions, but other
+	// sources can.
+	err = tpt.tpool.AcceptTransactionSetFrom("bad", []types.Transaction{chains[1][0]})
+	if err != errQuarantined {
+		t.Fatal("expected errQuarantined, got", err)
+	}
+	err = tpt.tpool.AcceptTransactionSetFrom("good", []types.Transaction{chains[1][0]})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Once unquarantined, the source may submit transactions again.
+	tpt.tpool.UnquarantineSource("bad")
+	err = tpt.tpool.AcceptTransactionSetFrom("bad", []types.Transaction{chains[1][1]})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,128 @@
+package transactionpool
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+
+	"github.com/NebulousLabs/errors"
+)
+
+var (
+	errInvalidSourceBurst     = errors.New("source burst must be at least 1 when rate limiting is enabled")
+	errInvalidSourceRateLimit = errors.New("source rate limit must be a positive number, or zero to disable rate limiting")
+)
+
+type (
+	// tokenBucket tracks how many transaction sets a single source may
+	// currently submit.
+	tokenBucket struct {
+		tokens float64
+		last   time.Time
+	}
+
+	// sourceLimiter is a token bucket rate limiter keyed by the source of a
+	// transaction set. Each source may submit up to burst sets at once, and
+	// regains rate sets per second after that. A rate of zero disables the
+	// limiter.
+	sourceLimiter struct {
+		rate      float64
+		burst     int
+		buckets   map[string]*tokenBucket
+		lastPrune time.Time
+		mu        sync.Mutex
+	}
+)
+
+// newSourceLimiter returns a disabled sourceLimiter.
+func newSourceLimiter() *sourceLimiter {
+	return &sourceLimiter{
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+// limits returns the rate and burst of the limiter.
+func (sl *sourceLimiter) limits() (float64, int) {
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+	return sl.rate, sl.burst
+}
+
+// setLimits updates the rate and burst of the limiter. Existing sources keep
+// their current number of tokens. A rate of zero disables the limiter, in
+// which case the burst is ignored.
+func (sl *sourceLimiter) setLimits(rate float64, burst int) error {
+	if rate < 0 || math.IsNaN(rate) || math.IsInf(rate, 0) {
+		return errInvalidSourceRateLimit
+	}
+	if rate > 0 && burst < 1 {
+		return errInvalidSourceBurst
+	}
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+	sl.rate = rate
+	sl.burst = burst
+	if rate == 0 {
+		sl.buckets = make(map[string]*tokenBucket)
+	}
+	return nil
+}
+
+// allow takes a token from the bucket of the provided source, returning false
+// if the source has no tokens left.
+func (sl *sourceLimiter) allow(source string, now time.Time) bool {
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+	if sl.rate <= 0 {
+		return true
+	}
+	if now.Sub(sl.lastPrune) > rateLimitPruneInterval {
+		sl.prune(now)
+	}
+
+	b, exists := sl.buckets[source]
+	if !exists {
+		b = &tokenBucket{tokens: float64(sl.burst), last: now}
+		sl.buckets[source] = b
+	}
+	b.tokens += now.Sub(b.last).Seconds() * sl.rate
+	if b.tokens > float64(sl.burst) {
+		b.tokens = float64(sl.burst)
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// prune removes the buckets of sources that have been idle long enough for
+// their bucket to refill completely. Such a source is indistinguishable from
+// a source that has never been seen.
+func (sl *sourceLimiter) prune(now time.Time) {
+	for source, b := range sl.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*sl.rate >= float64(sl.burst) {
+			delete(sl.buckets, source)
+		}
+	}
+	sl.lastPrune = now
+}
+
+// AcceptTransactionSetFrom is the same as AcceptTransactionSet, but first
+// checks the rate limit of the provided source, which identifies the
+// submitter of the transaction set, such as a peer's IP address. Sets from a
+// source that has exceeded its rate limit are rejected without being
+// validated. Rate limiting is disabled unless SourceRateLimit is set in the
+// transaction pool's settings. Accepted transactions are recorded as having
+// been relayed by the network, and as having been submitted by the source.
+// Sets from a quarantined source are refused, see QuarantineSource.
+func (tp *TransactionPool) AcceptTransactionSetFrom(source string, ts []types.Transaction) error {
+	if !tp.limiter.allow(source, time.Now()) {
+		return modules.ErrRateLimited
+	}
+	return tp.managedAcceptTransactionSet(ts, PriorityNormal, OriginNetwork, source)
+}
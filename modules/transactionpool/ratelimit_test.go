@@ -0,0 +1,149 @@
+package transactionpool
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestSourceLimiterBurst checks that a source may submit up to its burst at
+// once, and that sources are limited independently.
+func TestSourceLimiterBurst(t *testing.T) {
+	sl := newSourceLimiter()
+	now := time.Now()
+
+	// A disabled limiter allows everything.
+	for i := 0; i < 100; i++ {
+		if !sl.allow("a", now) {
+			t.Fatal("disabled limiter rejected a submission")
+		}
+	}
+
+	sl.setLimits(1, 5)
+	for i := 0; i < 5; i++ {
+		if !sl.allow("a", now) {
+			t.Fatal("submission within the burst was rejected:", i)
+		}
+	}
+	if sl.allow("a", now) {
+		t.Fatal("submission beyond the burst was allowed")
+	}
+	if !sl.allow("b", now) {
+		t.Fatal("a different source was limited")
+	}
+}
+
+// TestSourceLimiterSustained checks that a source that has exhausted its burst
+// regains tokens at the configured rate, and that idle sources are pruned.
+func TestSourceLimiterSustained(t *testing.T) {
+	sl := newSourceLimiter()
+	sl.setLimits(2, 2)
+	now := time.Now()
+	sl.allow("a", now)
+	sl.allow("a", now)
+	if sl.allow("a", now) {
+		t.Fatal("submission beyond the burst was allowed")
+	}
+
+	// Submitting steadily at the rate limit should always be allowed, but
+	// submitting faster should not.
+	for i := 0; i < 10; i++ {
+		now = now.Add(time.Second / 2)
+		if !sl.allow("a", now) {
+			t.Fatal("submission at the sustained rate was rejected:", i)
+		}
+	}
+	now = now.Add(time.Second / 4)
+	if sl.allow("a", now) {
+		t.Fatal("submission above the sustained rate was allowed")
+	}
+
+	// After being idle, the source should be pruned.
+	now = now.Add(rateLimitPruneInterval + time.Second)
+	sl.allow("b", now)
+	if _, exists := sl.buckets["a"]; exists {
+		t.Fatal("idle source was not pruned")
+	}
+}
+
+// TestSourceLimiterInvalidLimits checks that setLimits rejects limits that
+// would block every submission, and leaves the limiter unchanged.
+func TestSourceLimiterInvalidLimits(t *testing.T) {
+	sl := newSourceLimiter()
+	err := sl.setLimits(2, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		rate  float64
+		burst int
+		err   error
+	}{
+		{1, 0, errInvalidSourceBurst},
+		{1, -1, errInvalidSourceBurst},
+		{-1, 1, errInvalidSourceRateLimit},
+		{math.NaN(), 1, errInvalidSourceRateLimit},
+		{math.Inf(1), 1, errInvalidSourceRateLimit},
+	}
+	for _, test := range tests {
+		err := sl.setLimits(test.rate, test.burst)
+		if err != test.err {
+			t.Errorf("setLimits(%v, %v): expected %v, got %v", test.rate, test.burst, test.err, err)
+		}
+	}
+	if rate, burst := sl.limits(); rate != 2 || burst != 3 {
+		t.Fatal("invalid limits were applied:", rate, burst)
+	}
+
+	// A rate of zero disables the limiter, regardless of the burst.
+	err = sl.setLimits(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestAcceptTransactionSetFrom checks that AcceptTransactionSetFrom rejects
+// transaction sets from a source that has exceeded its rate limit.
+func TestAcceptTransactionSetFrom(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	tpt, err := createTpoolTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tpt.Close()
+
+	err = tpt.tpool.SetSettings(modules.TransactionPoolSettings{
+		SourceBurst:     1,
+		SourceRateLimit: 1e-6,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tpt.tpool.AcceptTransactionSetFrom("peer", []types.Transaction{{ArbitraryData: [][]byte{modules.PrefixNonSia[:]}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tpt.tpool.AcceptTransactionSetFrom("peer", []types.Transaction{{ArbitraryData: [][]byte{append(modules.PrefixNonSia[:], 1)}}})
+	if err != modules.ErrRateLimited {
+		t.Fatal("expected modules.ErrRateLimited, got", err)
+	}
+	settings, err := tpt.tpool.Settings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settings.SourceBurst != 1 || settings.SourceRateLimit != 1e-6 {
+		t.Fatal("rate limit settings were not stored:", settings)
+	}
+
+	// Settings that would reject every submission are refused.
+	settings.SourceBurst = 0
+	err = tpt.tpool.SetSettings(settings)
+	if err != errInvalidSourceBurst {
+		t.Fatal("expected errInvalidSourceBurst, got", err)
+	}
+}
@@ -0,0 +1,130 @@
+package transactionpool
+
+import (
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// A ReconcileStatus describes how a transaction in a confirmed block relates
+// to the transaction pool at the time the block was applied. The values are
+// strings so that serialized reports remain readable and stable.
+type ReconcileStatus string
+
+const (
+	// ReconcileKnown marks block transactions that were in the pool.
+	ReconcileKnown ReconcileStatus = "known"
+	// ReconcileUnknown marks block transactions that arrived out-of-band,
+	// without passing through the pool.
+	ReconcileUnknown ReconcileStatus = "unknown"
+	// ReconcileConflicting marks block transactions that were not in the pool
+	// and that spend an object which an unconfirmed transaction also spends.
+	ReconcileConflicting ReconcileStatus = "conflicting"
+)
+
+type (
+	// A ReconciledTransaction is the status of a single block transaction.
+	ReconciledTransaction struct {
+		ID     types.TransactionID
+		Status ReconcileStatus
+	}
+
+	// A BlockReconciliation reports what a confirmed block did to the
+	// transaction pool. Transactions lists every transaction of the block in
+	// block order. Confirmed holds the ids of the unconfirmed transactions
+	// that the block confirmed, and Evicted holds the ids of the unconfirmed
+	// transactions that conflict with the block and are therefore removed
+	// from the pool.
+	BlockReconciliation struct {
+		BlockID      types.BlockID
+		Height       types.BlockHeight
+		Transactions []ReconciledTransaction
+		Confirmed    []types.TransactionID
+		Evicted      []types.TransactionID
+	}
+)
+
+// reconcileBlock builds the reconciliation report of a block at the provided
+// height. It has to be called before the block is applied to the pool.
+func (tp *TransactionPool) reconcileBlock(block types.Block, height types.BlockHeight) BlockReconciliation {
+	known, _, conflicting := tp.classifyBlock(block.Transactions)
+	status := make(map[types.TransactionID]ReconcileStatus)
+	for _, txn := range known {
+		status[txn.ID()] = ReconcileKnown
+	}
+	for _, txn := range conflicting {
+		status[txn.ID()] = ReconcileConflicting
+	}
+
+	br := BlockReconciliation{
+		BlockID: block.ID(),
+		Height:  height,
+	}
+	for _, txn := range block.Transactions {
+		s, exists := status[txn.ID()]
+		if !exists {
+			s = ReconcileUnknown
+		}
+		br.Transactions = append(br.Transactions, ReconciledTransaction{
+			ID:     txn.ID(),
+			Status: s,
+		})
+		if s == ReconcileKnown {
+			br.Confirmed = append(br.Confirmed, txn.ID())
+		}
+	}
+	for _, txn := range tp.conflictsWithBlock(block.Transactions) {
+		br.Evicted = append(br.Evicted, txn.ID())
+	}
+	return br
+}
+
+// recordReconciliation stores the reconciliation report of an applied block,
+// dropping the report of the oldest block if the ring is full.
+func (tp *TransactionPool) recordReconciliation(br BlockReconciliation) {
+	if _, exists := tp.blockReconciliations[br.BlockID]; exists {
+		tp.forgetReconciliation(br.BlockID)
+	}
+	tp.blockReconciliations[br.BlockID] = br
+	tp.reconciledBlocks = append(tp.reconciledBlocks, br.BlockID)
+	if len(tp.reconciledBlocks) > maxBlockReconciliations {
+		delete(tp.blockReconciliations, tp.reconciledBlocks[0])
+		tp.reconciledBlocks = tp.reconciledBlocks[1:]
+	}
+}
+
+// forgetReconciliation removes the reconciliation report of a block, which is
+// done when the block is reverted.
+func (tp *TransactionPool) forgetReconciliation(id types.BlockID) {
+	if _, exists := tp.blockReconciliations[id]; !exists {
+		return
+	}
+	delete(tp.blockReconciliations, id)
+	for i := range tp.reconciledBlocks {
+		if tp.reconciledBlocks[i] == id {
+			tp.reconciledBlocks = append(tp.reconciledBlocks[:i], tp.reconciledBlocks[i+1:]...)
+			break
+		}
+	}
+}
+
+// BlockReconciliation returns the reconciliation report of a recently applied
+// block. False is returned if the block is not in the current chain or if its
+// report has been dropped.
+func (tp *TransactionPool) BlockReconciliation(id types.BlockID) (BlockReconciliation, bool) {
+	tp.mu.RLock()
+	defer tp.mu.RUnlock()
+	br, exists := tp.blockReconciliations[id]
+	return br, exists
+}
+
+// BlockReconciliations returns the reconciliation reports of the most
+// recently applied blocks, oldest first. At most maxBlockReconciliations
+// reports are kept, and the reports of reverted blocks are dropped.
+func (tp *TransactionPool) BlockReconciliations() []BlockReconciliation {
+	tp.mu.RLock()
+	defer tp.mu.RUnlock()
+	reports := make([]BlockReconciliation, 0, len(tp.reconciledBlocks))
+	for _, id := range tp.reconciledBlocks {
+		reports = append(reports, tp.blockReconciliations[id])
+	}
+	return reports
+}
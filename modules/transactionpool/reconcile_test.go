@@ -0,0 +1,145 @@
+package transactionpool
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestBlockReconciliations checks the reconciliation report of a block that
+// mixes transactions from the pool with transactions that arrived
+// out-of-band.
+func TestBlockReconciliations(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	tpt, err := createTpoolTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tpt.Close()
+
+	value := types.SiacoinPrecision.Mul64(100)
+	outputs := make([]types.SiacoinOutput, 3)
+	for i := range outputs {
+		outputs[i] = types.SiacoinOutput{Value: value, UnlockHash: types.UnlockConditions{}.UnlockHash()}
+	}
+	txns, err := tpt.wallet.SendSiacoinsMulti(outputs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tpt.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parent := txns[len(txns)-1]
+	var spends []types.Transaction
+	for i := range parent.SiacoinOutputs {
+		if parent.SiacoinOutputs[i].UnlockHash != (types.UnlockConditions{}).UnlockHash() {
+			continue
+		}
+		for _, fee := range []uint64{10, 20} {
+			graph, err := types.TransactionGraph(parent.SiacoinOutputID(uint64(i)), []types.TransactionGraphEdge{{
+				Dest:   1,
+				Fee:    types.SiacoinPrecision.Mul64(fee),
+				Source: 0,
+				Value:  value.Sub(types.SiacoinPrecision.Mul64(fee)),
+			}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			spends = append(spends, graph[0])
+		}
+	}
+	known, doubleSpent, conflicting, unknown := spends[0], spends[2], spends[3], spends[4]
+	for _, txn := range []types.Transaction{known, doubleSpent} {
+		err = tpt.tpool.AcceptTransactionSet([]types.Transaction{txn})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	blockTxns := []types.Transaction{unknown, known, conflicting}
+	err = tpt.mineTransactions(blockTxns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reports := tpt.tpool.BlockReconciliations()
+	if len(reports) == 0 {
+		t.Fatal("expected a report of the mined block")
+	}
+	br := reports[len(reports)-1]
+	if br.BlockID != tpt.cs.CurrentBlock().ID() || br.Height != tpt.cs.Height() {
+		t.Error("report does not describe the mined block")
+	}
+	expected := []ReconcileStatus{ReconcileUnknown, ReconcileKnown, ReconcileConflicting}
+	if len(br.Transactions) != len(expected) {
+		t.Fatalf("expected %v transactions, got %v", len(expected), len(br.Transactions))
+	}
+	for i, rt := range br.Transactions {
+		if rt.ID != blockTxns[i].ID() || rt.Status != expected[i] {
+			t.Errorf("transaction %v: expected %v, got %v", i, expected[i], rt.Status)
+		}
+	}
+	if len(br.Confirmed) != 1 || br.Confirmed[0] != known.ID() {
+		t.Error("expected the known transaction to be confirmed:", br.Confirmed)
+	}
+	if len(br.Evicted) != 1 || br.Evicted[0] != doubleSpent.ID() {
+		t.Error("expected the double spent transaction to be evicted:", br.Evicted)
+	}
+
+	// The next block adds a report, and the earlier report can still be
+	// looked up by its block id.
+	_, err = tpt.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	reports = tpt.tpool.BlockReconciliations()
+	if len(reports) < 2 || reports[len(reports)-1].BlockID != tpt.cs.CurrentBlock().ID() || reports[len(reports)-2].BlockID != br.BlockID {
+		t.Fatal("expected the report of the next block to follow the earlier report")
+	}
+	next := reports[len(reports)-1]
+	if len(next.Confirmed) != 0 || len(next.Evicted) != 0 {
+		t.Error("next block should not have changed the pool:", next)
+	}
+	earlier, exists := tpt.tpool.BlockReconciliation(br.BlockID)
+	if !exists || len(earlier.Confirmed) != 1 || earlier.Confirmed[0] != known.ID() {
+		t.Error("earlier report could not be looked up by block id")
+	}
+}
+
+// TestBlockReconciliationsRing checks that only the reports of the most
+// recent blocks are kept, and that the reports of reverted blocks are
+// dropped.
+func TestBlockReconciliationsRing(t *testing.T) {
+	tp := &TransactionPool{
+		blockReconciliations: make(map[types.BlockID]BlockReconciliation),
+	}
+	ids := make([]types.BlockID, maxBlockReconciliations+2)
+	for i := range ids {
+		ids[i][0], ids[i][1] = byte(i), byte(i>>8)
+		tp.recordReconciliation(BlockReconciliation{BlockID: ids[i], Height: types.BlockHeight(i)})
+	}
+	reports := tp.BlockReconciliations()
+	if len(reports) != maxBlockReconciliations {
+		t.Fatalf("expected %v reports, got %v", maxBlockReconciliations, len(reports))
+	}
+	for i, br := range reports {
+		if br.BlockID != ids[i+2] {
+			t.Fatalf("report %v is out of order", i)
+		}
+	}
+	if _, exists := tp.BlockReconciliation(ids[1]); exists {
+		t.Error("oldest report was not dropped")
+	}
+
+	// Revert the most recent block.
+	tp.forgetReconciliation(ids[len(ids)-1])
+	if _, exists := tp.BlockReconciliation(ids[len(ids)-1]); exists {
+		t.Error("report of the reverted block was not dropped")
+	}
+	reports = tp.BlockReconciliations()
+	if len(reports) != maxBlockReconciliations-1 || reports[len(reports)-1].BlockID != ids[len(ids)-2] {
+		t.Error("unexpected reports after reverting a block")
+	}
+}
@@ -0,0 +1,254 @@
+package transactionpool
+
+import (
+	"errors"
+	"time"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// A poolState holds a copy of the state that accepting a transaction set can
+// modify, so that the change can be rolled back. The transaction sets
+// themselves are never modified in place, so only the maps are copied. The
+// metadata of the transactions is copied as well, since re-adding the
+// transactions that are removed during a replacement records their heights and
+// arrivals, and their outputs as appeared objects.
+type poolState struct {
+	knownObjects         map[ObjectID]TransactionSetID
+	transactionSets      map[TransactionSetID][]types.Transaction
+	transactionSetIDs    map[types.TransactionID]TransactionSetID
+	transactionSizes     map[types.TransactionID]int
+	transactionSetDiffs  map[TransactionSetID]*modules.ConsensusChange
+	transactionListSize  int
+	transactionListFees  types.Currency
+	transactionListValue types.Currency
+	poolFingerprint      uint64
+
+	timelockedSets          map[TransactionSetID]timelockedSet
+	timelockedSetsSize      int
+	orphanSets              map[TransactionSetID]orphanSet
+	orphanSetsSize          int
+	orphanParents           map[ObjectID]map[TransactionSetID]struct{}
+	proofSets               map[TransactionSetID]proofSet
+	proofSetsSize           int
+	unsyncedSets            map[TransactionSetID]unsyncedSet
+	unsyncedSetsSize        int
+	pendingReplacements     map[TransactionSetID]pendingReplacement
+	pendingReplacementsSize int
+	replacementCounts       map[ObjectID]int
+	doubleSpends            map[ObjectID]struct{}
+
+	appearedObjects       []ObjectID
+	pinnedTransactions    map[types.TransactionID]struct{}
+	transactionArrivals   map[types.TransactionID]time.Time
+	transactionHeights    map[types.TransactionID]types.BlockHeight
+	transactionOrigins    map[types.TransactionID]Origin
+	transactionSources    map[types.TransactionID]string
+	transactionPriorities map[types.TransactionID]Priority
+	unverified            map[types.TransactionID]struct{}
+}
+
+// saveState returns a copy of the current state of the unconfirmed set, of the
+// held transaction sets, and of the metadata of the transactions.
+func (tp *TransactionPool) saveState() poolState {
+	ps := poolState{
+		knownObjects:         make(map[ObjectID]TransactionSetID, len(tp.knownObjects)),
+		transactionSets:      make(map[TransactionSetID][]types.Transaction, len(tp.transactionSets)),
+		transactionSetIDs:    make(map[types.TransactionID]TransactionSetID, len(tp.transactionSetIDs)),
+		transactionSizes:     make(map[types.TransactionID]int, len(tp.transactionSizes)),
+		transactionSetDiffs:  make(map[TransactionSetID]*modules.ConsensusChange, len(tp.transactionSetDiffs)),
+		transactionListSize:  tp.transactionListSize,
+		transactionListFees:  tp.transactionListFees,
+		transactionListValue: tp.transactionListValue,
+		poolFingerprint:      tp.poolFingerprint,
+
+		timelockedSets:          make(map[TransactionSetID]timelockedSet, len(tp.timelockedSets)),
+		timelockedSetsSize:      tp.timelockedSetsSize,
+		orphanSets:              make(map[TransactionSetID]orphanSet, len(tp.orphanSets)),
+		orphanSetsSize:          tp.orphanSetsSize,
+		orphanParents:           make(map[ObjectID]map[TransactionSetID]struct{}, len(tp.orphanParents)),
+		proofSets:               make(map[TransactionSetID]proofSet, len(tp.proofSets)),
+		proofSetsSize:           tp.proofSetsSize,
+		unsyncedSets:            make(map[TransactionSetID]unsyncedSet, len(tp.unsyncedSets)),
+		unsyncedSetsSize:        tp.unsyncedSetsSize,
+		pendingReplacements:     make(map[TransactionSetID]pendingReplacement, len(tp.pendingReplacements)),
+		pendingReplacementsSize: tp.pendingReplacementsSize,
+		replacementCounts:       make(map[ObjectID]int, len(tp.replacementCounts)),
+		doubleSpends:            make(map[ObjectID]struct{}, len(tp.doubleSpends)),
+
+		appearedObjects:       append([]ObjectID(nil), tp.appearedObjects...),
+		pinnedTransactions:    make(map[types.TransactionID]struct{}, len(tp.pinnedTransactions)),
+		transactionArrivals:   make(map[types.TransactionID]time.Time, len(tp.transactionArrivals)),
+		transactionHeights:    make(map[types.TransactionID]types.BlockHeight, len(tp.transactionHeights)),
+		transactionOrigins:    make(map[types.TransactionID]Origin, len(tp.transactionOrigins)),
+		transactionSources:    make(map[types.TransactionID]string, len(tp.transactionSources)),
+		transactionPriorities: make(map[types.TransactionID]Priority, len(tp.transactionPriorities)),
+		unverified:            make(map[types.TransactionID]struct{}, len(tp.unverified)),
+	}
+	for k, v := range tp.knownObjects {
+		ps.knownObjects[k] = v
+	}
+	for k, v := range tp.transactionSets {
+		ps.transactionSets[k] = v
+	}
+	for k, v := range tp.transactionSetIDs {
+		ps.transactionSetIDs[k] = v
+	}
+	for k, v := range tp.transactionSizes {
+		ps.transactionSizes[k] = v
+	}
+	for k, v := range tp.transactionSetDiffs {
+		ps.transactionSetDiffs[k] = v
+	}
+	for k, v := range tp.timelockedSets {
+		ps.timelockedSets[k] = v
+	}
+	for k, v := range tp.orphanSets {
+		ps.orphanSets[k] = v
+	}
+	for k, v := range tp.orphanParents {
+		setIDs := make(map[TransactionSetID]struct{}, len(v))
+		for setID := range v {
+			setIDs[setID] = struct{}{}
+		}
+		ps.orphanParents[k] = setIDs
+	}
+	for k, v := range tp.proofSets {
+		ps.proofSets[k] = v
+	}
+	for k, v := range tp.unsyncedSets {
+		ps.unsyncedSets[k] = v
+	}
+	for k, v := range tp.pendingReplacements {
+		ps.pendingReplacements[k] = v
+	}
+	for k, v := range tp.replacementCounts {
+		ps.replacementCounts[k] = v
+	}
+	for k := range tp.doubleSpends {
+		ps.doubleSpends[k] = struct{}{}
+	}
+	for k := range tp.pinnedTransactions {
+		ps.pinnedTransactions[k] = struct{}{}
+	}
+	for k, v := range tp.transactionArrivals {
+		ps.transactionArrivals[k] = v
+	}
+	for k, v := range tp.transactionHeights {
+		ps.transactionHeights[k] = v
+	}
+	for k, v := range tp.transactionOrigins {
+		ps.transactionOrigins[k] = v
+	}
+	for k, v := range tp.transactionSources {
+		ps.transactionSources[k] = v
+	}
+	for k, v := range tp.transactionPriorities {
+		ps.transactionPriorities[k] = v
+	}
+	for k := range tp.unverified {
+		ps.unverified[k] = struct{}{}
+	}
+	return ps
+}
+
+// restoreState rolls the unconfirmed set, the held transaction sets, and the
+// metadata of the transactions back to a state returned by saveState.
+func (tp *TransactionPool) restoreState(ps poolState) {
+	tp.knownObjects = ps.knownObjects
+	tp.transactionSets = ps.transactionSets
+	tp.transactionSetIDs = ps.transactionSetIDs
+	tp.transactionSizes = ps.transactionSizes
+	tp.transactionSetDiffs = ps.transactionSetDiffs
+	tp.transactionListSize = ps.transactionListSize
+	tp.transactionListFees = ps.transactionListFees
+	tp.transactionListValue = ps.transactionListValue
+	tp.poolFingerprint = ps.poolFingerprint
+	tp.timelockedSets = ps.timelockedSets
+	tp.timelockedSetsSize = ps.timelockedSetsSize
+	tp.orphanSets = ps.orphanSets
+	tp.orphanSetsSize = ps.orphanSetsSize
+	tp.orphanParents = ps.orphanParents
+	tp.proofSets = ps.proofSets
+	tp.proofSetsSize = ps.proofSetsSize
+	tp.unsyncedSets = ps.unsyncedSets
+	tp.unsyncedSetsSize = ps.unsyncedSetsSize
+	tp.pendingReplacements = ps.pendingReplacements
+	tp.pendingReplacementsSize = ps.pendingReplacementsSize
+	tp.replacementCounts = ps.replacementCounts
+	tp.doubleSpends = ps.doubleSpends
+	tp.appearedObjects = ps.appearedObjects
+	tp.pinnedTransactions = ps.pinnedTransactions
+	tp.transactionArrivals = ps.transactionArrivals
+	tp.transactionHeights = ps.transactionHeights
+	tp.transactionOrigins = ps.transactionOrigins
+	tp.transactionSources = ps.transactionSources
+	tp.transactionPriorities = ps.transactionPriorities
+	tp.unverified = ps.unverified
+	tp.unconfirmedVersion++
+}
+
+// ReplaceSet atomically removes the transactions with the provided ids, along
+// with any transactions that depend on them, and accepts the provided
+// transaction set in their place. If the new set is not accepted, for any
+// reason, the pool is rolled back to its previous state and the error is
+// returned, so other callers never observe a pool that is missing the old
+// transactions without containing the new ones. A new set that would be held,
+// for example because it is timelocked, is treated as not accepted.
+// errTransactionNotFound is returned if one of the transactions to remove is
+// not in the pool.
+func (tp *TransactionPool) ReplaceSet(evict []types.TransactionID, accept []types.Transaction) error {
+	if err := tp.tg.Add(); err != nil {
+		return err
+	}
+	defer tp.tg.Done()
+	cs, ok := tp.consensusSet.(interface {
+		LockedTryTransactionSet(fn func(func(txns []types.Transaction) (modules.ConsensusChange, error)) error) error
+	})
+	if !ok {
+		return errors.New("consensus set does not support LockedTryTransactionSet method")
+	}
+
+	return cs.LockedTryTransactionSet(func(txnFn func(txns []types.Transaction) (modules.ConsensusChange, error)) error {
+		tp.mu.Lock()
+		defer tp.mu.Unlock()
+		for _, id := range evict {
+			if _, exists := tp.findTransactionSet(id); !exists {
+				return errTransactionNotFound
+			}
+		}
+
+		saved := tp.saveState()
+		var removed []types.Transaction
+		for _, id := range evict {
+			removed = append(removed, tp.removeTransaction(id, txnFn)...)
+		}
+		err := tp.acceptTransactionSet(accept, txnFn)
+		if err != nil {
+			tp.restoreState(saved)
+			return err
+		}
+
+		// The swap succeeded, so the removed transactions that are not part
+		// of the new set have left the pool.
+		accepted := make(map[types.TransactionID]struct{})
+		for _, txn := range accept {
+			accepted[txn.ID()] = struct{}{}
+		}
+		for _, txn := range removed {
+			if _, exists := accepted[txn.ID()]; !exists {
+				tp.forgetTransaction(txn.ID())
+				tp.events.LogEvict(transactionEvent(txn))
+			}
+		}
+		tp.setOrigin(accept, OriginLocal)
+		for _, txn := range accept {
+			tp.events.LogAccept(transactionEvent(txn))
+		}
+		go tp.gateway.Broadcast("RelayTransactionSet", accept, tp.gateway.Peers())
+		tp.promoteOrphanSets(txnFn)
+		tp.updateSubscribersTransactions()
+		return nil
+	})
+}
@@ -0,0 +1,163 @@
+package transactionpool
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestReplaceSet checks that ReplaceSet swaps transactions atomically, and
+// rolls the pool back when the new set is rejected.
+func TestReplaceSet(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	tpt, err := createTpoolTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tpt.Close()
+
+	txns, err := tpt.wallet.SendSiacoins(types.SiacoinPrecision.Mul64(100), types.UnlockConditions{}.UnlockHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := txns[len(txns)-1].SiacoinOutputID(0)
+	_, err = tpt.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	spend := func(fee uint64) []types.Transaction {
+		graph, err := types.TransactionGraph(source, []types.TransactionGraphEdge{
+			{Dest: 1, Fee: types.SiacoinPrecision.Mul64(fee), Source: 0, Value: types.SiacoinPrecision.Mul64(100 - fee)},
+			{Dest: 2, Fee: types.SiacoinPrecision.Mul64(fee), Source: 1, Value: types.SiacoinPrecision.Mul64(100 - 2*fee)},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return graph
+	}
+
+	// Replace a chain with a double spend of its parent, which would be
+	// rejected by AcceptTransactionSet.
+	old, replacement := spend(10), spend(5)
+	err = tpt.tpool.AcceptTransactionSet(old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tpt.tpool.ReplaceSet([]types.TransactionID{old[0].ID()}, replacement)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, txn := range old {
+		if _, _, exists := tpt.tpool.Transaction(txn.ID()); exists {
+			t.Fatal("replaced transaction is still in the pool")
+		}
+	}
+	for _, txn := range replacement {
+		if _, _, exists := tpt.tpool.Transaction(txn.ID()); !exists {
+			t.Fatal("replacement is not in the pool")
+		}
+	}
+
+	// A replacement that is rejected should leave the pool untouched.
+	sizeBefore := tpt.tpool.transactionListSize
+	invalid := []types.Transaction{{
+		SiacoinInputs: []types.SiacoinInput{{ParentID: types.SiacoinOutputID{1}}},
+	}}
+	err = tpt.tpool.ReplaceSet([]types.TransactionID{replacement[0].ID()}, invalid)
+	if err == nil {
+		t.Fatal("invalid replacement was accepted")
+	}
+	for _, txn := range replacement {
+		if _, _, exists := tpt.tpool.Transaction(txn.ID()); !exists {
+			t.Fatal("failed replacement removed a transaction from the pool")
+		}
+	}
+	if tpt.tpool.transactionListSize != sizeBefore {
+		t.Fatal("failed replacement changed the size of the pool")
+	}
+	if _, exists := tpt.tpool.knownObjects[ObjectID(source)]; !exists {
+		t.Fatal("failed replacement unregistered the spent output")
+	}
+
+	// Unknown transactions cannot be replaced.
+	err = tpt.tpool.ReplaceSet([]types.TransactionID{{}}, invalid)
+	if err != errTransactionNotFound {
+		t.Fatal("expected errTransactionNotFound, got", err)
+	}
+}
+
+// TestReplaceSetRollback checks that a failed replacement restores the
+// metadata of the transactions along with the unconfirmed set.
+func TestReplaceSetRollback(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	tpt, err := createTpoolTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tpt.Close()
+
+	var graphs [][]types.Transaction
+	for i := 0; i < 3; i++ {
+		source, err := tpt.graphSource(types.SiacoinPrecision.Mul64(100))
+		if err != nil {
+			t.Fatal(err)
+		}
+		graph, err := types.TransactionGraph(source, []types.TransactionGraphEdge{
+			{Dest: 1, Fee: types.SiacoinPrecision.Mul64(10), Source: 0, Value: types.SiacoinPrecision.Mul64(90)},
+			{Dest: 2, Fee: types.SiacoinPrecision.Mul64(10), Source: 1, Value: types.SiacoinPrecision.Mul64(80)},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		graphs = append(graphs, graph)
+	}
+	err = tpt.tpool.SetSettings(modules.TransactionPoolSettings{HoldOrphanSets: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Add a set of two unrelated transactions, so that replacing one of them
+	// re-adds the other, and hold an orphan, so that re-adding the other
+	// records its outputs as appeared objects.
+	evicted, sibling := graphs[0][0], graphs[1][0]
+	err = tpt.tpool.AcceptTransactionSet([]types.Transaction{evicted, sibling})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tpt.tpool.AcceptTransactionSet([]types.Transaction{graphs[2][1]})
+	if err != errOrphanSetHeld {
+		t.Fatal("expected errOrphanSetHeld, got", err)
+	}
+	arrival := tpt.tpool.transactionArrivals[sibling.ID()]
+	appeared := len(tpt.tpool.appearedObjects)
+
+	invalid := []types.Transaction{{
+		SiacoinInputs: []types.SiacoinInput{{ParentID: types.SiacoinOutputID{1}}},
+	}}
+	err = tpt.tpool.ReplaceSet([]types.TransactionID{evicted.ID()}, invalid)
+	if err == nil {
+		t.Fatal("invalid replacement was accepted")
+	}
+	if len(tpt.tpool.transactionSets) != 1 {
+		t.Fatal("failed replacement did not restore the transaction set")
+	}
+	for _, txn := range []types.Transaction{evicted, sibling} {
+		if origin, exists := tpt.tpool.Origin(txn.ID()); !exists || origin != OriginLocal {
+			t.Fatal("failed replacement changed the origin of a transaction:", origin, exists)
+		}
+	}
+	if !tpt.tpool.transactionArrivals[sibling.ID()].Equal(arrival) {
+		t.Fatal("failed replacement changed the arrival of a transaction")
+	}
+	if len(tpt.tpool.appearedObjects) != appeared {
+		t.Fatal("failed replacement recorded appeared objects:", len(tpt.tpool.appearedObjects), appeared)
+	}
+	if _, exists := tpt.tpool.transactionHeights[invalid[0].ID()]; exists {
+		t.Fatal("failed replacement recorded the height of the rejected transaction")
+	}
+}
@@ -0,0 +1,127 @@
+package transactionpool
+
+import (
+	"sort"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+	"github.com/NebulousLabs/errors"
+)
+
+var (
+	errStaleRevision = errors.New("transaction set revises a file contract with a revision number that is not higher than a revision in the transaction pool")
+)
+
+// revisionNumbers returns the highest revision number that the provided
+// transactions assign to each file contract they revise.
+func revisionNumbers(ts []types.Transaction) map[types.FileContractID]uint64 {
+	numbers := make(map[types.FileContractID]uint64)
+	for _, txn := range ts {
+		for _, fcr := range txn.FileContractRevisions {
+			if n, exists := numbers[fcr.ParentID]; !exists || fcr.NewRevisionNumber > n {
+				numbers[fcr.ParentID] = fcr.NewRevisionNumber
+			}
+		}
+	}
+	return numbers
+}
+
+// supersededRevisions returns the ids of the transactions in the conflicting
+// sets that revise a file contract which the provided transaction set revises
+// with a higher revision number. Transactions that appear in both are
+// ignored. errStaleRevision is returned if the pool already contains a
+// revision that is at least as high as one of the revisions in the set.
+func (tp *TransactionPool) supersededRevisions(ts []types.Transaction, conflicts []TransactionSetID) ([]types.TransactionID, error) {
+	numbers := revisionNumbers(ts)
+	if len(numbers) == 0 {
+		return nil, nil
+	}
+	// Transactions that are part of the set are duplicates, not revisions to
+	// be superseded.
+	ids := make(map[types.TransactionID]struct{})
+	for _, txn := range ts {
+		ids[txn.ID()] = struct{}{}
+	}
+	var superseded []types.TransactionID
+	for _, conflict := range conflicts {
+		for _, txn := range tp.transactionSets[conflict] {
+			if _, exists := ids[txn.ID()]; exists {
+				continue
+			}
+			supersedes := false
+			for _, fcr := range txn.FileContractRevisions {
+				n, exists := numbers[fcr.ParentID]
+				if !exists {
+					continue
+				}
+				if fcr.NewRevisionNumber >= n {
+					return nil, errStaleRevision
+				}
+				supersedes = true
+			}
+			if supersedes {
+				superseded = append(superseded, txn.ID())
+			}
+		}
+	}
+	return superseded, nil
+}
+
+// replaceRevisions evicts the provided superseded revision transactions, along
+// with any transactions that depend on them, and then adds the transaction set
+// that supersedes them. The transaction set has to be valid on its own, so
+// that the superseded revisions are not evicted for a set that cannot be
+// accepted. If the set is not accepted after all, the pool is rolled back to
+// its previous state.
+func (tp *TransactionPool) replaceRevisions(ts []types.Transaction, superseded []types.TransactionID, txnFn func([]types.Transaction) (modules.ConsensusChange, error)) error {
+	_, err := tp.validate(ts, txnFn)
+	if err != nil {
+		return modules.NewConsensusConflict("provided revision supersedes revisions in the transaction pool, but is invalid on its own: " + err.Error())
+	}
+	saved := tp.saveState()
+	var removed []types.Transaction
+	for _, id := range superseded {
+		removed = append(removed, tp.removeTransaction(id, txnFn)...)
+	}
+	err = tp.acceptTransactionSet(ts, txnFn)
+	if err != nil {
+		tp.restoreState(saved)
+		return err
+	}
+
+	accepted := make(map[types.TransactionID]struct{})
+	for _, txn := range ts {
+		accepted[txn.ID()] = struct{}{}
+	}
+	for _, txn := range removed {
+		if _, exists := accepted[txn.ID()]; !exists {
+			tp.forgetTransaction(txn.ID())
+			tp.events.LogEvict(transactionEvent(txn))
+		}
+	}
+	tp.log.Debugf("replaced %v superseded file contract revisions\n", len(superseded))
+	tp.metrics.addReplacement()
+	return nil
+}
+
+// ContractRevisions returns the transactions in the transaction pool that
+// revise the file contract with the provided id, sorted by revision number
+// from lowest to highest. Revisions with a higher revision number replace the
+// revisions in the pool, so usually at most one transaction is returned.
+func (tp *TransactionPool) ContractRevisions(id types.FileContractID) []types.Transaction {
+	tp.mu.RLock()
+	defer tp.mu.RUnlock()
+
+	var revisions []types.Transaction
+	for _, tSet := range tp.transactionSets {
+		for _, txn := range tSet {
+			if _, exists := revisionNumbers([]types.Transaction{txn})[id]; exists {
+				revisions = append(revisions, txn)
+			}
+		}
+	}
+	sort.Slice(revisions, func(i, j int) bool {
+		return revisionNumbers(revisions[i : i+1])[id] < revisionNumbers(revisions[j : j+1])[id]
+	})
+	return revisions
+}
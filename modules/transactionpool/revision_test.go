@@ -0,0 +1,188 @@
+package transactionpool
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestContractRevisions checks that a revision of a file contract replaces
+// the revisions with lower revision numbers in the transaction pool, and that
+// revisions which do not increase the revision number are rejected.
+func TestContractRevisions(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	tpt, err := createTpoolTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tpt.Close()
+
+	// Create and confirm a file contract that anyone can revise.
+	payout := types.NewCurrency64(1e9)
+	height := tpt.cs.Height()
+	fc := types.FileContract{
+		WindowStart:        height + 10,
+		WindowEnd:          height + 20,
+		Payout:             payout,
+		ValidProofOutputs:  []types.SiacoinOutput{{Value: types.PostTax(height, payout)}},
+		MissedProofOutputs: []types.SiacoinOutput{{Value: types.PostTax(height, payout)}},
+		UnlockHash:         types.UnlockConditions{}.UnlockHash(),
+	}
+	builder, err := tpt.wallet.StartTransaction()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = builder.FundSiacoins(payout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fcIndex := builder.AddFileContract(fc)
+	fcSet, err := builder.Sign(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tpt.tpool.AcceptTransactionSet(fcSet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fcid := fcSet[len(fcSet)-1].FileContractID(fcIndex)
+	_, err = tpt.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	revise := func(n uint64) types.Transaction {
+		return types.Transaction{
+			FileContractRevisions: []types.FileContractRevision{{
+				ParentID:              fcid,
+				NewRevisionNumber:     n,
+				NewWindowStart:        fc.WindowStart,
+				NewWindowEnd:          fc.WindowEnd,
+				NewValidProofOutputs:  fc.ValidProofOutputs,
+				NewMissedProofOutputs: fc.MissedProofOutputs,
+				NewUnlockHash:         fc.UnlockHash,
+			}},
+		}
+	}
+
+	// Each higher revision should replace the previous one.
+	for _, n := range []uint64{1, 2, 5} {
+		rev := revise(n)
+		err = tpt.tpool.AcceptTransactionSet([]types.Transaction{rev})
+		if err != nil {
+			t.Fatal(err)
+		}
+		revisions := tpt.tpool.ContractRevisions(fcid)
+		if len(revisions) != 1 || revisions[0].ID() != rev.ID() {
+			t.Fatalf("expected only revision %v in the pool, got %v revisions", n, len(revisions))
+		}
+	}
+
+	// Lower revisions and revisions with the same number should be rejected.
+	for _, n := range []uint64{3, 5} {
+		err = tpt.tpool.AcceptTransactionSet([]types.Transaction{revise(n)})
+		if n == 5 && err == errStaleRevision {
+			t.Fatal("resubmitting the latest revision should be a duplicate")
+		} else if n != 5 && err != errStaleRevision {
+			t.Fatal("expected errStaleRevision, got", err)
+		}
+	}
+	if revisions := tpt.tpool.ContractRevisions(fcid); len(revisions) != 1 || revisions[0].FileContractRevisions[0].NewRevisionNumber != 5 {
+		t.Fatal("latest revision is no longer in the pool")
+	}
+}
+
+// TestContractRevisionRollback checks that the superseded revisions are kept
+// if the revision that supersedes them is not accepted.
+func TestContractRevisionRollback(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	tpt, err := createTpoolTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tpt.Close()
+
+	// Create and confirm a file contract that anyone can revise.
+	payout := types.NewCurrency64(1e9)
+	height := tpt.cs.Height()
+	fc := types.FileContract{
+		WindowStart:        height + 10,
+		WindowEnd:          height + 20,
+		Payout:             payout,
+		ValidProofOutputs:  []types.SiacoinOutput{{Value: types.PostTax(height, payout)}},
+		MissedProofOutputs: []types.SiacoinOutput{{Value: types.PostTax(height, payout)}},
+		UnlockHash:         types.UnlockConditions{}.UnlockHash(),
+	}
+	builder, err := tpt.wallet.StartTransaction()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = builder.FundSiacoins(payout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fcIndex := builder.AddFileContract(fc)
+	fcSet, err := builder.Sign(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tpt.tpool.AcceptTransactionSet(fcSet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fcid := fcSet[len(fcSet)-1].FileContractID(fcIndex)
+	_, err = tpt.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	revise := func(n uint64) types.Transaction {
+		return types.Transaction{
+			FileContractRevisions: []types.FileContractRevision{{
+				ParentID:              fcid,
+				NewRevisionNumber:     n,
+				NewWindowStart:        fc.WindowStart,
+				NewWindowEnd:          fc.WindowEnd,
+				NewValidProofOutputs:  fc.ValidProofOutputs,
+				NewMissedProofOutputs: fc.MissedProofOutputs,
+				NewUnlockHash:         fc.UnlockHash,
+			}},
+		}
+	}
+	first := revise(1)
+	err = tpt.tpool.AcceptTransactionSet([]types.Transaction{first})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Make the revision pass the check that it is valid on its own, but fail
+	// once it is accepted in place of the superseded revision.
+	second := revise(2)
+	errRejected := errors.New("rejected")
+	validations := 0
+	tpt.tpool.validate = func(ts []types.Transaction, txnFn func([]types.Transaction) (modules.ConsensusChange, error)) (modules.ConsensusChange, error) {
+		if ts[0].ID() == second.ID() {
+			validations++
+			if validations > 1 {
+				return modules.ConsensusChange{}, errRejected
+			}
+		}
+		return consensusValidate(ts, txnFn)
+	}
+	err = tpt.tpool.AcceptTransactionSet([]types.Transaction{second})
+	if err == nil {
+		t.Fatal("revision was accepted")
+	}
+	revisions := tpt.tpool.ContractRevisions(fcid)
+	if len(revisions) != 1 || revisions[0].ID() != first.ID() {
+		t.Fatal("superseded revision was not restored:", len(revisions))
+	}
+	if _, exists := tpt.tpool.transactionHeights[first.ID()]; !exists {
+		t.Fatal("metadata of the superseded revision was forgotten")
+	}
+}
@@ -0,0 +1,81 @@
+package transactionpool
+
+import (
+	"time"
+
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+type (
+	// seenResult is the cached result of submitting a transaction set.
+	seenResult struct {
+		err     error
+		expires time.Time
+		version uint64
+	}
+
+	// seenCache remembers the results of recently submitted transaction sets,
+	// so that a set which is gossiped repeatedly in a short window is only
+	// validated once. A result is only valid for as long as the unconfirmed
+	// set does not change, because a set that was rejected may become valid
+	// once its parents are added to the pool. The cache is protected by the
+	// transaction pool's lock.
+	seenCache struct {
+		results map[TransactionSetID]seenResult
+	}
+)
+
+// newSeenCache returns an empty seenCache.
+func newSeenCache() *seenCache {
+	return &seenCache{
+		results: make(map[TransactionSetID]seenResult),
+	}
+}
+
+// lookup returns a bool indicating whether a result of the provided
+// transaction set was found that has not expired and that was cached at the
+// provided version of the unconfirmed set, along with the cached result.
+func (sc *seenCache) lookup(setID TransactionSetID, version uint64, now time.Time) (bool, error) {
+	res, exists := sc.results[setID]
+	if !exists || res.version != version || now.After(res.expires) {
+		return false, nil
+	}
+	return true, res.err
+}
+
+// add caches the result of submitting the provided transaction set at the
+// provided version of the unconfirmed set. Sets that were accepted, or that
+// are being held by the pool, are cached as duplicates. If the cache is full,
+// stale results are removed first, and if that is not enough, an arbitrary
+// result is removed.
+func (sc *seenCache) add(setID TransactionSetID, err error, version uint64, now time.Time) {
+	switch err {
+	case nil, errOrphanSetHeld, errProofSetHeld, errReplacementPending, errTimelockedSetHeld, errUnsyncedSetHeld:
+		err = modules.ErrDuplicateTransactionSet
+	}
+	if len(sc.results) >= maxSeenCacheSize {
+		for id, res := range sc.results {
+			if res.version != version || now.After(res.expires) {
+				delete(sc.results, id)
+			}
+		}
+	}
+	for id := range sc.results {
+		if len(sc.results) < maxSeenCacheSize {
+			break
+		}
+		delete(sc.results, id)
+	}
+	sc.results[setID] = seenResult{
+		err:     err,
+		expires: now.Add(seenCacheTTL),
+		version: version,
+	}
+}
+
+// reset forgets all cached results. It is called whenever the results of
+// validating transaction sets may have changed without the unconfirmed set
+// changing, such as after a consensus change or a change of settings.
+func (sc *seenCache) reset() {
+	sc.results = make(map[TransactionSetID]seenResult)
+}
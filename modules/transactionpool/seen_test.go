@@ -0,0 +1,92 @@
+package transactionpool
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// validationCounter wraps a consensus set and counts how many times a
+// transaction set is validated by the transaction pool.
+type validationCounter struct {
+	modules.ConsensusSet
+	validations int
+}
+
+// LockedTryTransactionSet calls the LockedTryTransactionSet method of the
+// wrapped consensus set, counting the calls to the validation function.
+func (vc *validationCounter) LockedTryTransactionSet(fn func(func(txns []types.Transaction) (modules.ConsensusChange, error)) error) error {
+	cs := vc.ConsensusSet.(interface {
+		LockedTryTransactionSet(fn func(func(txns []types.Transaction) (modules.ConsensusChange, error)) error) error
+	})
+	return cs.LockedTryTransactionSet(func(txnFn func(txns []types.Transaction) (modules.ConsensusChange, error)) error {
+		return fn(func(txns []types.Transaction) (modules.ConsensusChange, error) {
+			vc.validations++
+			return txnFn(txns)
+		})
+	})
+}
+
+// TestSeenCache checks that a flood of identical transaction sets is only
+// validated once.
+func TestSeenCache(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	tpt, err := createTpoolTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tpt.Close()
+
+	vc := &validationCounter{ConsensusSet: tpt.cs}
+	tpt.tpool.mu.Lock()
+	tpt.tpool.consensusSet = vc
+	tpt.tpool.mu.Unlock()
+
+	// Flood the pool with a transaction that spends a nonexisting output.
+	invalid := []types.Transaction{{
+		SiacoinInputs: []types.SiacoinInput{{ParentID: types.SiacoinOutputID{1}}},
+	}}
+	firstErr := tpt.tpool.AcceptTransactionSet(invalid)
+	if _, ok := firstErr.(modules.ConsensusConflict); !ok {
+		t.Fatal("expected a consensus conflict, got", firstErr)
+	}
+	for i := 0; i < 100; i++ {
+		if err := tpt.tpool.AcceptTransactionSet(invalid); err != firstErr {
+			t.Fatal("cached result differs from the original result:", err)
+		}
+	}
+	if vc.validations != 1 {
+		t.Fatal("expected a single validation, got", vc.validations)
+	}
+
+	// Flood the pool with a valid transaction set, which should be accepted
+	// once and then be reported as a duplicate.
+	txns, err := tpt.wallet.SendSiacoins(types.SiacoinPrecision, types.UnlockConditions{}.UnlockHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	validations := vc.validations
+	for i := 0; i < 100; i++ {
+		if err := tpt.tpool.AcceptTransactionSet(txns); err != modules.ErrDuplicateTransactionSet {
+			t.Fatal("expected ErrDuplicateTransactionSet, got", err)
+		}
+	}
+	if vc.validations > validations+1 {
+		t.Fatal("duplicate set was validated repeatedly:", vc.validations-validations)
+	}
+
+	// A consensus change may make the invalid transaction valid, so it should
+	// be validated again.
+	_, err = tpt.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	validations = vc.validations
+	tpt.tpool.AcceptTransactionSet(invalid)
+	if vc.validations != validations+1 {
+		t.Fatal("transaction was not validated again after a consensus change")
+	}
+}
@@ -0,0 +1,119 @@
+package transactionpool
+
+import (
+	"runtime"
+	"sync"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// signatureCache remembers the transactions whose signatures have been
+// verified, so that revalidating a transaction, for example after a consensus
+// change or when it is relayed again, does not repeat the cryptographic work.
+// Transactions are identified by the hash of their full encoding, because the
+// id of a transaction does not cover its signatures. The cache has its own
+// lock, so that signatures can be verified without holding the transaction
+// pool's lock.
+type signatureCache struct {
+	verified map[crypto.Hash]struct{}
+
+	// verifications counts the transactions whose signatures were verified
+	// instead of being found in the cache.
+	verifications uint64
+
+	mu sync.Mutex
+}
+
+// newSignatureCache returns an empty signatureCache.
+func newSignatureCache() *signatureCache {
+	return &signatureCache{
+		verified: make(map[crypto.Hash]struct{}),
+	}
+}
+
+// contains returns true if the signatures of the transaction have been
+// verified, and none of its signatures are timelocked past the provided
+// height. Timelocks are checked again because a reorg may lower the height
+// below the height at which the signatures were verified.
+func (sc *signatureCache) contains(txn types.Transaction, height types.BlockHeight) bool {
+	for _, sig := range txn.TransactionSignatures {
+		if sig.Timelock > height {
+			return false
+		}
+	}
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	_, exists := sc.verified[crypto.HashObject(txn)]
+	return exists
+}
+
+// verify performs the standalone checks of the transaction, including its
+// signatures, at the provided height, and caches the transaction if they
+// pass. If the cache is full, an arbitrary transaction is removed first.
+func (sc *signatureCache) verify(txn types.Transaction, height types.BlockHeight) error {
+	err := txn.StandaloneValid(height)
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.verifications++
+	if err != nil {
+		return err
+	}
+	for key := range sc.verified {
+		if len(sc.verified) < maxSignatureCacheSize {
+			break
+		}
+		delete(sc.verified, key)
+	}
+	sc.verified[crypto.HashObject(txn)] = struct{}{}
+	return nil
+}
+
+// verifySignatures verifies the signatures of the transactions in the set
+// that are not in the signature cache yet, spreading the work over one worker
+// per CPU. It does not require the transaction pool's lock, and is meant to be
+// called before the set is accepted, so that acceptance only has to look the
+// transactions up in the cache. Transactions that fail verification are not
+// cached, and the failure is reported when the set is validated.
+func (tp *TransactionPool) verifySignatures(ts []types.Transaction, height types.BlockHeight) {
+	txns := make(chan types.Transaction)
+	var wg sync.WaitGroup
+	for i := 0; i < runtime.NumCPU() && i < len(ts); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for txn := range txns {
+				tp.signatures.verify(txn, height)
+			}
+		}()
+	}
+	for _, txn := range ts {
+		if !tp.signatures.contains(txn, height) {
+			txns <- txn
+		}
+	}
+	close(txns)
+	wg.Wait()
+}
+
+// cachedTxnFn wraps a validation function that does not verify signatures,
+// such as the one provided by LockedTryTrustedTransactionSet. The returned
+// function performs the standalone checks of the transactions that are not in
+// the signature cache before calling trustedFn, so that it validates sets
+// exactly like the untrusted validation function, without repeating the
+// signature checks of cached transactions. It must be called while the
+// transaction pool is locked.
+func (tp *TransactionPool) cachedTxnFn(trustedFn func([]types.Transaction) (modules.ConsensusChange, error)) func([]types.Transaction) (modules.ConsensusChange, error) {
+	return func(txns []types.Transaction) (modules.ConsensusChange, error) {
+		for _, txn := range txns {
+			if tp.signatures.contains(txn, tp.blockHeight) {
+				continue
+			}
+			if err := tp.signatures.verify(txn, tp.blockHeight); err != nil {
+				return modules.ConsensusChange{}, err
+			}
+		}
+		return trustedFn(txns)
+	}
+}
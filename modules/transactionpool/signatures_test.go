@@ -0,0 +1,88 @@
+package transactionpool
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestSignatureCache checks that transactions with invalid signatures are
+// rejected even though a transaction with the same id has been verified, and
+// that revalidating the pool after a consensus change does not verify any
+// signatures again.
+func TestSignatureCache(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	tpt, err := createTpoolTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tpt.Close()
+
+	builder, err := tpt.wallet.StartTransaction()
+	if err != nil {
+		t.Fatal(err)
+	}
+	value := types.SiacoinPrecision.Mul64(100)
+	err = builder.FundSiacoins(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	builder.AddSiacoinOutput(types.SiacoinOutput{Value: value, UnlockHash: types.UnlockConditions{}.UnlockHash()})
+	tSet, err := builder.Sign(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A copy of the set with a corrupted signature has the same transaction
+	// ids, but must not be treated as verified.
+	corrupted := make([]types.Transaction, len(tSet))
+	copy(corrupted, tSet)
+	last := corrupted[len(corrupted)-1]
+	sigs := make([]types.TransactionSignature, len(last.TransactionSignatures))
+	copy(sigs, last.TransactionSignatures)
+	sigs[0].Signature = append([]byte(nil), sigs[0].Signature...)
+	sigs[0].Signature[0]++
+	last.TransactionSignatures = sigs
+	corrupted[len(corrupted)-1] = last
+	if last.ID() != tSet[len(tSet)-1].ID() {
+		t.Fatal("corrupting the signature changed the transaction id")
+	}
+
+	err = tpt.tpool.AcceptTransactionSet(tSet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tpt.tpool.signatures.verifications != uint64(len(tSet)) {
+		t.Fatalf("expected %v verifications, got %v", len(tSet), tpt.tpool.signatures.verifications)
+	}
+	tpt.tpool.PurgeTransactionPool()
+	err = tpt.tpool.AcceptTransactionSet(corrupted)
+	if err == nil {
+		t.Fatal("set with a corrupted signature was accepted")
+	}
+
+	// Revalidating the pool after a block should find every signature in
+	// the cache.
+	err = tpt.tpool.AcceptTransactionSet(tSet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpt.tpool.mu.Lock()
+	tpt.tpool.fullRevalidation = true
+	tpt.tpool.mu.Unlock()
+	verifications := tpt.tpool.signatures.verifications
+	err = tpt.mineTransactions(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tpt.tpool.signatures.verifications != verifications {
+		t.Fatal("revalidation verified signatures again:", tpt.tpool.signatures.verifications-verifications)
+	}
+	for _, txn := range tSet {
+		if _, _, exists := tpt.tpool.Transaction(txn.ID()); !exists {
+			t.Fatal("transaction was dropped by the revalidation")
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package transactionpool
+
+import (
+	"sort"
+
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// A Snapshot is a frozen view of the unconfirmed transaction sets in the
+// transaction pool. It is intended for block assembly, where the caller needs
+// a view of the pool that will not change while a block template is being
+// built.
+//
+// A Snapshot is a copy of the pool's transaction sets, which means that the
+// transaction pool is not locked while the snapshot is held. Transactions that
+// are accepted or removed after the snapshot is taken do not appear in or
+// disappear from the snapshot.
+type Snapshot struct {
+	sets [][]types.Transaction
+}
+
+// Freeze returns a Snapshot of the transaction sets currently in the
+// transaction pool. The pool continues to accept transactions while the
+// snapshot is held. Sets whose signatures have not been verified yet are left
+// out. Release should be called once the snapshot is no longer needed.
+func (tp *TransactionPool) Freeze() *Snapshot {
+	tp.mu.RLock()
+	defer tp.mu.RUnlock()
+
+	sets := make([][]types.Transaction, 0, len(tp.transactionSets))
+	for _, tSet := range tp.transactionSets {
+		if tp.setUnverified(tSet) {
+			continue
+		}
+		set := make([]types.Transaction, len(tSet))
+		copy(set, tSet)
+		sets = append(sets, set)
+	}
+	return &Snapshot{sets: sets}
+}
+
+// TransactionSet returns all of the transactions in the snapshot, in an order
+// that can acceptably be put into a block.
+func (s *Snapshot) TransactionSet() []types.Transaction {
+	var txns []types.Transaction
+	for _, set := range s.sets {
+		txns = append(txns, set...)
+	}
+	return txns
+}
+
+// BlockTemplate returns transactions from the snapshot whose combined encoded
+// size does not exceed maxSize bytes. Transaction sets are selected whole,
+// highest fee per byte first. The space left over is then filled with
+// packages from the sets that did not fit, where a package is a transaction
+// together with those of its ancestors that have not been selected yet. Every
+// transaction is preceded by its parents.
+func (s *Snapshot) BlockTemplate(maxSize uint64) []types.Transaction {
+	selected, remaining := fillBlock(sortSetsByFee(s.sets), maxSize)
+	var txns []types.Transaction
+	var size uint64
+	for _, set := range selected {
+		txns = append(txns, set...)
+		size += uint64(len(encoding.Marshal(set)))
+	}
+	for _, set := range remaining {
+		included := make(map[types.TransactionID]struct{})
+		for i, txn := range set {
+			if _, exists := included[txn.ID()]; exists {
+				continue
+			}
+			var pkg []types.Transaction
+			for _, parent := range requiredParents(txn, set[:i]) {
+				if _, exists := included[parent.ID()]; !exists {
+					pkg = append(pkg, parent)
+				}
+			}
+			pkg = append(pkg, txn)
+			pkgSize := uint64(packageSize(pkg))
+			if size+pkgSize > maxSize {
+				continue
+			}
+			size += pkgSize
+			for _, t := range pkg {
+				included[t.ID()] = struct{}{}
+			}
+			txns = append(txns, pkg...)
+		}
+	}
+	return txns
+}
+
+// BlockTransactions returns the unconfirmed transactions that a miner should
+// put into the next block. They are selected like Snapshot.BlockTemplate, with
+// room left for the block header and the miner payouts.
+func (tp *TransactionPool) BlockTransactions() []types.Transaction {
+	snapshot := tp.Freeze()
+	defer snapshot.Release()
+	return snapshot.BlockTemplate(types.BlockSizeLimit - blockTemplateOverhead)
+}
+
+// sortSetsByFee returns a copy of the provided transaction sets, sorted by fee
+// per byte, highest fee first. Fees per byte are rounded down, so sets that
+// pay no fee at all are placed after sets paying a fee that rounds down to the
+// same fee per byte.
+func sortSetsByFee(sets [][]types.Transaction) [][]types.Transaction {
+	type setFee struct {
+		set  []types.Transaction
+		fee  types.Currency
+		zero bool
+	}
+	fees := make([]setFee, len(sets))
+	for i, set := range sets {
+		fees[i] = setFee{
+			set:  set,
+			fee:  modules.CalculateFee(set),
+			zero: transactionSetFees(set).IsZero(),
+		}
+	}
+	sort.SliceStable(fees, func(i, j int) bool {
+		if c := fees[i].fee.Cmp(fees[j].fee); c != 0 {
+			return c > 0
+		}
+		return !fees[i].zero && fees[j].zero
+	})
+	sorted := make([][]types.Transaction, len(fees))
+	for i, f := range fees {
+		sorted[i] = f.set
+	}
+	return sorted
+}
+
+// fillBlock walks through the provided transaction sets in order, selecting
+// each set that still fits into a block of maxSize bytes. The selected sets
+// and the sets that did not fit are returned, both in their original order.
+func fillBlock(sets [][]types.Transaction, maxSize uint64) (selected, remaining [][]types.Transaction) {
+	var size uint64
+	for _, set := range sets {
+		setSize := uint64(len(encoding.Marshal(set)))
+		if size+setSize > maxSize {
+			remaining = append(remaining, set)
+			continue
+		}
+		size += setSize
+		selected = append(selected, set)
+	}
+	return selected, remaining
+}
+
+// Release discards the contents of the snapshot. The snapshot is empty after
+// it has been released.
+func (s *Snapshot) Release() {
+	s.sets = nil
+}
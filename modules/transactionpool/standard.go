@@ -27,6 +27,12 @@ import (
 //		signatures might actually be invalid. This rule protects legacy miners
 //		from including potentially invalid transactions in their blocks.
 //
+// Rule: The number of signatures is limited
+//		Each signature requires the verifier to hash the fields it covers and
+//		to verify the signature itself. Limiting the number of signatures
+//		bounds the cost of validating a transaction before any signature is
+//		checked.
+//
 // Rule: The types of allowed arbitrary data are limited
 //		The arbitrary data field can be used to orchestrate soft-forks to Sia
 //		that add features. Legacy miners are at risk of creating invalid blocks
@@ -57,8 +63,9 @@ func checkUnlockConditions(uc types.UnlockConditions) error {
 // These rules can be altered without disrupting consensus.
 //
 // The size of the transaction is returned so that the transaction does not need
-// to be encoded multiple times.
-func isStandardTransaction(t types.Transaction) (uint64, error) {
+// to be encoded multiple times. A maxSignatures of zero means that the number
+// of signatures is not limited.
+func isStandardTransaction(t types.Transaction, maxSignatures int) (uint64, error) {
 	// Check that the size of the transaction does not exceed the standard
 	// established in Standard.md. Larger transactions are a DOS vector,
 	// because someone can fill a large transaction with a bunch of signatures
@@ -71,6 +78,12 @@ func isStandardTransaction(t types.Transaction) (uint64, error) {
 		return 0, modules.ErrLargeTransaction
 	}
 
+	// Check that the transaction does not carry more signatures than allowed.
+	// This is checked before any of the signatures are verified.
+	if maxSignatures > 0 && len(t.TransactionSignatures) > maxSignatures {
+		return 0, modules.ErrTooManySignatures
+	}
+
 	// Check that all public keys are of a recognized type. Need to check all
 	// of the UnlockConditions, which currently can appear in 3 separate fields
 	// of the transaction. Unrecognized types are ignored because a softfork
@@ -120,12 +133,12 @@ func isStandardTransaction(t types.Transaction) (uint64, error) {
 //
 // The size of the transaction set is returned so that the encoding only needs
 // to happen once.
-func isStandardTransactionSet(ts []types.Transaction) (uint64, error) {
+func isStandardTransactionSet(ts []types.Transaction, maxSignatures int) (uint64, error) {
 	// Check that each transaction is acceptable, while also making sure that
 	// the size of the whole set is legal.
 	var totalSize uint64
 	for i := range ts {
-		tSize, err := isStandardTransaction(ts[i])
+		tSize, err := isStandardTransaction(ts[i], maxSignatures)
 		if err != nil {
 			return 0, err
 		}
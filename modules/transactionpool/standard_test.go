@@ -45,3 +45,65 @@ func TestIntegrationLargeTransactions(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+// TestMaxSignatures checks that transactions carrying more signatures than
+// the MaxSignatures setting are rejected as non-standard.
+func TestMaxSignatures(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	tpt, err := createTpoolTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tpt.Close()
+
+	// The default limit should be in place.
+	settings, err := tpt.tpool.Settings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settings.MaxSignatures != defaultMaxSignatures {
+		t.Fatal("unexpected default signature limit:", settings.MaxSignatures)
+	}
+
+	txn := types.Transaction{TransactionSignatures: make([]types.TransactionSignature, 3)}
+	if _, err := isStandardTransaction(txn, 3); err != nil {
+		t.Fatal("transaction at the signature limit was rejected:", err)
+	}
+	if _, err := isStandardTransaction(txn, 2); err != modules.ErrTooManySignatures {
+		t.Fatal("expected ErrTooManySignatures, got", err)
+	}
+	if _, err := isStandardTransaction(txn, 0); err != nil {
+		t.Fatal("transaction was rejected without a signature limit:", err)
+	}
+
+	// The limit should be applied by AcceptTransactionSet once it is changed.
+	err = tpt.tpool.SetSettings(modules.TransactionPoolSettings{MaxSignatures: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tpt.tpool.AcceptTransactionSet([]types.Transaction{txn})
+	if err != modules.ErrTooManySignatures {
+		t.Fatal("expected ErrTooManySignatures, got", err)
+	}
+
+	// A limit of zero should restore the default limit instead of disabling
+	// it.
+	err = tpt.tpool.SetSettings(modules.TransactionPoolSettings{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings, err = tpt.tpool.Settings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settings.MaxSignatures != defaultMaxSignatures {
+		t.Fatal("a limit of zero was not replaced by the default:", settings.MaxSignatures)
+	}
+	txn.TransactionSignatures = make([]types.TransactionSignature, defaultMaxSignatures+1)
+	err = tpt.tpool.AcceptTransactionSet([]types.Transaction{txn})
+	if err != modules.ErrTooManySignatures {
+		t.Fatal("expected ErrTooManySignatures, got", err)
+	}
+}
@@ -0,0 +1,324 @@
+package transactionpool
+
+import (
+	"math/bits"
+	"sort"
+	"time"
+	"unsafe"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+type (
+	// CategoryStats summarizes the transactions of a single category in the
+	// transaction pool.
+	CategoryStats struct {
+		// Transactions is the number of transactions in the category.
+		Transactions int
+		// Value is the total value moved by the transactions in the category,
+		// which is the sum of their siacoin outputs and file contract payouts.
+		Value types.Currency
+	}
+
+	// PoolStats describes the composition of the transaction pool.
+	PoolStats struct {
+		Transactions    int
+		TransactionSets int
+		Size            int // bytes
+		TotalFees       types.Currency
+
+		// Transactions are categorized by their shape. A transaction
+		// carrying both file contracts and storage proofs counts towards
+		// both categories, and only transactions carrying neither are value
+		// transfers.
+		FileContracts  CategoryStats // new contracts or revisions
+		StorageProofs  CategoryStats
+		ValueTransfers CategoryStats
+	}
+
+	// FeeBucket groups the transactions whose fee per byte falls within
+	// [Floor, Floor+width) for the bucket width that was requested.
+	FeeBucket struct {
+		Floor        types.Currency
+		Transactions []types.TransactionID
+	}
+)
+
+// transactionValue returns the total value moved by a transaction.
+func transactionValue(txn types.Transaction) types.Currency {
+	var value types.Currency
+	for _, sco := range txn.SiacoinOutputs {
+		value = value.Add(sco.Value)
+	}
+	for _, fc := range txn.FileContracts {
+		value = value.Add(fc.Payout)
+	}
+	return value
+}
+
+// add counts a transaction towards the category.
+func (cs *CategoryStats) add(txn types.Transaction) {
+	cs.Transactions++
+	cs.Value = cs.Value.Add(transactionValue(txn))
+}
+
+// Stats returns statistics about the composition of the transaction pool.
+func (tp *TransactionPool) Stats() PoolStats {
+	tp.mu.RLock()
+	defer tp.mu.RUnlock()
+
+	stats := PoolStats{
+		TransactionSets: len(tp.transactionSets),
+		Size:            tp.transactionListSize,
+		TotalFees:       tp.transactionListFees,
+	}
+	for _, tSet := range tp.transactionSets {
+		for _, txn := range tSet {
+			stats.Transactions++
+			hasContracts := len(txn.FileContracts) > 0 || len(txn.FileContractRevisions) > 0
+			hasProofs := len(txn.StorageProofs) > 0
+			if hasContracts {
+				stats.FileContracts.add(txn)
+			}
+			if hasProofs {
+				stats.StorageProofs.add(txn)
+			}
+			if !hasContracts && !hasProofs {
+				stats.ValueTransfers.add(txn)
+			}
+		}
+	}
+	return stats
+}
+
+// mapEntryOverhead approximates the memory used by the bookkeeping of a
+// single map entry, excluding its key and value.
+const mapEntryOverhead = 16
+
+// MemoryEstimate returns an approximation of the number of bytes held in
+// memory by the transaction pool. Unlike the size reported by Stats, it
+// includes the in-memory representation of the transactions, the indexes
+// that the pool maintains for them, the sets held outside of the unconfirmed
+// set, and the updates kept for subscribers. The estimate is a heuristic, but
+// it grows with the contents of the pool.
+func (tp *TransactionPool) MemoryEstimate() int {
+	tp.mu.RLock()
+	defer tp.mu.RUnlock()
+
+	var (
+		txnSize      = int(unsafe.Sizeof(types.Transaction{}))
+		idSize       = int(unsafe.Sizeof(crypto.Hash{}))
+		sliceSize    = int(unsafe.Sizeof([]types.Transaction{}))
+		scoDiffSize  = int(unsafe.Sizeof(modules.SiacoinOutputDiff{}))
+		fcDiffSize   = int(unsafe.Sizeof(modules.FileContractDiff{}))
+		sfoDiffSize  = int(unsafe.Sizeof(modules.SiafundOutputDiff{}))
+		dscoDiffSize = int(unsafe.Sizeof(modules.DelayedSiacoinOutputDiff{}))
+		ccSize       = int(unsafe.Sizeof(modules.ConsensusChange{}))
+	)
+
+	// setMemory estimates the memory used by a held transaction set, using
+	// the encoded size of the set as an approximation of the memory referenced
+	// by the slices of its transactions.
+	setMemory := func(ts []types.Transaction, encodedSize int) int {
+		return sliceSize + len(ts)*txnSize + encodedSize
+	}
+
+	// The unconfirmed set, including the dependency index and the diffs of
+	// each set.
+	mem := tp.transactionListSize
+	for _, tSet := range tp.transactionSets {
+		mem += mapEntryOverhead + idSize + sliceSize + len(tSet)*txnSize
+	}
+	for _, cc := range tp.transactionSetDiffs {
+		mem += mapEntryOverhead + idSize + ccSize
+		mem += len(cc.SiacoinOutputDiffs) * scoDiffSize
+		mem += len(cc.FileContractDiffs) * fcDiffSize
+		mem += len(cc.SiafundOutputDiffs) * sfoDiffSize
+		mem += len(cc.DelayedSiacoinOutputDiffs) * dscoDiffSize
+	}
+	mem += len(tp.knownObjects) * (mapEntryOverhead + 2*idSize)
+	mem += len(tp.transactionSetIDs) * (mapEntryOverhead + 2*idSize)
+	mem += len(tp.transactionSizes) * (mapEntryOverhead + idSize + int(unsafe.Sizeof(0)))
+
+	// The metadata tracked for each transaction.
+	mem += len(tp.transactionArrivals) * (mapEntryOverhead + idSize + int(unsafe.Sizeof(time.Time{})))
+	mem += len(tp.transactionHeights) * (mapEntryOverhead + idSize + int(unsafe.Sizeof(types.BlockHeight(0))))
+	mem += len(tp.transactionPriorities) * (mapEntryOverhead + idSize + int(unsafe.Sizeof(Priority(0))))
+	mem += len(tp.pinnedTransactions) * (mapEntryOverhead + idSize)
+	for _, source := range tp.transactionSources {
+		mem += mapEntryOverhead + idSize + int(unsafe.Sizeof(source)) + len(source)
+	}
+
+	// Sets held outside of the unconfirmed set.
+	for _, ts := range tp.timelockedSets {
+		mem += mapEntryOverhead + idSize + setMemory(ts.set, ts.size)
+	}
+	for _, orphan := range tp.orphanSets {
+		mem += mapEntryOverhead + idSize + setMemory(orphan.set, orphan.size)
+	}
+	for _, ps := range tp.proofSets {
+		mem += mapEntryOverhead + idSize + setMemory(ps.set, ps.size)
+	}
+	for _, us := range tp.unsyncedSets {
+		mem += mapEntryOverhead + idSize + setMemory(us.set, us.size)
+	}
+	for _, pr := range tp.pendingReplacements {
+		mem += mapEntryOverhead + idSize + setMemory(pr.set, pr.size)
+	}
+
+	// The transactions whose signatures have been verified.
+	tp.signatures.mu.Lock()
+	mem += len(tp.signatures.verified) * (mapEntryOverhead + idSize)
+	tp.signatures.mu.Unlock()
+
+	// The updates kept for subscribers share their transactions with the
+	// unconfirmed set, but carry their own ids and sizes.
+	for _, ut := range tp.subscriberSets {
+		mem += mapEntryOverhead + idSize + int(unsafe.Sizeof(*ut))
+		mem += len(ut.IDs)*idSize + len(ut.Sizes)*8
+	}
+	return mem
+}
+
+// TransactionsByFeeBucket groups the ids of the transactions in the pool by
+// their fee per byte, floored to a multiple of bucketWidth. Only non-empty
+// buckets are returned, sorted by fee from lowest to highest. A bucketWidth of
+// zero places every distinct fee per byte into its own bucket.
+//
+// Currency values cannot be used as map keys, so the buckets are returned as
+// a sorted slice rather than as a map.
+func (tp *TransactionPool) TransactionsByFeeBucket(bucketWidth types.Currency) []FeeBucket {
+	tp.mu.RLock()
+	defer tp.mu.RUnlock()
+
+	buckets := make(map[string]*FeeBucket)
+	for _, tSet := range tp.transactionSets {
+		for _, txn := range tSet {
+			floor := modules.CalculateFee([]types.Transaction{txn})
+			if !bucketWidth.IsZero() {
+				floor = floor.Div(bucketWidth).Mul(bucketWidth)
+			}
+			b, exists := buckets[floor.String()]
+			if !exists {
+				b = &FeeBucket{Floor: floor}
+				buckets[floor.String()] = b
+			}
+			b.Transactions = append(b.Transactions, txn.ID())
+		}
+	}
+
+	sorted := make([]FeeBucket, 0, len(buckets))
+	for _, b := range buckets {
+		sorted = append(sorted, *b)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Floor.Cmp(sorted[j].Floor) < 0
+	})
+	return sorted
+}
+
+// TransactionSummary is a lightweight description of a transaction in the
+// transaction pool, suitable for listing many transactions at once.
+type TransactionSummary struct {
+	ID                   types.TransactionID
+	Fee                  types.Currency
+	Size                 int // bytes
+	NumInputs            int // siacoin and siafund inputs
+	NumOutputs           int // siacoin and siafund outputs
+	HasContract          bool
+	HasProof             bool
+	ArrivalTime          time.Time
+	UnconfirmedAncestors int
+}
+
+// Summaries returns a summary of every transaction in the transaction pool.
+func (tp *TransactionPool) Summaries() []TransactionSummary {
+	tp.mu.RLock()
+	defer tp.mu.RUnlock()
+
+	summaries := make([]TransactionSummary, 0, len(tp.transactionSizes))
+	for _, tSet := range tp.transactionSets {
+		// Parents are always part of the same set as their children, so the
+		// ancestors of each transaction are found within its set. Visiting
+		// the set in topological order ensures that the ancestors of every
+		// parent are known before its children. The pool never contains
+		// cycles, so the order cannot fail.
+		// The ancestors of each transaction are kept as a bitset of the
+		// indices of the set, so that they can be merged cheaply.
+		parents := setDependencies(tSet)
+		order, _ := topologicalOrder(parents)
+		words := (len(tSet) + 63) / 64
+		ancestors := make([][]uint64, len(tSet))
+		for _, i := range order {
+			ancestors[i] = make([]uint64, words)
+			for _, parent := range parents[i] {
+				ancestors[i][parent/64] |= 1 << uint(parent%64)
+				for w, word := range ancestors[parent] {
+					ancestors[i][w] |= word
+				}
+			}
+		}
+		for i, txn := range tSet {
+			summaries = append(summaries, TransactionSummary{
+				ID:                   txn.ID(),
+				Fee:                  transactionSetFees(tSet[i : i+1]),
+				Size:                 tp.transactionSizes[txn.ID()],
+				NumInputs:            len(txn.SiacoinInputs) + len(txn.SiafundInputs),
+				NumOutputs:           len(txn.SiacoinOutputs) + len(txn.SiafundOutputs),
+				HasContract:          len(txn.FileContracts) > 0 || len(txn.FileContractRevisions) > 0,
+				HasProof:             len(txn.StorageProofs) > 0,
+				ArrivalTime:          tp.transactionArrivals[txn.ID()],
+				UnconfirmedAncestors: numAncestors(ancestors[i]),
+			})
+		}
+	}
+	return summaries
+}
+
+// numAncestors returns the number of ancestors in a bitset built by Summaries.
+func numAncestors(ancestors []uint64) int {
+	var n int
+	for _, word := range ancestors {
+		n += bits.OnesCount64(word)
+	}
+	return n
+}
+
+// MaxChainDepth returns the number of transactions in the longest chain of
+// unconfirmed transactions in the transaction pool, where each transaction in
+// the chain spends an output of the one before it. A transaction that only
+// depends on confirmed outputs forms a chain of length one, and 0 is returned
+// if the pool is empty.
+func (tp *TransactionPool) MaxChainDepth() int {
+	tp.mu.RLock()
+	defer tp.mu.RUnlock()
+
+	// Parents are always part of the same set as their children, so each set
+	// can be walked on its own.
+	var maxDepth int
+	for _, tSet := range tp.transactionSets {
+		parents := setDependencies(tSet)
+		depths := make([]int, len(tSet))
+		var depth func(i int) int
+		depth = func(i int) int {
+			if depths[i] == 0 {
+				d := 0
+				for _, parent := range parents[i] {
+					if pd := depth(parent); pd > d {
+						d = pd
+					}
+				}
+				depths[i] = d + 1
+			}
+			return depths[i]
+		}
+		for i := range tSet {
+			if d := depth(i); d > maxDepth {
+				maxDepth = d
+			}
+		}
+	}
+	return maxDepth
+}
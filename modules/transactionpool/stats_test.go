@@ -0,0 +1,340 @@
+package transactionpool
+
+import (
+	"testing"
+	"time"
+
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestStats checks that Stats breaks the transaction pool down by the shape of
+// its transactions.
+func TestStats(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	tpt, err := createTpoolTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tpt.Close()
+
+	if stats := tpt.tpool.Stats(); stats.Transactions != 0 || stats.Size != 0 {
+		t.Fatal("empty pool has non-empty stats:", stats)
+	}
+
+	// Add a value transfer to the pool.
+	_, err = tpt.wallet.SendSiacoins(types.SiacoinPrecision, types.UnlockConditions{}.UnlockHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Add a file contract to the pool.
+	builder, err := tpt.wallet.StartTransaction()
+	if err != nil {
+		t.Fatal(err)
+	}
+	payout := types.NewCurrency64(1e9)
+	err = builder.FundSiacoins(payout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	builder.AddFileContract(types.FileContract{
+		WindowStart:        tpt.cs.Height() + 2,
+		WindowEnd:          tpt.cs.Height() + 5,
+		Payout:             payout,
+		ValidProofOutputs:  []types.SiacoinOutput{{Value: types.PostTax(tpt.cs.Height(), payout)}},
+		MissedProofOutputs: []types.SiacoinOutput{{Value: types.PostTax(tpt.cs.Height(), payout)}},
+		UnlockHash:         types.UnlockConditions{}.UnlockHash(),
+	})
+	fcSet, err := builder.Sign(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tpt.tpool.AcceptTransactionSet(fcSet)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	txns := tpt.tpool.TransactionList()
+	stats := tpt.tpool.Stats()
+	if stats.Transactions != len(txns) {
+		t.Fatalf("expected %v transactions, got %v", len(txns), stats.Transactions)
+	}
+	if stats.Size != tpt.tpool.transactionListSize {
+		t.Fatal("wrong pool size:", stats.Size)
+	}
+	if !stats.TotalFees.Equals(transactionSetFees(txns)) {
+		t.Fatal("wrong fee total:", stats.TotalFees)
+	}
+	if stats.FileContracts.Transactions != 1 {
+		t.Fatal("expected 1 file contract transaction, got", stats.FileContracts.Transactions)
+	}
+	if stats.FileContracts.Value.Cmp(payout) < 0 {
+		t.Fatal("file contract value does not include the payout:", stats.FileContracts.Value)
+	}
+	if stats.StorageProofs.Transactions != 0 {
+		t.Fatal("expected no storage proof transactions, got", stats.StorageProofs.Transactions)
+	}
+	if stats.ValueTransfers.Transactions != len(txns)-1 {
+		t.Fatalf("expected %v value transfers, got %v", len(txns)-1, stats.ValueTransfers.Transactions)
+	}
+	if stats.ValueTransfers.Value.Cmp(types.SiacoinPrecision) < 0 {
+		t.Fatal("value transfers do not include the sent coins:", stats.ValueTransfers.Value)
+	}
+
+	// The fee total should drop back to zero once the pool is emptied.
+	tpt.tpool.Trim(0)
+	if stats := tpt.tpool.Stats(); !stats.TotalFees.IsZero() {
+		t.Fatal("emptied pool has fees:", stats.TotalFees)
+	}
+}
+
+// TestTransactionsByFeeBucket checks that TransactionsByFeeBucket groups the
+// transactions in the pool by their floored fee per byte.
+func TestTransactionsByFeeBucket(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	tpt, err := createTpoolTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tpt.Close()
+
+	if buckets := tpt.tpool.TransactionsByFeeBucket(types.NewCurrency64(1)); len(buckets) != 0 {
+		t.Fatal("empty pool has fee buckets:", buckets)
+	}
+
+	source, err := tpt.graphSource(types.SiacoinPrecision.Mul64(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	graph, err := types.TransactionGraph(source, []types.TransactionGraphEdge{
+		{Dest: 1, Fee: types.SiacoinPrecision.Mul64(10), Source: 0, Value: types.SiacoinPrecision.Mul64(90)},
+		{Dest: 2, Fee: types.SiacoinPrecision.Mul64(50), Source: 1, Value: types.SiacoinPrecision.Mul64(40)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tpt.tpool.AcceptTransactionSet(graph)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lowRate := modules.CalculateFee(graph[:1])
+	highRate := modules.CalculateFee(graph[1:])
+
+	// A bucket width of zero should give each fee rate its own bucket.
+	buckets := tpt.tpool.TransactionsByFeeBucket(types.ZeroCurrency)
+	if len(buckets) != 2 {
+		t.Fatal("expected 2 buckets, got", len(buckets))
+	}
+	if buckets[0].Floor.Cmp(lowRate) != 0 || buckets[0].Transactions[0] != graph[0].ID() {
+		t.Fatal("lowest bucket is wrong:", buckets[0])
+	}
+	if buckets[1].Floor.Cmp(highRate) != 0 || buckets[1].Transactions[0] != graph[1].ID() {
+		t.Fatal("highest bucket is wrong:", buckets[1])
+	}
+
+	// A bucket wider than both fee rates should hold every transaction.
+	buckets = tpt.tpool.TransactionsByFeeBucket(highRate.Add(types.NewCurrency64(1)))
+	if len(buckets) != 1 || !buckets[0].Floor.IsZero() || len(buckets[0].Transactions) != 2 {
+		t.Fatal("expected a single bucket at zero, got", buckets)
+	}
+
+	// Every transaction should fall within the bounds of its bucket.
+	width := lowRate.Div64(3)
+	for _, b := range tpt.tpool.TransactionsByFeeBucket(width) {
+		for _, id := range b.Transactions {
+			txn, _, _ := tpt.tpool.Transaction(id)
+			rate := modules.CalculateFee([]types.Transaction{txn})
+			if rate.Cmp(b.Floor) < 0 || rate.Cmp(b.Floor.Add(width)) >= 0 {
+				t.Fatal("transaction falls outside of its bucket")
+			}
+		}
+	}
+}
+
+// TestSummaries checks that Summaries describes each transaction in the pool.
+func TestSummaries(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	tpt, err := createTpoolTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tpt.Close()
+
+	if summaries := tpt.tpool.Summaries(); len(summaries) != 0 {
+		t.Fatal("empty pool has summaries:", summaries)
+	}
+
+	source, err := tpt.graphSource(types.SiacoinPrecision.Mul64(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	graph, err := types.TransactionGraph(source, []types.TransactionGraphEdge{
+		{Dest: 1, Fee: types.SiacoinPrecision.Mul64(10), Source: 0, Value: types.SiacoinPrecision.Mul64(90)},
+		{Dest: 2, Fee: types.SiacoinPrecision.Mul64(10), Source: 1, Value: types.SiacoinPrecision.Mul64(80)},
+		{Dest: 3, Fee: types.SiacoinPrecision.Mul64(10), Source: 2, Value: types.SiacoinPrecision.Mul64(70)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tpt.tpool.AcceptTransactionSet(graph)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	summaries := tpt.tpool.Summaries()
+	if len(summaries) != len(graph) {
+		t.Fatal("expected a summary per transaction, got", len(summaries))
+	}
+	for i, txn := range graph {
+		var s TransactionSummary
+		for _, summary := range summaries {
+			if summary.ID == txn.ID() {
+				s = summary
+			}
+		}
+		if s.ID != txn.ID() {
+			t.Fatal("transaction is missing a summary")
+		}
+		if !s.Fee.Equals(types.SiacoinPrecision.Mul64(10)) || s.Size != len(encoding.Marshal(txn)) {
+			t.Fatal("summary has the wrong fee or size:", s)
+		}
+		if s.NumInputs != len(txn.SiacoinInputs) || s.NumOutputs != len(txn.SiacoinOutputs) || s.HasContract || s.HasProof {
+			t.Fatal("summary has the wrong shape:", s)
+		}
+		if s.UnconfirmedAncestors != i {
+			t.Fatalf("transaction %v should have %v unconfirmed ancestors, got %v", i, i, s.UnconfirmedAncestors)
+		}
+		if s.ArrivalTime.Before(start) || s.ArrivalTime.After(time.Now()) {
+			t.Fatal("summary has the wrong arrival time:", s.ArrivalTime)
+		}
+	}
+
+	// The sizes of the transactions are forgotten once they leave the pool.
+	_, err = tpt.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tpt.tpool.transactionSizes) != 0 {
+		t.Fatal("confirmed transactions still have sizes:", len(tpt.tpool.transactionSizes))
+	}
+}
+
+// TestMemoryEstimate checks that the memory estimate of the transaction pool
+// grows as transactions are added.
+func TestMemoryEstimate(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	tpt, err := createTpoolTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tpt.Close()
+
+	empty := tpt.tpool.MemoryEstimate()
+	_, err = tpt.wallet.SendSiacoins(types.SiacoinPrecision, types.UnlockConditions{}.UnlockHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	one := tpt.tpool.MemoryEstimate()
+	if one <= empty {
+		t.Fatal("memory estimate did not grow after adding a transaction:", empty, one)
+	}
+	// The in-memory footprint should exceed the encoded size of the pool.
+	if one <= tpt.tpool.Stats().Size {
+		t.Fatal("memory estimate is smaller than the encoded size of the pool:", one)
+	}
+	_, err = tpt.wallet.SendSiacoins(types.SiacoinPrecision, types.UnlockConditions{}.UnlockHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if two := tpt.tpool.MemoryEstimate(); two <= one {
+		t.Fatal("memory estimate did not grow after adding a second transaction:", one, two)
+	}
+
+	// Emptying the pool should bring the estimate back down.
+	tpt.tpool.PurgeTransactionPool()
+	if purged := tpt.tpool.MemoryEstimate(); purged >= one {
+		t.Fatal("memory estimate did not shrink after purging the pool:", purged)
+	}
+}
+
+// TestMaxChainDepth checks that MaxChainDepth reports the length of the
+// longest chain of unconfirmed transactions.
+func TestMaxChainDepth(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	tpt, err := createTpoolTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tpt.Close()
+
+	value := types.SiacoinPrecision.Mul64(100)
+	outputs := make([]types.SiacoinOutput, 3)
+	for i := range outputs {
+		outputs[i] = types.SiacoinOutput{Value: value, UnlockHash: types.UnlockConditions{}.UnlockHash()}
+	}
+	txns, err := tpt.wallet.SendSiacoinsMulti(outputs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tpt.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if depth := tpt.tpool.MaxChainDepth(); depth != 0 {
+		t.Fatal("expected a depth of 0 for an empty pool, got", depth)
+	}
+	parent := txns[len(txns)-1]
+	var sources []types.SiacoinOutputID
+	for i := range parent.SiacoinOutputs {
+		if parent.SiacoinOutputs[i].UnlockHash == (types.UnlockConditions{}).UnlockHash() {
+			sources = append(sources, parent.SiacoinOutputID(uint64(i)))
+		}
+	}
+
+	// Submit a chain of each length. Chains that are shorter than the longest
+	// chain so far do not change the depth.
+	maxDepth := 0
+	for i, length := range []int{3, 5, 2} {
+		var edges []types.TransactionGraphEdge
+		for j := 0; j < length; j++ {
+			edges = append(edges, types.TransactionGraphEdge{
+				Dest:   j + 1,
+				Fee:    types.SiacoinPrecision,
+				Source: j,
+				Value:  value.Sub(types.SiacoinPrecision.Mul64(uint64(j + 1))),
+			})
+		}
+		graph, err := types.TransactionGraph(sources[i], edges)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = tpt.tpool.AcceptTransactionSet(graph)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if length > maxDepth {
+			maxDepth = length
+		}
+		if depth := tpt.tpool.MaxChainDepth(); depth != maxDepth {
+			t.Fatalf("expected a depth of %v, got %v", maxDepth, depth)
+		}
+	}
+
+	tpt.tpool.PurgeTransactionPool()
+	if depth := tpt.tpool.MaxChainDepth(); depth != 0 {
+		t.Fatal("expected a depth of 0 after purging the pool, got", depth)
+	}
+}
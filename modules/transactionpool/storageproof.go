@@ -0,0 +1,70 @@
+package transactionpool
+
+import (
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+
+	"github.com/NebulousLabs/errors"
+)
+
+var (
+	errFullProofSets = errors.New("transaction pool cannot hold more transaction sets with premature storage proofs")
+	errProofSetHeld  = errors.New("transaction set contains a storage proof for a file contract whose proof window has not opened and will be submitted once it opens")
+)
+
+type (
+	// proofSet is a transaction set that contains a storage proof for a file
+	// contract whose proof window has not opened yet. The set is validated
+	// again after each consensus change, until it is either accepted or can
+	// no longer become valid.
+	proofSet struct {
+		size int
+		set  []types.Transaction
+	}
+)
+
+// holdProofSet stores a transaction set with a premature storage proof, so
+// that it can be submitted once the proof window of the contract opens.
+func (tp *TransactionPool) holdProofSet(ts []types.Transaction) error {
+	setID := TransactionSetID(crypto.HashObject(ts))
+	if _, exists := tp.proofSets[setID]; exists {
+		return modules.ErrDuplicateTransactionSet
+	}
+	setSize := len(encoding.Marshal(ts))
+	if tp.proofSetsSize+setSize > maxProofSetsSize {
+		return errFullProofSets
+	}
+	tp.proofSets[setID] = proofSet{
+		size: setSize,
+		set:  ts,
+	}
+	tp.proofSetsSize += setSize
+	return errProofSetHeld
+}
+
+// promoteProofSets submits the held transaction sets with premature storage
+// proofs against the current consensus state. Sets whose proof windows are
+// still closed are held again, and sets that are invalid for any other
+// reason, such as a contract that has expired or has already been proven, are
+// dropped. The accepted transaction sets are relayed to peers.
+func (tp *TransactionPool) promoteProofSets(txnFn func([]types.Transaction) (modules.ConsensusChange, error)) {
+	held := tp.proofSets
+	tp.proofSets = make(map[TransactionSetID]proofSet)
+	tp.proofSetsSize = 0
+	for _, ps := range held {
+		err := tp.acceptTransactionSet(ps.set, txnFn)
+		if err == errProofSetHeld {
+			continue
+		} else if err != nil {
+			tp.log.Debugln("Transaction set with a held storage proof was dropped:", err)
+			continue
+		}
+		tp.setOrigin(ps.set, OriginHeld)
+		for _, txn := range ps.set {
+			tp.events.LogAccept(transactionEvent(txn))
+		}
+		go tp.gateway.Broadcast("RelayTransactionSet", ps.set, tp.gateway.Peers())
+	}
+}
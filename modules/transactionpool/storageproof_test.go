@@ -0,0 +1,197 @@
+package transactionpool
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+	"github.com/NebulousLabs/fastrand"
+)
+
+// TestHoldStorageProofs checks that storage proofs submitted before the proof
+// window of their file contract opens are held, that one of them is promoted
+// once the window opens, and that the held proofs which can no longer become
+// valid are dropped.
+func TestHoldStorageProofs(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	tpt, err := createTpoolTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tpt.Close()
+	err = tpt.tpool.SetSettings(modules.TransactionPoolSettings{HoldStorageProofs: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proofs := prematureStorageProofs(t, tpt)
+	for _, proof := range proofs {
+		err = tpt.tpool.AcceptTransactionSet([]types.Transaction{proof})
+		if err != errProofSetHeld {
+			t.Fatal("expected errProofSetHeld, got", err)
+		}
+	}
+
+	// The proofs stay held while the window is closed.
+	_, err = tpt.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tpt.tpool.proofSets) != 2 || len(tpt.tpool.TransactionList()) != 0 {
+		t.Fatal("storage proofs were not held until the proof window opened")
+	}
+
+	// Once the window opens, one proof is promoted and the other is dropped.
+	_, err = tpt.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tpt.tpool.proofSets) != 0 {
+		t.Fatal("storage proofs are still held after the proof window opened")
+	}
+	var promoted types.Transaction
+	for _, proof := range proofs {
+		if _, _, exists := tpt.tpool.Transaction(proof.ID()); exists {
+			promoted = proof
+		}
+	}
+	if len(tpt.tpool.TransactionList()) != 1 {
+		t.Fatal("expected exactly one storage proof to be promoted")
+	}
+	_, err = tpt.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	confirmed, err := tpt.tpool.TransactionConfirmed(promoted.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !confirmed {
+		t.Fatal("promoted storage proof was not confirmed")
+	}
+}
+
+// prematureStorageProofs confirms a file contract whose proof window opens
+// once two more blocks have been mined, and returns two different transactions
+// proving the contract. Only one of them can ever be confirmed.
+func prematureStorageProofs(t *testing.T, tpt *tpoolTester) []types.Transaction {
+	// COMPATv0.4.0 - storage proofs below height 10 use the buggy pre-fork
+	// rules.
+	for tpt.cs.Height() <= 10 {
+		_, err := tpt.miner.AddBlock()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Confirm a file contract whose proof window opens a few blocks from now.
+	file := fastrand.Bytes(crypto.SegmentSize)
+	payout := types.NewCurrency64(400e6)
+	height := tpt.cs.Height()
+	fc := types.FileContract{
+		FileSize:       uint64(len(file)),
+		FileMerkleRoot: crypto.MerkleRoot(file),
+		WindowStart:    height + 4,
+		WindowEnd:      height + 8,
+		Payout:         payout,
+		ValidProofOutputs: []types.SiacoinOutput{{
+			Value: types.PostTax(height, payout),
+		}},
+		MissedProofOutputs: []types.SiacoinOutput{{
+			Value: types.PostTax(height, payout),
+		}},
+	}
+	builder, err := tpt.wallet.StartTransaction()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = builder.FundSiacoins(payout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fcIndex := builder.AddFileContract(fc)
+	fcSet, err := builder.Sign(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tpt.tpool.AcceptTransactionSet(fcSet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tpt.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fcid := fcSet[len(fcSet)-1].FileContractID(fcIndex)
+
+	// Create two different transactions proving the contract.
+	segment, hashSet := crypto.MerkleProof(file, 0)
+	sp := types.StorageProof{
+		ParentID: fcid,
+		HashSet:  hashSet,
+	}
+	copy(sp.Segment[:], segment)
+	return []types.Transaction{
+		{StorageProofs: []types.StorageProof{sp}},
+		{StorageProofs: []types.StorageProof{sp}, ArbitraryData: [][]byte{append(modules.PrefixNonSia[:], "second"...)}},
+	}
+}
+
+// TestPersistHeldStorageProofs checks that held storage proofs survive a
+// restart, and are promoted once the proof window opens.
+func TestPersistHeldStorageProofs(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	tpt, err := createTpoolTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tpt.Close()
+	err = tpt.tpool.SetSettings(modules.TransactionPoolSettings{HoldStorageProofs: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	proofs := prematureStorageProofs(t, tpt)
+	for _, proof := range proofs {
+		err = tpt.tpool.AcceptTransactionSet([]types.Transaction{proof})
+		if err != errProofSetHeld {
+			t.Fatal("expected errProofSetHeld, got", err)
+		}
+	}
+
+	// Restart the transaction pool, which saves and reloads the pool.
+	err = tpt.tpool.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpt.tpool, err = New(tpt.cs, tpt.gateway, tpt.tpool.persistDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tpt.tpool.SetSettings(modules.TransactionPoolSettings{HoldStorageProofs: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tpt.tpool.proofSets) != 2 || len(tpt.tpool.TransactionList()) != 0 {
+		t.Fatal("held storage proofs were not restored after a restart")
+	}
+
+	// Open the proof window.
+	for i := 0; i < 2; i++ {
+		_, err = tpt.miner.AddBlock()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(tpt.tpool.proofSets) != 0 {
+		t.Fatal("storage proofs are still held after the proof window opened")
+	}
+	txns := tpt.tpool.TransactionList()
+	if len(txns) != 1 || (txns[0].ID() != proofs[0].ID() && txns[0].ID() != proofs[1].ID()) {
+		t.Fatal("expected exactly one restored storage proof to be promoted")
+	}
+}
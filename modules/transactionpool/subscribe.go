@@ -37,6 +37,10 @@ func (tp *TransactionPool) updateSubscribersTransactions() {
 			// The transaction set has already been sent in an update.
 			continue
 		}
+		if tp.setUnverified(set) {
+			// The set is withheld until its signatures are verified.
+			continue
+		}
 
 		// Report that this transaction set is new to the transaction pool.
 		ids := make([]types.TransactionID, 0, len(set))
@@ -1,12 +1,14 @@
 package transactionpool
 
 import (
-	"errors"
+	"time"
 
 	"github.com/NebulousLabs/demotemutex"
+	"github.com/NebulousLabs/errors"
 	"github.com/coreos/bbolt"
 
 	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/encoding"
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/persist"
 	"github.com/NebulousLabs/Sia/sync"
@@ -45,28 +47,160 @@ type (
 		//
 		// transactionSetDiffs map form a transaction set id to the set of
 		// diffs that resulted from the transaction set.
-		knownObjects        map[ObjectID]TransactionSetID
-		subscriberSets      map[TransactionSetID]*modules.UnconfirmedTransactionSet
-		transactionHeights  map[types.TransactionID]types.BlockHeight
-		transactionSets     map[TransactionSetID][]types.Transaction
-		transactionSetDiffs map[TransactionSetID]*modules.ConsensusChange
-		transactionListSize int
+		//
+		// transactionSetIDs maps the id of every unconfirmed transaction to
+		// the id of the transaction set that contains it, and
+		// transactionSizes maps it to its encoded size.
+		knownObjects          map[ObjectID]TransactionSetID
+		subscriberSets        map[TransactionSetID]*modules.UnconfirmedTransactionSet
+		pinnedTransactions    map[types.TransactionID]struct{}
+		transactionArrivals   map[types.TransactionID]time.Time
+		transactionHeights    map[types.TransactionID]types.BlockHeight
+		transactionOrigins    map[types.TransactionID]Origin
+		transactionSources    map[types.TransactionID]string
+		transactionPriorities map[types.TransactionID]Priority
+		transactionSets       map[TransactionSetID][]types.Transaction
+		transactionSetIDs     map[types.TransactionID]TransactionSetID
+		transactionSizes      map[types.TransactionID]int
+		transactionSetDiffs   map[TransactionSetID]*modules.ConsensusChange
+		transactionListSize   int
+		transactionListFees   types.Currency
+		transactionListValue  types.Currency
+
+		// unverified contains the transactions that were added to the pool
+		// without verifying their signatures. The sets that contain them are
+		// withheld from subscribers and block templates until the signatures
+		// have been verified in the background.
+		unverified map[types.TransactionID]struct{}
+
+		// unconfirmedVersion is incremented every time that a transaction set
+		// is added to or removed from the unconfirmed set.
+		unconfirmedVersion uint64
+
+		// Transaction sets that are held until their timelocks expire.
+		timelockedSets     map[TransactionSetID]timelockedSet
+		timelockedSetsSize int
+
+		// Transaction sets that spend outputs which do not exist yet can be
+		// held until their parents appear, at which point they are submitted
+		// to the pool and the orphan promotion callbacks are called.
+		orphanSets        map[TransactionSetID]orphanSet
+		orphanSetsSize    int
+		orphanPromotedFns []func(types.Transaction)
+
+		// orphanParents indexes the orphan sets by the objects they spend,
+		// and appearedObjects holds the objects that have entered the pool or
+		// the consensus set since the orphans were last promoted, so that
+		// only the orphans whose parents have appeared are retried.
+		orphanParents   map[ObjectID]map[TransactionSetID]struct{}
+		appearedObjects []ObjectID
+
+		// blockReconciliations holds the reconciliation reports of the most
+		// recently applied blocks, keyed by block id. reconciledBlocks lists
+		// the ids of the reported blocks in the order they were applied and
+		// is bounded by maxBlockReconciliations.
+		blockReconciliations map[types.BlockID]BlockReconciliation
+		reconciledBlocks     []types.BlockID
+
+		// Transaction sets with storage proofs for file contracts whose proof
+		// windows have not opened yet can be held until the windows open.
+		proofSets     map[TransactionSetID]proofSet
+		proofSetsSize int
+
+		// Transaction sets with missing parents that arrive while the
+		// consensus set is not synced can be held and retried after the next
+		// few consensus changes.
+		unsyncedSets     map[TransactionSetID]unsyncedSet
+		unsyncedSetsSize int
+
+		// Transaction sets that would replace conflicting sets can be held
+		// for a grace period before the replacement takes place.
+		pendingReplacements     map[TransactionSetID]pendingReplacement
+		pendingReplacementsSize int
+
+		// replacementCounts tracks how many times the sets spending an object
+		// have been replaced, so that MaxReplacements can be enforced. An
+		// object is forgotten once no unconfirmed transaction spends it.
+		replacementCounts map[ObjectID]int
+
+		// doubleSpends contains the objects that are spent in the pool and
+		// that another transaction set has attempted to spend as well. Like
+		// the replacement counts, objects are forgotten once no unconfirmed
+		// transaction spends them.
+		doubleSpends map[ObjectID]struct{}
+
+		// poolFingerprint is the XOR of the fingerprints of every transaction
+		// in the unconfirmed set, see Fingerprint.
+		poolFingerprint uint64
+
+		// quarantinedSources contains the sources whose transaction sets are
+		// refused by AcceptTransactionSetFrom.
+		quarantinedSources map[string]struct{}
+
+		// minerPayouts tracks the heights of the blocks that created recent
+		// miner payouts, so that transactions spending them can be held to the
+		// coinbase maturity setting.
+		minerPayouts map[types.SiacoinOutputID]types.BlockHeight
 
 		// Variables related to the blockchain.
 		blockHeight     types.BlockHeight
+		synced          bool
 		recentMedians   []types.Currency
 		recentMedianFee types.Currency // SC per byte
 
+		// replayedAfterSync is set once the first synced consensus change has
+		// started replaying the pool against the consensus set, and
+		// poolReplayed once the pool file has been replayed, after which the
+		// pool may be saved.
+		replayedAfterSync bool
+		poolReplayed      bool
+
 		// The consensus change index tracks how many consensus changes have
 		// been sent to the transaction pool. When a new subscriber joins the
 		// transaction pool, all prior consensus changes are sent to the new
 		// subscriber.
 		subscribers []modules.TransactionPoolSubscriber
 
+		// validate checks a transaction set against the consensus set, using
+		// the validation function provided by the consensus set. It is a
+		// field so that tests can control the outcome of validation.
+		validate func([]types.Transaction, func([]types.Transaction) (modules.ConsensusChange, error)) (modules.ConsensusChange, error)
+
+		// skipSignatureCheck makes Load add the transactions in the pool file
+		// before verifying their signatures, which are then verified in the
+		// background. It never applies to transactions submitted through
+		// AcceptTransactionSet, which are untrusted.
+		skipSignatureCheck bool
+
+		// fullRevalidation makes every consensus change revalidate all of the
+		// transaction sets in the pool, instead of only the sets affected by
+		// the change. It is used to compare the two in benchmarks.
+		fullRevalidation bool
+
+		// Settings of the transaction pool. See
+		// modules.TransactionPoolSettings for details.
+		coinbaseMaturity           types.BlockHeight
+		conflictGracePeriod        time.Duration
+		holdOrphanSets             bool
+		holdStorageProofs          bool
+		holdTimelockedSets         bool
+		holdUnsyncedSets           bool
+		maxPendingValue            types.Currency
+		maxPoolSize                int
+		maxReplacements            int
+		maxSignatures              int
+		minReplacementFeeBump      uint64
+		replaceConflictingPackages bool
+
 		// Utilities.
 		db         *persist.BoltDatabase
 		dbTx       *bolt.Tx
+		events     Logger
+		metrics    *poolMetrics
+		limiter    *sourceLimiter
 		log        *persist.Logger
+		seen       *seenCache
+		signatures *signatureCache
 		mu         demotemutex.DemoteMutex
 		tg         sync.ThreadGroup
 		persistDir string
@@ -84,25 +218,79 @@ func New(cs modules.ConsensusSet, g modules.Gateway, persistDir string) (*Transa
 	}
 
 	// Initialize a transaction pool.
+	metrics := newPoolMetrics()
 	tp := &TransactionPool{
 		consensusSet: cs,
 		gateway:      g,
 
-		knownObjects:        make(map[ObjectID]TransactionSetID),
-		subscriberSets:      make(map[TransactionSetID]*modules.UnconfirmedTransactionSet),
-		transactionHeights:  make(map[types.TransactionID]types.BlockHeight),
-		transactionSets:     make(map[TransactionSetID][]types.Transaction),
-		transactionSetDiffs: make(map[TransactionSetID]*modules.ConsensusChange),
-
+		knownObjects:          make(map[ObjectID]TransactionSetID),
+		subscriberSets:        make(map[TransactionSetID]*modules.UnconfirmedTransactionSet),
+		pinnedTransactions:    make(map[types.TransactionID]struct{}),
+		transactionArrivals:   make(map[types.TransactionID]time.Time),
+		transactionHeights:    make(map[types.TransactionID]types.BlockHeight),
+		transactionOrigins:    make(map[types.TransactionID]Origin),
+		transactionSources:    make(map[types.TransactionID]string),
+		quarantinedSources:    make(map[string]struct{}),
+		transactionPriorities: make(map[types.TransactionID]Priority),
+		transactionSets:       make(map[TransactionSetID][]types.Transaction),
+		transactionSetIDs:     make(map[types.TransactionID]TransactionSetID),
+		transactionSizes:      make(map[types.TransactionID]int),
+		transactionSetDiffs:   make(map[TransactionSetID]*modules.ConsensusChange),
+		timelockedSets:        make(map[TransactionSetID]timelockedSet),
+		pendingReplacements:   make(map[TransactionSetID]pendingReplacement),
+		orphanSets:            make(map[TransactionSetID]orphanSet),
+		orphanParents:         make(map[ObjectID]map[TransactionSetID]struct{}),
+		unsyncedSets:          make(map[TransactionSetID]unsyncedSet),
+		proofSets:             make(map[TransactionSetID]proofSet),
+		replacementCounts:     make(map[ObjectID]int),
+		doubleSpends:          make(map[ObjectID]struct{}),
+		unverified:            make(map[types.TransactionID]struct{}),
+		minerPayouts:          make(map[types.SiacoinOutputID]types.BlockHeight),
+		blockReconciliations:  make(map[types.BlockID]BlockReconciliation),
+
+		limiter:       newSourceLimiter(),
+		seen:          newSeenCache(),
+		signatures:    newSignatureCache(),
+		maxSignatures: defaultMaxSignatures,
+		validate:      consensusValidate,
+
+		events:     teeLogger{metrics, noopLogger{}},
+		metrics:    metrics,
 		persistDir: persistDir,
 	}
 
-	// Open the tpool database.
+	// Open the tpool database. The consensus changes sent while subscribing
+	// do not replay the pool file, which is handled below instead.
+	tp.replayedAfterSync = true
 	err := tp.initPersist()
 	if err != nil {
 		return nil, err
 	}
 
+	// Restore the transactions that were saved when the pool was last shut
+	// down, and keep saving them while the pool is running. The saved
+	// transactions are only replayed once the consensus set is synced, so
+	// that their parents exist; if it is not synced yet, the first synced
+	// consensus change replays them instead.
+	synced := cs.Synced()
+	tp.mu.Lock()
+	replay := synced || tp.synced
+	tp.replayedAfterSync = replay
+	tp.mu.Unlock()
+	if replay {
+		_, err = tp.ReplayAfterSync()
+		if err != nil {
+			tp.log.Println("WARN: could not replay the saved transaction pool:", err)
+		}
+	}
+	go tp.threadedRegularSave()
+	tp.tg.AfterStop(func() {
+		err := tp.savePoolIfReplayed()
+		if err != nil {
+			tp.log.Println("ERROR: could not save the transaction pool during shutdown:", err)
+		}
+	})
+
 	// Register RPCs
 	g.RegisterRPC("RelayTransactionSet", tp.relayTransactionSet)
 	tp.tg.OnStop(func() {
@@ -117,6 +305,64 @@ func (tp *TransactionPool) Close() error {
 	return tp.tg.Stop()
 }
 
+// Settings returns the transaction pool's current settings.
+func (tp *TransactionPool) Settings() (modules.TransactionPoolSettings, error) {
+	if err := tp.tg.Add(); err != nil {
+		return modules.TransactionPoolSettings{}, errors.AddContext(err, "cannot fetch settings, the transaction pool has closed")
+	}
+	defer tp.tg.Done()
+	tp.mu.RLock()
+	defer tp.mu.RUnlock()
+	rate, burst := tp.limiter.limits()
+	return modules.TransactionPoolSettings{
+		CoinbaseMaturity:           tp.coinbaseMaturity,
+		ConflictGracePeriod:        tp.conflictGracePeriod,
+		HoldOrphanSets:             tp.holdOrphanSets,
+		HoldStorageProofs:          tp.holdStorageProofs,
+		HoldTimelockedSets:         tp.holdTimelockedSets,
+		HoldUnsyncedSets:           tp.holdUnsyncedSets,
+		MaxPendingValue:            tp.maxPendingValue,
+		MaxPoolSize:                tp.maxPoolSize,
+		MaxReplacements:            tp.maxReplacements,
+		MaxSignatures:              tp.maxSignatures,
+		MinReplacementFeeBump:      tp.minReplacementFeeBump,
+		ReplaceConflictingPackages: tp.replaceConflictingPackages,
+		SourceBurst:                burst,
+		SourceRateLimit:            rate,
+	}, nil
+}
+
+// SetSettings will update the settings for the transaction pool.
+func (tp *TransactionPool) SetSettings(s modules.TransactionPoolSettings) error {
+	if err := tp.tg.Add(); err != nil {
+		return errors.AddContext(err, "cannot update settings, the transaction pool has closed")
+	}
+	defer tp.tg.Done()
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	err := tp.limiter.setLimits(s.SourceRateLimit, s.SourceBurst)
+	if err != nil {
+		return err
+	}
+	tp.coinbaseMaturity = s.CoinbaseMaturity
+	tp.conflictGracePeriod = s.ConflictGracePeriod
+	tp.holdOrphanSets = s.HoldOrphanSets
+	tp.holdStorageProofs = s.HoldStorageProofs
+	tp.holdTimelockedSets = s.HoldTimelockedSets
+	tp.holdUnsyncedSets = s.HoldUnsyncedSets
+	tp.maxPendingValue = s.MaxPendingValue
+	tp.maxPoolSize = s.MaxPoolSize
+	tp.maxReplacements = s.MaxReplacements
+	tp.maxSignatures = s.MaxSignatures
+	if tp.maxSignatures <= 0 {
+		tp.maxSignatures = defaultMaxSignatures
+	}
+	tp.minReplacementFeeBump = s.MinReplacementFeeBump
+	tp.replaceConflictingPackages = s.ReplaceConflictingPackages
+	tp.seen.reset()
+	return nil
+}
+
 // FeeEstimation returns an estimation for what fee should be applied to
 // transactions. It returns a minimum and maximum estimated fee per transaction
 // byte.
@@ -158,6 +404,19 @@ func (tp *TransactionPool) FeeEstimation() (min, max types.Currency) {
 		max = requiredMax
 	}
 
+	// If the pool is capped by MaxPoolSize and is close to full, a new set
+	// has to outbid the lowest fee set that can be evicted to make room.
+	lowest, full := tp.lowestEvictableFee()
+	if full {
+		outbidMin := lowest.Add(types.NewCurrency64(1)).MulFloat(minExtendMultiplier)
+		if min.Cmp(outbidMin) < 0 {
+			min = outbidMin
+		}
+		if max.Cmp(outbidMin.Mul64(maxMultiplier)) < 0 {
+			max = outbidMin.Mul64(maxMultiplier)
+		}
+	}
+
 	// Method three: sane mimimums.
 	if min.Cmp(minEstimation) < 0 {
 		min = minEstimation
@@ -169,42 +428,144 @@ func (tp *TransactionPool) FeeEstimation() (min, max types.Currency) {
 	return
 }
 
+// ConfirmationETA estimates the number of blocks that will be mined before the
+// transaction with the provided id is confirmed, assuming that no other
+// transactions join the pool and that miners fill blocks of maxBlockSize bytes
+// with the highest fee transaction sets first. 0 means that the transaction is
+// expected to be in the next block. A transaction is confirmed together with
+// the rest of its transaction set, so the space taken up by its ancestors is
+// part of the estimate. -1 is returned if the transaction is not in the pool,
+// or if its transaction set can never fit into a block.
+func (tp *TransactionPool) ConfirmationETA(id types.TransactionID, maxBlockSize uint64) int {
+	tp.mu.RLock()
+	defer tp.mu.RUnlock()
+
+	target, found := tp.findTransactionSet(id)
+	if !found || uint64(len(encoding.Marshal(tp.transactionSets[target]))) > maxBlockSize {
+		return -1
+	}
+
+	// Carve blocks off of the fee ordered sets until the target set is
+	// selected.
+	sets := make([][]types.Transaction, 0, len(tp.transactionSets))
+	for _, tSet := range tp.transactionSets {
+		sets = append(sets, tSet)
+	}
+	remaining := sortSetsByFee(sets)
+	for blocks := 0; len(remaining) > 0; blocks++ {
+		var selected [][]types.Transaction
+		selected, remaining = fillBlock(remaining, maxBlockSize)
+		for _, set := range selected {
+			if TransactionSetID(crypto.HashObject(set)) == target {
+				return blocks
+			}
+		}
+	}
+	return -1
+}
+
+// ClassifyBlock sorts the transactions of a proposed block into the ones that
+// are in the pool, the ones that double spend a pool transaction, and the rest.
+func (tp *TransactionPool) ClassifyBlock(txns []types.Transaction) (known, unknown, conflicting []types.Transaction) {
+	tp.mu.RLock()
+	defer tp.mu.RUnlock()
+	return tp.classifyBlock(txns)
+}
+
+// classifyBlock sorts the provided transactions like ClassifyBlock, without
+// locking the transaction pool.
+func (tp *TransactionPool) classifyBlock(txns []types.Transaction) (known, unknown, conflicting []types.Transaction) {
+	poolTxns := make(map[types.TransactionID]struct{})
+	spent := make(map[ObjectID]struct{})
+	for _, tSet := range tp.transactionSets {
+		for _, txn := range tSet {
+			poolTxns[txn.ID()] = struct{}{}
+			for _, oid := range spentObjectIDs(txn) {
+				spent[oid] = struct{}{}
+			}
+		}
+	}
+
+	for _, txn := range txns {
+		if _, exists := poolTxns[txn.ID()]; exists {
+			known = append(known, txn)
+			continue
+		}
+		conflicts := false
+		for _, oid := range spentObjectIDs(txn) {
+			if _, exists := spent[oid]; exists {
+				conflicts = true
+				break
+			}
+		}
+		if conflicts {
+			conflicting = append(conflicting, txn)
+		} else {
+			unknown = append(unknown, txn)
+		}
+	}
+	return known, unknown, conflicting
+}
+
+// IsMinerProfitable returns true if the miner that includes the transaction
+// in a block earns a fee from it. Transactions that only move siafunds, for
+// example, are accepted by the transaction pool without paying a fee, but are
+// not profitable to mine unless a child transaction pays for them.
+func IsMinerProfitable(t types.Transaction) bool {
+	for _, fee := range t.MinerFees {
+		if !fee.IsZero() {
+			return true
+		}
+	}
+	return false
+}
+
 // TransactionList returns a list of all transactions in the transaction pool.
 // The transactions are provided in an order that can acceptably be put into a
-// block.
+// block. Transaction sets that pay no miner fees at all are placed after the
+// sets that do.
 func (tp *TransactionPool) TransactionList() []types.Transaction {
 	tp.mu.Lock()
 	defer tp.mu.Unlock()
 
-	var txns []types.Transaction
+	var txns, unprofitable []types.Transaction
 	for _, tSet := range tp.transactionSets {
+		if transactionSetFees(tSet).IsZero() {
+			unprofitable = append(unprofitable, tSet...)
+			continue
+		}
 		txns = append(txns, tSet...)
 	}
-	return txns
+	return append(txns, unprofitable...)
 }
 
-// Transaction returns the transaction with the provided txid, its parents, and
-// a bool indicating if it exists in the transaction pool.
-func (tp *TransactionPool) Transaction(id types.TransactionID) (types.Transaction, []types.Transaction, bool) {
-	tp.mu.Lock()
-	defer tp.mu.Unlock()
-
-	// find the transaction
-	exists := false
-	var txn types.Transaction
-	var allParents []types.Transaction
+// findTransaction returns the transaction with the provided txid, all of the
+// transactions that precede it in its transaction set, and a bool indicating
+// if it exists in the transaction pool.
+func (tp *TransactionPool) findTransaction(id types.TransactionID) (types.Transaction, []types.Transaction, bool) {
 	for _, tSet := range tp.transactionSets {
 		for i, t := range tSet {
 			if t.ID() == id {
-				txn = t
-				allParents = tSet[:i]
-				exists = true
-				break
+				return t, tSet[:i], true
 			}
 		}
 	}
+	return types.Transaction{}, nil, false
+}
+
+// findTransactionSet returns the id of the transaction set that contains the
+// transaction with the provided id, and a bool indicating if it exists in the
+// transaction pool.
+func (tp *TransactionPool) findTransactionSet(id types.TransactionID) (TransactionSetID, bool) {
+	setID, exists := tp.transactionSetIDs[id]
+	return setID, exists
+}
 
-	// prune unneeded parents
+// requiredParents returns the subset of the provided parents that the
+// transaction depends on, either directly or through other parents. The
+// parents are expected to be ordered such that every transaction appears after
+// its own parents, and the returned subset preserves that order.
+func requiredParents(txn types.Transaction, parents []types.Transaction) []types.Transaction {
 	parentIDs := make(map[types.OutputID]struct{})
 	addOutputIDs := func(txn types.Transaction) {
 		for _, input := range txn.SiacoinInputs {
@@ -230,12 +591,12 @@ func (tp *TransactionPool) Transaction(id types.TransactionID) (types.Transactio
 			}
 		}
 		for i := range t.FileContracts {
-			if _, exists := parentIDs[types.OutputID(t.SiacoinOutputID(uint64(i)))]; exists {
+			if _, exists := parentIDs[types.OutputID(t.FileContractID(uint64(i)))]; exists {
 				return true
 			}
 		}
 		for i := range t.SiafundOutputs {
-			if _, exists := parentIDs[types.OutputID(t.SiacoinOutputID(uint64(i)))]; exists {
+			if _, exists := parentIDs[types.OutputID(t.SiafundOutputID(uint64(i)))]; exists {
 				return true
 			}
 		}
@@ -244,16 +605,86 @@ func (tp *TransactionPool) Transaction(id types.TransactionID) (types.Transactio
 
 	addOutputIDs(txn)
 	var necessaryParents []types.Transaction
-	for i := len(allParents) - 1; i >= 0; i-- {
-		parent := allParents[i]
+	for i := len(parents) - 1; i >= 0; i-- {
+		parent := parents[i]
 
 		if isParent(parent) {
 			necessaryParents = append([]types.Transaction{parent}, necessaryParents...)
 			addOutputIDs(parent)
 		}
 	}
+	return necessaryParents
+}
+
+// Transaction returns the transaction with the provided txid, its parents, and
+// a bool indicating if it exists in the transaction pool.
+func (tp *TransactionPool) Transaction(id types.TransactionID) (types.Transaction, []types.Transaction, bool) {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
 
-	return txn, necessaryParents, exists
+	txn, allParents, exists := tp.findTransaction(id)
+	if !exists {
+		return types.Transaction{}, nil, false
+	}
+	return txn, requiredParents(txn, allParents), true
+}
+
+// Ancestors returns every unconfirmed transaction that the transaction with
+// the provided txid depends on, directly or transitively, in dependency order.
+func (tp *TransactionPool) Ancestors(id types.TransactionID) []types.Transaction {
+	tp.mu.RLock()
+	defer tp.mu.RUnlock()
+
+	txn, allParents, exists := tp.findTransaction(id)
+	if !exists {
+		return nil
+	}
+	return requiredParents(txn, allParents)
+}
+
+// PackageSize returns the combined encoded size of the transaction with the
+// provided txid and all of its unconfirmed ancestors, which is the space that
+// the transaction needs in a block that does not contain any of its ancestors
+// yet. Ancestors shared by several parents of the transaction are only counted
+// once. 0 is returned if the transaction is not in the transaction pool.
+func (tp *TransactionPool) PackageSize(id types.TransactionID) int {
+	tp.mu.RLock()
+	defer tp.mu.RUnlock()
+
+	txn, allParents, exists := tp.findTransaction(id)
+	if !exists {
+		return 0
+	}
+	return packageSize(append(requiredParents(txn, allParents), txn))
+}
+
+// packageSize returns the combined encoded size of the provided transactions.
+func packageSize(txns []types.Transaction) int {
+	var size int
+	for _, txn := range txns {
+		size += len(encoding.Marshal(txn))
+	}
+	return size
+}
+
+// Partition splits the transactions in the transaction pool into the ones that
+// only depend on confirmed outputs, and the ones that have at least one
+// unconfirmed parent. Both lists are in dependency order, and every parent of
+// a blocked transaction appears either in confirmable or earlier in blocked.
+func (tp *TransactionPool) Partition() (confirmable, blocked []types.Transaction) {
+	tp.mu.RLock()
+	defer tp.mu.RUnlock()
+
+	for _, tSet := range tp.transactionSets {
+		for i, parents := range setDependencies(tSet) {
+			if len(parents) == 0 {
+				confirmable = append(confirmable, tSet[i])
+			} else {
+				blocked = append(blocked, tSet[i])
+			}
+		}
+	}
+	return confirmable, blocked
 }
 
 // TransactionSet returns the transaction set the provided object
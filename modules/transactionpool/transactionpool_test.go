@@ -1,11 +1,15 @@
 package transactionpool
 
 import (
+	"errors"
 	"path/filepath"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/NebulousLabs/Sia/build"
 	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/encoding"
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/modules/consensus"
 	"github.com/NebulousLabs/Sia/modules/gateway"
@@ -41,6 +45,18 @@ func blankTpoolTester(name string) (*tpoolTester, error) {
 	if err != nil {
 		return nil, err
 	}
+	// Wait for the consensus set to be synced, so that the transaction pool
+	// replays its pool file when it is created rather than after a later
+	// block.
+	err = build.Retry(100, 10*time.Millisecond, func() error {
+		if !cs.Synced() {
+			return errors.New("consensus set is not synced")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
 	tp, err := New(cs, g, filepath.Join(testdir, modules.TransactionPoolDir))
 	if err != nil {
 		return nil, err
@@ -113,6 +129,20 @@ func (tpt *tpoolTester) Close() error {
 	return nil
 }
 
+// graphSource sends value to an output that TransactionGraph can spend, and
+// mines a block to confirm it. The id of the output is returned.
+func (tpt *tpoolTester) graphSource(value types.Currency) (types.SiacoinOutputID, error) {
+	txns, err := tpt.wallet.SendSiacoins(value, types.UnlockConditions{}.UnlockHash())
+	if err != nil {
+		return types.SiacoinOutputID{}, err
+	}
+	_, err = tpt.miner.AddBlock()
+	if err != nil {
+		return types.SiacoinOutputID{}, err
+	}
+	return txns[len(txns)-1].SiacoinOutputID(0), nil
+}
+
 // TestIntegrationNewNilInputs tries to trigger a panic with nil inputs.
 func TestIntegrationNewNilInputs(t *testing.T) {
 	if testing.Short() {
@@ -216,6 +246,152 @@ func TestGetTransaction(t *testing.T) {
 	}
 }
 
+// TestAncestors checks that the transaction pool's Ancestors() method returns
+// every unconfirmed ancestor of a transaction in dependency order.
+func TestAncestors(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	tpt, err := createTpoolTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tpt.Close()
+
+	// Create a diamond shaped graph on top of an unconfirmed wallet
+	// transaction, with a single child at the bottom of the diamond.
+	txns, err := tpt.wallet.SendSiacoins(types.SiacoinPrecision.Mul64(100), types.UnlockConditions{}.UnlockHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sources := []int{0, 0, 1, 2, 3}
+	dests := []int{1, 2, 3, 3, 4}
+	values := []uint64{40, 40, 30, 30, 50}
+	var edges []types.TransactionGraphEdge
+	for i := range sources {
+		edges = append(edges, types.TransactionGraphEdge{
+			Dest:   dests[i],
+			Fee:    types.SiacoinPrecision.Mul64(10),
+			Source: sources[i],
+			Value:  types.SiacoinPrecision.Mul64(values[i]),
+		})
+	}
+	graphTxns, err := types.TransactionGraph(txns[len(txns)-1].SiacoinOutputID(0), edges)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(graphTxns) != 4 {
+		t.Fatal("wrong number of transactions produced")
+	}
+	err = tpt.tpool.AcceptTransactionSet(graphTxns)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The bottom of the diamond should have the whole diamond and the wallet
+	// transaction as ancestors, with the diamond ordered after the wallet
+	// transaction.
+	ancestors := tpt.tpool.Ancestors(graphTxns[3].ID())
+	if len(ancestors) < 4 {
+		t.Fatal("wrong number of ancestors:", len(ancestors))
+	}
+	if ancestors[len(ancestors)-4].ID() != txns[len(txns)-1].ID() {
+		t.Fatal("wallet transaction is not the first ancestor of the diamond")
+	}
+	for i, txn := range graphTxns[:3] {
+		if ancestors[len(ancestors)-3+i].ID() != txn.ID() {
+			t.Fatal("ancestors are in the wrong order")
+		}
+	}
+
+	// One side of the diamond should not depend on the other.
+	for _, ancestor := range tpt.tpool.Ancestors(graphTxns[1].ID()) {
+		if ancestor.ID() == graphTxns[2].ID() {
+			t.Fatal("unrelated transaction returned as an ancestor")
+		}
+	}
+
+	// Unknown transactions have no ancestors.
+	if tpt.tpool.Ancestors(types.TransactionID{}) != nil {
+		t.Fatal("unknown transaction has ancestors")
+	}
+}
+
+// TestPackageSize checks that PackageSize counts the ancestors shared by the
+// two sides of a diamond only once, and that BlockTemplate selects packages
+// from a set that does not fit as a whole.
+func TestPackageSize(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	tpt, err := createTpoolTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tpt.Close()
+
+	// Create a diamond shaped graph on top of a confirmed output.
+	txns, err := tpt.wallet.SendSiacoins(types.SiacoinPrecision.Mul64(100), types.UnlockConditions{}.UnlockHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tpt.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sources := []int{0, 0, 1, 2, 3}
+	dests := []int{1, 2, 3, 3, 4}
+	values := []uint64{40, 40, 30, 30, 50}
+	var edges []types.TransactionGraphEdge
+	for i := range sources {
+		edges = append(edges, types.TransactionGraphEdge{
+			Dest:   dests[i],
+			Fee:    types.SiacoinPrecision.Mul64(10),
+			Source: sources[i],
+			Value:  types.SiacoinPrecision.Mul64(values[i]),
+		})
+	}
+	graphTxns, err := types.TransactionGraph(txns[len(txns)-1].SiacoinOutputID(0), edges)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(graphTxns) != 4 {
+		t.Fatal("wrong number of transactions produced")
+	}
+	err = tpt.tpool.AcceptTransactionSet(graphTxns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sizes := make([]int, len(graphTxns))
+	for i, txn := range graphTxns {
+		sizes[i] = len(encoding.Marshal(txn))
+	}
+
+	// The top of the diamond has no unconfirmed ancestors, each side depends
+	// on the top, and the bottom depends on the whole diamond.
+	if size := tpt.tpool.PackageSize(graphTxns[0].ID()); size != sizes[0] {
+		t.Fatal("wrong package size for the top of the diamond:", size, sizes[0])
+	}
+	if size := tpt.tpool.PackageSize(graphTxns[1].ID()); size != sizes[0]+sizes[1] {
+		t.Fatal("wrong package size for a side of the diamond:", size, sizes[0]+sizes[1])
+	}
+	if size := tpt.tpool.PackageSize(graphTxns[3].ID()); size != sizes[0]+sizes[1]+sizes[2]+sizes[3] {
+		t.Fatal("shared ancestor was not counted exactly once:", size)
+	}
+	if tpt.tpool.PackageSize(types.TransactionID{}) != 0 {
+		t.Fatal("unknown transaction has a package size")
+	}
+
+	// A template with room for a single side of the diamond should contain
+	// that side and the top, even though the whole set does not fit.
+	snapshot := tpt.tpool.Freeze()
+	defer snapshot.Release()
+	template := snapshot.BlockTemplate(uint64(tpt.tpool.PackageSize(graphTxns[1].ID())))
+	if len(template) != 2 || template[0].ID() != graphTxns[0].ID() || template[1].ID() != graphTxns[1].ID() {
+		t.Fatal("block template did not select the package that fits:", len(template))
+	}
+}
+
 // TestBlockFeeEstimation checks that the fee estimation algorithm is reasonably
 // on target when the tpool is relying on blockchain based fee estimation.
 func TestFeeEstimation(t *testing.T) {
@@ -1302,3 +1478,477 @@ func TestTpoolRevert(t *testing.T) {
 		t.Error("Expected highest fee from second block to be greater than lowest fee from second block.")
 	}
 }
+
+// TestFreeze checks that a snapshot of the transaction pool does not change
+// while transactions are concurrently accepted into the pool.
+func TestFreeze(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	tpt, err := createTpoolTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tpt.Close()
+
+	// Confirm four outputs that TransactionGraph can spend. The spends are
+	// built from fixed outputs, so that they do not compete for wallet coins
+	// when they are submitted concurrently.
+	outputs := make([]types.SiacoinOutput, 4)
+	for i := range outputs {
+		outputs[i] = types.SiacoinOutput{Value: types.SiacoinPrecision.Mul64(100), UnlockHash: types.UnlockConditions{}.UnlockHash()}
+	}
+	txns, err := tpt.wallet.SendSiacoinsMulti(outputs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tpt.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parent := txns[len(txns)-1]
+	var spends [][]types.Transaction
+	for i := range parent.SiacoinOutputs {
+		if parent.SiacoinOutputs[i].UnlockHash != (types.UnlockConditions{}.UnlockHash()) {
+			continue
+		}
+		graph, err := types.TransactionGraph(parent.SiacoinOutputID(uint64(i)), []types.TransactionGraphEdge{
+			{Dest: 1, Fee: types.SiacoinPrecision, Source: 0, Value: types.SiacoinPrecision.Mul64(99)},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		spends = append(spends, graph)
+	}
+	if len(spends) != len(outputs) {
+		t.Fatal("expected a spend for every output, got", len(spends))
+	}
+
+	// Put a transaction in the pool and take a snapshot.
+	err = tpt.tpool.AcceptTransactionSet(spends[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	snapshot := tpt.tpool.Freeze()
+	frozen := snapshot.TransactionSet()
+	if len(frozen) == 0 {
+		t.Fatal("snapshot is empty")
+	}
+
+	// Concurrently add more transactions to the pool while the snapshot is
+	// held.
+	var wg sync.WaitGroup
+	errs := make(chan error, len(spends)-1)
+	for _, spend := range spends[1:] {
+		wg.Add(1)
+		go func(spend []types.Transaction) {
+			defer wg.Done()
+			errs <- tpt.tpool.AcceptTransactionSet(spend)
+		}(spend)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The pool should have grown, but the snapshot should be unchanged.
+	if len(tpt.tpool.TransactionList()) <= len(frozen) {
+		t.Fatal("transactions were not accepted while the pool was frozen")
+	}
+	after := snapshot.TransactionSet()
+	if len(after) != len(frozen) {
+		t.Fatal("snapshot changed while frozen:", len(frozen), len(after))
+	}
+	for i := range frozen {
+		if frozen[i].ID() != after[i].ID() {
+			t.Fatal("snapshot changed while frozen")
+		}
+	}
+
+	// A block template built from the snapshot should be valid, and respect
+	// the size limit.
+	template := snapshot.BlockTemplate(types.BlockSizeLimit)
+	if len(template) != len(frozen) {
+		t.Fatal("block template is missing transactions")
+	}
+	if len(snapshot.BlockTemplate(1)) != 0 {
+		t.Fatal("block template exceeds the size limit")
+	}
+	snapshot.Release()
+	if len(snapshot.TransactionSet()) != 0 {
+		t.Fatal("released snapshot still has transactions")
+	}
+}
+
+// TestBlockTransactions checks that BlockTransactions orders the sets in the
+// pool by fee per byte and puts every transaction after its parents.
+func TestBlockTransactions(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	tpt, err := createTpoolTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tpt.Close()
+
+	value := types.SiacoinPrecision.Mul64(100)
+	outputs := make([]types.SiacoinOutput, 3)
+	for i := range outputs {
+		outputs[i] = types.SiacoinOutput{Value: value, UnlockHash: types.UnlockConditions{}.UnlockHash()}
+	}
+	txns, err := tpt.wallet.SendSiacoinsMulti(outputs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tpt.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Submit a cheap set, an expensive set, and a chain whose child pays
+	// a fee between the two.
+	parent := txns[len(txns)-1]
+	var sources []types.SiacoinOutputID
+	for i := range parent.SiacoinOutputs {
+		if parent.SiacoinOutputs[i].UnlockHash == (types.UnlockConditions{}).UnlockHash() {
+			sources = append(sources, parent.SiacoinOutputID(uint64(i)))
+		}
+	}
+	fee := func(n uint64) types.Currency { return types.SiacoinPrecision.Mul64(n) }
+	edges := [][]types.TransactionGraphEdge{
+		{{Dest: 1, Fee: fee(1), Source: 0, Value: value.Sub(fee(1))}},
+		{{Dest: 1, Fee: fee(30), Source: 0, Value: value.Sub(fee(30))}},
+		{
+			{Dest: 1, Fee: fee(1), Source: 0, Value: value.Sub(fee(1))},
+			{Dest: 2, Fee: fee(20), Source: 1, Value: value.Sub(fee(21))},
+		},
+	}
+	var sets [][]types.Transaction
+	for i, e := range edges {
+		set, err := types.TransactionGraph(sources[i], e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = tpt.tpool.AcceptTransactionSet(set)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sets = append(sets, set)
+	}
+
+	expected := []types.TransactionID{sets[1][0].ID(), sets[2][0].ID(), sets[2][1].ID(), sets[0][0].ID()}
+	block := tpt.tpool.BlockTransactions()
+	if len(block) != len(expected) {
+		t.Fatalf("expected %v transactions, got %v", len(expected), len(block))
+	}
+	for i := range block {
+		if block[i].ID() != expected[i] {
+			t.Fatal("transactions are not ordered by fee:", i)
+		}
+	}
+
+	// The selection should be valid in a block.
+	err = tpt.mineTransactions(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestFeeEstimationFullPool checks that the fee estimate of a pool that is
+// close to MaxPoolSize outbids the lowest fee set in the pool.
+func TestFeeEstimationFullPool(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	tpt, err := createTpoolTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tpt.Close()
+
+	txns, err := tpt.wallet.SendSiacoins(types.SiacoinPrecision.Mul64(100), types.UnlockConditions{}.UnlockHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tpt.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	graph, err := types.TransactionGraph(txns[len(txns)-1].SiacoinOutputID(0), []types.TransactionGraphEdge{{
+		Dest:   1,
+		Fee:    types.SiacoinPrecision.Mul64(30),
+		Source: 0,
+		Value:  types.SiacoinPrecision.Mul64(70),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tpt.tpool.AcceptTransactionSet(graph)
+	if err != nil {
+		t.Fatal(err)
+	}
+	setFee := modules.CalculateFee(graph)
+	min, _ := tpt.tpool.FeeEstimation()
+	if min.Cmp(setFee) > 0 {
+		t.Fatal("estimate of an uncapped pool should not depend on the sets in it")
+	}
+
+	// Cap the pool just below the size that still fits a large transaction.
+	settings, err := tpt.tpool.Settings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings.MaxPoolSize = tpt.tpool.transactionListSize + modules.TransactionSizeLimit - 1
+	err = tpt.tpool.SetSettings(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	min, max := tpt.tpool.FeeEstimation()
+	if min.Cmp(setFee) <= 0 || max.Cmp(min) <= 0 {
+		t.Fatal("estimate of a full pool does not outbid the lowest fee set:", min, max, setFee)
+	}
+}
+
+// TestConfirmationETA checks that ConfirmationETA orders transactions by fee
+// when estimating how many blocks they will wait for.
+func TestConfirmationETA(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	tpt, err := createTpoolTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tpt.Close()
+
+	// Create three outputs that TransactionGraph can spend, and confirm them.
+	var sources []types.SiacoinOutputID
+	for i := 0; i < 3; i++ {
+		txns, err := tpt.wallet.SendSiacoins(types.SiacoinPrecision.Mul64(100), types.UnlockConditions{}.UnlockHash())
+		if err != nil {
+			t.Fatal(err)
+		}
+		sources = append(sources, txns[len(txns)-1].SiacoinOutputID(0))
+	}
+	_, err = tpt.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Spend each output with a different fee.
+	var ids []types.TransactionID
+	var setSize uint64
+	for i, fee := range []uint64{30, 20, 10} {
+		graphTxns, err := types.TransactionGraph(sources[i], []types.TransactionGraphEdge{{
+			Dest:   1,
+			Fee:    types.SiacoinPrecision.Mul64(fee),
+			Source: 0,
+			Value:  types.SiacoinPrecision.Mul64(100 - fee),
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = tpt.tpool.AcceptTransactionSet(graphTxns)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, graphTxns[0].ID())
+		setSize = uint64(len(encoding.Marshal(graphTxns)))
+	}
+
+	// With room for one set per block, the sets should be confirmed in fee
+	// order.
+	for i, id := range ids {
+		if eta := tpt.tpool.ConfirmationETA(id, setSize); eta != i {
+			t.Errorf("expected ETA %v for transaction %v, got %v", i, i, eta)
+		}
+	}
+	// All sets fit into a large block.
+	for _, id := range ids {
+		if eta := tpt.tpool.ConfirmationETA(id, types.BlockSizeLimit); eta != 0 {
+			t.Error("expected ETA 0, got", eta)
+		}
+	}
+	// Sets that can never fit, and unknown transactions, have no ETA.
+	if eta := tpt.tpool.ConfirmationETA(ids[0], setSize-1); eta != -1 {
+		t.Error("expected ETA -1 for an oversized set, got", eta)
+	}
+	if eta := tpt.tpool.ConfirmationETA(types.TransactionID{}, types.BlockSizeLimit); eta != -1 {
+		t.Error("expected ETA -1 for an unknown transaction, got", eta)
+	}
+}
+
+// TestClassifyBlock checks that ClassifyBlock distinguishes between known,
+// unknown, and conflicting transactions.
+func TestClassifyBlock(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	tpt, err := createTpoolTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tpt.Close()
+
+	// Create two outputs that TransactionGraph can spend, and confirm them.
+	var sources []types.SiacoinOutputID
+	for i := 0; i < 2; i++ {
+		txns, err := tpt.wallet.SendSiacoins(types.SiacoinPrecision.Mul64(100), types.UnlockConditions{}.UnlockHash())
+		if err != nil {
+			t.Fatal(err)
+		}
+		sources = append(sources, txns[len(txns)-1].SiacoinOutputID(0))
+	}
+	_, err = tpt.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	spend := func(source types.SiacoinOutputID, fee uint64) types.Transaction {
+		graphTxns, err := types.TransactionGraph(source, []types.TransactionGraphEdge{{
+			Dest:   1,
+			Fee:    types.SiacoinPrecision.Mul64(fee),
+			Source: 0,
+			Value:  types.SiacoinPrecision.Mul64(100 - fee),
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return graphTxns[0]
+	}
+
+	// Put a spend of the first output in the pool.
+	poolTxn := spend(sources[0], 10)
+	err = tpt.tpool.AcceptTransactionSet([]types.Transaction{poolTxn})
+	if err != nil {
+		t.Fatal(err)
+	}
+	doubleSpend := spend(sources[0], 20)
+	newTxn := spend(sources[1], 10)
+
+	known, unknown, conflicting := tpt.tpool.ClassifyBlock([]types.Transaction{newTxn, poolTxn, doubleSpend})
+	if len(known) != 1 || known[0].ID() != poolTxn.ID() {
+		t.Error("pool transaction was not classified as known")
+	}
+	if len(unknown) != 1 || unknown[0].ID() != newTxn.ID() {
+		t.Error("new transaction was not classified as unknown")
+	}
+	if len(conflicting) != 1 || conflicting[0].ID() != doubleSpend.ID() {
+		t.Error("double spend was not classified as conflicting")
+	}
+	if len(tpt.tpool.TransactionList()) != 1 {
+		t.Error("ClassifyBlock modified the transaction pool")
+	}
+}
+
+// TestSiafundOnlyTransaction checks that a transaction moving only siafunds
+// is accepted without a fee, is not miner profitable, and is listed after
+// transactions that pay fees.
+func TestSiafundOnlyTransaction(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	tpt, err := createTpoolTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tpt.Close()
+
+	// Spend the anyone-can-spend siafund output of the genesis block, which is
+	// only available during testing.
+	genesisTxn := types.GenesisBlock.Transactions[0]
+	sfTxn := types.Transaction{
+		SiafundInputs: []types.SiafundInput{{
+			ParentID:         genesisTxn.SiafundOutputID(2),
+			UnlockConditions: types.UnlockConditions{},
+		}},
+		SiafundOutputs: []types.SiafundOutput{{
+			Value:      genesisTxn.SiafundOutputs[2].Value,
+			UnlockHash: types.UnlockHash{1},
+		}},
+	}
+	if IsMinerProfitable(sfTxn) {
+		t.Fatal("siafund only transaction should not be miner profitable")
+	}
+	err = tpt.tpool.AcceptTransactionSet([]types.Transaction{sfTxn})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Add a fee paying transaction, which should be listed first.
+	txns, err := tpt.wallet.SendSiacoins(types.SiacoinPrecision, types.UnlockConditions{}.UnlockHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsMinerProfitable(txns[len(txns)-1]) {
+		t.Fatal("wallet transaction should be miner profitable")
+	}
+	list := tpt.tpool.TransactionList()
+	if len(list) < 2 || list[len(list)-1].ID() != sfTxn.ID() {
+		t.Fatal("siafund only transaction should be listed last")
+	}
+}
+
+// TestPartition checks that Partition separates the transactions that only
+// depend on confirmed outputs from the ones with unconfirmed parents.
+func TestPartition(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	tpt, err := createTpoolTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tpt.Close()
+
+	txns, err := tpt.wallet.SendSiacoins(types.SiacoinPrecision.Mul64(100), types.UnlockConditions{}.UnlockHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tpt.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Create a parent with two children, one of which has another child.
+	graph, err := types.TransactionGraph(txns[len(txns)-1].SiacoinOutputID(0), []types.TransactionGraphEdge{
+		{Dest: 1, Fee: types.SiacoinPrecision.Mul64(10), Source: 0, Value: types.SiacoinPrecision.Mul64(90)},
+		{Dest: 2, Fee: types.SiacoinPrecision.Mul64(5), Source: 1, Value: types.SiacoinPrecision.Mul64(40)},
+		{Dest: 3, Fee: types.SiacoinPrecision.Mul64(5), Source: 1, Value: types.SiacoinPrecision.Mul64(40)},
+		{Dest: 4, Fee: types.SiacoinPrecision.Mul64(10), Source: 2, Value: types.SiacoinPrecision.Mul64(30)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tpt.tpool.AcceptTransactionSet(graph)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	confirmable, blocked := tpt.tpool.Partition()
+	if len(confirmable) != 1 || confirmable[0].ID() != graph[0].ID() {
+		t.Fatal("only the parent should be confirmable:", len(confirmable))
+	}
+	if len(blocked) != len(graph)-1 {
+		t.Fatal("expected every child to be blocked, got", len(blocked))
+	}
+
+	// Every parent of a blocked transaction should come before it.
+	seen := make(map[types.SiacoinOutputID]struct{})
+	for _, txn := range append(confirmable, blocked...) {
+		for _, sci := range txn.SiacoinInputs {
+			if sci.ParentID == txns[len(txns)-1].SiacoinOutputID(0) {
+				continue
+			}
+			if _, exists := seen[sci.ParentID]; !exists {
+				t.Fatal("transaction appears before its parent")
+			}
+		}
+		for i := range txn.SiacoinOutputs {
+			seen[txn.SiacoinOutputID(uint64(i))] = struct{}{}
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package transactionpool
+
+import (
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+
+	"github.com/NebulousLabs/errors"
+)
+
+var (
+	errFullUnsyncedSets = errors.New("transaction pool cannot hold more transaction sets while the consensus set is not synced")
+	errUnsyncedSetHeld  = errors.New("transaction set depends on outputs or file contracts that the consensus set may not have applied yet and will be retried after the next block")
+)
+
+type (
+	// unsyncedSet is a transaction set that spends outputs, or revises or
+	// proves file contracts, which were missing while the consensus set was
+	// not synced. The parents are likely to be part of a block that has not
+	// been applied yet, so the set is retried after each consensus change
+	// until it has been retried maxUnsyncedRetries times.
+	unsyncedSet struct {
+		retries int
+		size    int
+		set     []types.Transaction
+	}
+)
+
+// holdUnsyncedSet stores a transaction set whose parents are missing while
+// the consensus set is not synced, so that it can be retried after the next
+// consensus change.
+func (tp *TransactionPool) holdUnsyncedSet(ts []types.Transaction) error {
+	setID := TransactionSetID(crypto.HashObject(ts))
+	if _, exists := tp.unsyncedSets[setID]; exists {
+		return modules.ErrDuplicateTransactionSet
+	}
+	setSize := len(encoding.Marshal(ts))
+	if tp.unsyncedSetsSize+setSize > maxUnsyncedSetsSize {
+		return errFullUnsyncedSets
+	}
+	tp.unsyncedSets[setID] = unsyncedSet{
+		size: setSize,
+		set:  ts,
+	}
+	tp.unsyncedSetsSize += setSize
+	return errUnsyncedSetHeld
+}
+
+// retryUnsyncedSets submits the transaction sets that were held while the
+// consensus set was not synced. Unlike orphans, the sets are only held for a
+// few consensus changes. Once the consensus set is synced, sets that are still
+// missing parents are treated like any other set with missing parents, which
+// means that they are either held as orphans or dropped. The accepted
+// transaction sets are relayed to peers.
+func (tp *TransactionPool) retryUnsyncedSets(txnFn func([]types.Transaction) (modules.ConsensusChange, error)) {
+	held := tp.unsyncedSets
+	tp.unsyncedSets = make(map[TransactionSetID]unsyncedSet)
+	tp.unsyncedSetsSize = 0
+	for setID, us := range held {
+		err := tp.acceptTransactionSet(us.set, txnFn)
+		if err == errUnsyncedSetHeld {
+			// Keep the number of times that the set has been retried.
+			us.retries++
+			if us.retries >= maxUnsyncedRetries {
+				delete(tp.unsyncedSets, setID)
+				tp.unsyncedSetsSize -= us.size
+				tp.log.Debugln("Transaction set held while the consensus set was not synced was dropped after", us.retries, "retries")
+				continue
+			}
+			tp.unsyncedSets[setID] = us
+			continue
+		} else if err == errOrphanSetHeld {
+			continue
+		} else if err != nil {
+			tp.log.Debugln("Transaction set held while the consensus set was not synced was dropped:", err)
+			continue
+		}
+		tp.setOrigin(us.set, OriginHeld)
+		for _, txn := range us.set {
+			tp.events.LogAccept(transactionEvent(txn))
+		}
+		go tp.gateway.Broadcast("RelayTransactionSet", us.set, tp.gateway.Peers())
+	}
+}
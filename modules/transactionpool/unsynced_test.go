@@ -0,0 +1,110 @@
+package transactionpool
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestUnsyncedSets checks that a transaction arriving just ahead of the block
+// that confirms its parent is held while the consensus set is not synced, and
+// that it is accepted once the block has been applied.
+func TestUnsyncedSets(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	tpt, err := createTpoolTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tpt.Close()
+
+	// Wait for the consensus set to finish its initial blockchain download,
+	// so that the consensus changes report the consensus set as synced.
+	err = build.Retry(50, 100*time.Millisecond, func() error {
+		if !tpt.cs.Synced() {
+			return errors.New("consensus set is not synced")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	txns, err := tpt.wallet.SendSiacoins(types.SiacoinPrecision.Mul64(100), types.UnlockConditions{}.UnlockHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tpt.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	graph, err := types.TransactionGraph(txns[len(txns)-1].SiacoinOutputID(0), []types.TransactionGraphEdge{
+		{Dest: 1, Fee: types.SiacoinPrecision.Mul64(10), Source: 0, Value: types.SiacoinPrecision.Mul64(90)},
+		{Dest: 2, Fee: types.SiacoinPrecision.Mul64(10), Source: 1, Value: types.SiacoinPrecision.Mul64(80)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parent, child := graph[0], graph[1]
+	orphan := types.Transaction{
+		SiacoinInputs: []types.SiacoinInput{{ParentID: types.SiacoinOutputID{1}}},
+	}
+
+	err = tpt.tpool.SetSettings(modules.TransactionPoolSettings{HoldUnsyncedSets: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// While the consensus set is synced, missing parents are not attributed
+	// to unapplied blocks.
+	err = tpt.tpool.AcceptTransactionSet([]types.Transaction{child})
+	if _, ok := err.(modules.ConsensusConflict); !ok {
+		t.Fatal("expected a consensus conflict, got", err)
+	}
+
+	// Once the consensus set falls behind, the child and the orphan are held.
+	// Falling behind is normally reported by a consensus change, which also
+	// resets the results of earlier submissions.
+	tpt.tpool.mu.Lock()
+	tpt.tpool.synced = false
+	tpt.tpool.seen.reset()
+	tpt.tpool.mu.Unlock()
+	for _, txn := range []types.Transaction{child, orphan} {
+		err = tpt.tpool.AcceptTransactionSet([]types.Transaction{txn})
+		if err != errUnsyncedSetHeld {
+			t.Fatal("expected errUnsyncedSetHeld, got", err)
+		}
+	}
+	if _, _, exists := tpt.tpool.Transaction(child.ID()); exists {
+		t.Fatal("held set was added to the pool")
+	}
+
+	// The block confirming the parent is applied, after which the child is
+	// accepted. The orphan still has no parent now that the consensus set is
+	// synced again, so it is dropped rather than held as an orphan.
+	err = tpt.tpool.AcceptTransactionSet([]types.Transaction{parent})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tpt.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, exists := tpt.tpool.Transaction(child.ID()); !exists {
+		t.Fatal("held set was not accepted after the next block")
+	}
+	if origin, _ := tpt.tpool.Origin(child.ID()); origin != OriginHeld {
+		t.Fatal("expected the held set to have OriginHeld, got", origin)
+	}
+	if len(tpt.tpool.unsyncedSets) != 0 || tpt.tpool.unsyncedSetsSize != 0 {
+		t.Fatal("sets are still held after the consensus set synced")
+	}
+	if len(tpt.tpool.orphanSets) != 0 {
+		t.Fatal("set held while unsynced was held as an orphan")
+	}
+}
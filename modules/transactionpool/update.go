@@ -4,10 +4,15 @@ import (
 	"bytes"
 	"fmt"
 	"sort"
+	"time"
 
+	"github.com/NebulousLabs/Sia/build"
 	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/encoding"
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/types"
+
+	"github.com/NebulousLabs/errors"
 )
 
 // findSets takes a bunch of transactions (presumably from a block) and finds
@@ -160,12 +165,174 @@ func findSets(ts []types.Transaction) [][]types.Transaction {
 	return ret
 }
 
-// purge removes all transactions from the transaction pool.
+// removeTransactionSet removes a transaction set from the unconfirmed set,
+// along with every known object that points to the set.
+func (tp *TransactionPool) removeTransactionSet(setID TransactionSetID) {
+	tSet, exists := tp.transactionSets[setID]
+	if !exists {
+		return
+	}
+	for _, oid := range relatedObjectIDs(tSet) {
+		if tp.knownObjects[oid] == setID {
+			delete(tp.knownObjects, oid)
+		}
+	}
+	for _, txn := range tSet {
+		tp.poolFingerprint ^= transactionFingerprint(txn.ID())
+		if tp.transactionSetIDs[txn.ID()] == setID {
+			delete(tp.transactionSetIDs, txn.ID())
+			delete(tp.transactionSizes, txn.ID())
+		}
+	}
+	tp.transactionListSize -= len(encoding.Marshal(tSet))
+	tp.transactionListFees = tp.transactionListFees.Sub(transactionSetFees(tSet))
+	tp.transactionListValue = tp.transactionListValue.Sub(transactionSetValue(tSet))
+	tp.unconfirmedVersion++
+	delete(tp.transactionSets, setID)
+	delete(tp.transactionSetDiffs, setID)
+	if build.DEBUG {
+		tp.checkTransactionListFees()
+	}
+}
+
+// checkTransactionListFees compares the running total of the fees in the
+// transaction pool against a full recomputation.
+func (tp *TransactionPool) checkTransactionListFees() {
+	var fees types.Currency
+	for _, tSet := range tp.transactionSets {
+		fees = fees.Add(transactionSetFees(tSet))
+	}
+	if !fees.Equals(tp.transactionListFees) {
+		build.Critical("transaction pool fee total is inconsistent:", tp.transactionListFees, fees)
+	}
+}
+
+// conflictsWithBlock returns the unconfirmed transactions that spend an object
+// that is also spent by one of the provided block transactions. Transactions
+// that are themselves part of the block are not conflicts.
+func (tp *TransactionPool) conflictsWithBlock(txns []types.Transaction) []types.Transaction {
+	blockTxns := make(map[types.TransactionID]struct{})
+	spent := make(map[ObjectID]struct{})
+	for _, txn := range txns {
+		blockTxns[txn.ID()] = struct{}{}
+		for _, oid := range spentObjectIDs(txn) {
+			spent[oid] = struct{}{}
+		}
+	}
+
+	var conflicts []types.Transaction
+	for _, tSet := range tp.transactionSets {
+		for _, txn := range tSet {
+			if _, exists := blockTxns[txn.ID()]; exists {
+				continue
+			}
+			for _, oid := range spentObjectIDs(txn) {
+				if _, exists := spent[oid]; exists {
+					conflicts = append(conflicts, txn)
+					break
+				}
+			}
+		}
+	}
+	return conflicts
+}
+
+// ConflictsWithBlock returns the transactions in the transaction pool that
+// spend an object that is also spent by one of the provided transactions.
+func (tp *TransactionPool) ConflictsWithBlock(txns []types.Transaction) []types.Transaction {
+	tp.mu.RLock()
+	defer tp.mu.RUnlock()
+	return tp.conflictsWithBlock(txns)
+}
+
+// forgetTransaction deletes the metadata that the transaction pool tracks for
+// a transaction that is leaving the pool.
+func (tp *TransactionPool) forgetTransaction(id types.TransactionID) {
+	delete(tp.transactionArrivals, id)
+	delete(tp.transactionHeights, id)
+	delete(tp.transactionOrigins, id)
+	delete(tp.transactionSources, id)
+	delete(tp.transactionPriorities, id)
+	delete(tp.pinnedTransactions, id)
+	delete(tp.unverified, id)
+}
+
+// purge removes all transactions from the transaction pool, along with the
+// metadata tracked for them.
 func (tp *TransactionPool) purge() {
+	tp.purgeSets()
+	tp.transactionArrivals = make(map[types.TransactionID]time.Time)
+	tp.transactionHeights = make(map[types.TransactionID]types.BlockHeight)
+	tp.transactionOrigins = make(map[types.TransactionID]Origin)
+	tp.transactionSources = make(map[types.TransactionID]string)
+	tp.transactionPriorities = make(map[types.TransactionID]Priority)
+	tp.pinnedTransactions = make(map[types.TransactionID]struct{})
+}
+
+// purgeSets removes all transaction sets from the transaction pool, but keeps
+// the metadata of their transactions, so that the transactions can be added
+// back one at a time.
+func (tp *TransactionPool) purgeSets() {
 	tp.knownObjects = make(map[ObjectID]TransactionSetID)
 	tp.transactionSets = make(map[TransactionSetID][]types.Transaction)
+	tp.transactionSetIDs = make(map[types.TransactionID]TransactionSetID)
+	tp.transactionSizes = make(map[types.TransactionID]int)
 	tp.transactionSetDiffs = make(map[TransactionSetID]*modules.ConsensusChange)
+	tp.unverified = make(map[types.TransactionID]struct{})
+	tp.poolFingerprint = 0
 	tp.transactionListSize = 0
+	tp.transactionListFees = types.ZeroCurrency
+	tp.transactionListValue = types.ZeroCurrency
+	tp.unconfirmedVersion++
+}
+
+// affectedSets returns the ids of the transaction sets that have to be
+// revalidated after the provided consensus change. If blocks were reverted,
+// every set is affected, since the outputs they spend may no longer exist.
+// Otherwise, a set is only affected if it contains a transaction that was
+// confirmed, conflicts with the applied blocks, or has reached maxTxnAge, if
+// it spends or creates an object that the applied blocks touch, or if its
+// validity depends on the height or on the siafund pool, which is the case
+// for sets with file contracts, revisions, storage proofs, or siafund inputs.
+// Sets with transactions whose signatures have not been verified yet are
+// affected as well, so that they are fully validated. Sets that are not
+// affected remain valid, so block processing scales with
+// the size of the applied blocks rather than with the size of the pool.
+func (tp *TransactionPool) affectedSets(cc modules.ConsensusChange, txids, conflicts map[types.TransactionID]struct{}) map[TransactionSetID]struct{} {
+	affected := make(map[TransactionSetID]struct{})
+	if len(cc.RevertedBlocks) > 0 || tp.fullRevalidation {
+		for setID := range tp.transactionSets {
+			affected[setID] = struct{}{}
+		}
+		return affected
+	}
+
+	for _, block := range cc.AppliedBlocks {
+		for _, oid := range relatedObjectIDs(block.Transactions) {
+			if setID, exists := tp.knownObjects[oid]; exists {
+				affected[setID] = struct{}{}
+			}
+		}
+	}
+	for setID, tSet := range tp.transactionSets {
+		if _, exists := affected[setID]; exists {
+			continue
+		}
+		pinned := tp.setPinned(tSet)
+		for _, txn := range tSet {
+			_, confirmed := txids[txn.ID()]
+			_, conflicting := conflicts[txn.ID()]
+			seenHeight, seen := tp.transactionHeights[txn.ID()]
+			expired := seen && !pinned && tp.blockHeight-seenHeight > maxTxnAge
+			heightDependent := len(txn.FileContracts) > 0 || len(txn.FileContractRevisions) > 0 || len(txn.StorageProofs) > 0 || len(txn.SiafundInputs) > 0
+			_, unverified := tp.unverified[txn.ID()]
+			if confirmed || conflicting || expired || heightDependent || unverified {
+				affected[setID] = struct{}{}
+				break
+			}
+		}
+	}
+	return affected
 }
 
 // ProcessConsensusChange gets called to inform the transaction pool of changes
@@ -197,6 +364,7 @@ func (tp *TransactionPool) ProcessConsensusChange(cc modules.ConsensusChange) {
 			panic(fmt.Sprintf("Consensus change series appears to be inconsistent - we are reverting the wrong block. bid: %v recent: %v", block.ID(), recentID))
 		}
 		recentID = block.ParentID
+		tp.forgetReconciliation(block.ID())
 
 		if tp.blockHeight > 0 || block.ID() != types.GenesisID {
 			tp.blockHeight--
@@ -207,6 +375,12 @@ func (tp *TransactionPool) ProcessConsensusChange(cc modules.ConsensusChange) {
 				tp.log.Println("ERROR: could not delete a transaction:", err)
 			}
 		}
+		for i := range block.MinerPayouts {
+			err := tp.deleteMinerPayout(tp.dbTx, block.MinerPayoutID(uint64(i)))
+			if err != nil {
+				tp.log.Println("ERROR: could not delete a miner payout:", err)
+			}
+		}
 
 		// Pull the transactions out of the fee summary. For estimating only
 		// over 10 blocks, it is extremely likely that there will be more
@@ -228,12 +402,26 @@ func (tp *TransactionPool) ProcessConsensusChange(cc modules.ConsensusChange) {
 		if tp.blockHeight > 0 || block.ID() != types.GenesisID {
 			tp.blockHeight++
 		}
+
+		// Record what the block does to the pool before the pool is updated.
+		br := tp.reconcileBlock(block, tp.blockHeight)
+		tp.recordReconciliation(br)
+		tp.log.Debugf("block %v (height %v): %v transactions, %v confirmed from the pool, %v evicted\n", crypto.Hash(br.BlockID).String()[:8], br.Height, len(br.Transactions), len(br.Confirmed), len(br.Evicted))
+
 		for _, txn := range block.Transactions {
 			err := tp.putTransaction(tp.dbTx, txn.ID())
 			if err != nil {
 				tp.log.Println("ERROR: could not add a transaction:", err)
 			}
 		}
+		if tp.coinbaseMaturity > types.MaturityDelay {
+			for i := range block.MinerPayouts {
+				err := tp.putMinerPayout(tp.dbTx, block.MinerPayoutID(uint64(i)), tp.blockHeight)
+				if err != nil {
+					tp.log.Println("ERROR: could not add a miner payout:", err)
+				}
+			}
+		}
 
 		// Find the median transaction fee for this block.
 		type feeSummary struct {
@@ -291,6 +479,16 @@ func (tp *TransactionPool) ProcessConsensusChange(cc modules.ConsensusChange) {
 			tp.recentMedians = tp.recentMedians[1:]
 		}
 	}
+	// Stop tracking miner payouts that have reached maturity.
+	for id, height := range tp.minerPayouts {
+		if tp.blockHeight-height >= tp.coinbaseMaturity {
+			err := tp.deleteMinerPayout(tp.dbTx, id)
+			if err != nil {
+				tp.log.Println("ERROR: could not delete a miner payout:", err)
+			}
+		}
+	}
+
 	// Grab the median of the recent medians. Copy to a new slice so the sorting
 	// doesn't screw up the slice.
 	safeMedians := make([]types.Currency, len(tp.recentMedians))
@@ -321,6 +519,14 @@ func (tp *TransactionPool) ProcessConsensusChange(cc modules.ConsensusChange) {
 		tp.log.Println("ERROR: could not update the transaction pool median fee information:", err)
 	}
 
+	// Revalidate transactions with the signature cache, so that the
+	// signatures of the transactions that remain in the pool are not
+	// verified again.
+	txnFn := cc.TryTransactionSet
+	if cc.TryTrustedTransactionSet != nil {
+		txnFn = tp.cachedTxnFn(cc.TryTrustedTransactionSet)
+	}
+
 	// Scan the applied blocks for transactions that got accepted. This will
 	// help to determine which transactions to remove from the transaction
 	// pool. Having this list enables both efficiency improvements and helps to
@@ -333,9 +539,25 @@ func (tp *TransactionPool) ProcessConsensusChange(cc modules.ConsensusChange) {
 		}
 	}
 
-	// Save all of the current unconfirmed transaction sets into a list.
+	// Find the unconfirmed transactions that double spend the applied blocks.
+	var appliedTxns []types.Transaction
+	for _, block := range cc.AppliedBlocks {
+		appliedTxns = append(appliedTxns, block.Transactions...)
+	}
+	conflicts := make(map[types.TransactionID]struct{})
+	for _, txn := range tp.conflictsWithBlock(appliedTxns) {
+		conflicts[txn.ID()] = struct{}{}
+	}
+
+	// Save all of the unconfirmed transaction sets that need to be
+	// revalidated into a list. The other sets are left in the pool as they
+	// are.
+	affected := tp.affectedSets(cc, txids, conflicts)
 	var unconfirmedSets [][]types.Transaction
-	for _, tSet := range tp.transactionSets {
+	for setID, tSet := range tp.transactionSets {
+		if _, exists := affected[setID]; !exists {
+			continue
+		}
 		// Compile a new transaction set the removes all transactions duplicated
 		// in the block. Though mostly handled by the dependency manager in the
 		// transaction pool, this should both improve efficiency and will strip
@@ -344,26 +566,43 @@ func (tp *TransactionPool) ProcessConsensusChange(cc modules.ConsensusChange) {
 		var newTSet []types.Transaction
 		for _, txn := range tSet {
 			_, exists := txids[txn.ID()]
-			if !exists {
+			_, conflicting := conflicts[txn.ID()]
+			if conflicting {
+				tp.forgetTransaction(txn.ID())
+				tp.events.LogEvict(transactionEvent(txn))
+			} else if !exists {
 				newTSet = append(newTSet, txn)
+			} else {
+				tp.forgetTransaction(txn.ID())
 			}
 		}
 		unconfirmedSets = append(unconfirmedSets, newTSet)
 	}
 
-	// Purge the transaction pool. Some of the transactions sets may be invalid
-	// after the consensus change.
-	tp.purge()
+	// Remove the affected sets from the transaction pool. Some of them may be
+	// invalid after the consensus change.
+	if len(affected) == len(tp.transactionSets) {
+		tp.purgeSets()
+	} else {
+		for setID := range affected {
+			tp.removeTransactionSet(setID)
+		}
+	}
 
-	// prune transactions older than maxTxnAge.
+	// prune transactions older than maxTxnAge. Sets with pinned transactions
+	// never expire.
 	for i, tSet := range unconfirmedSets {
+		if tp.setPinned(tSet) {
+			continue
+		}
 		var validTxns []types.Transaction
 		for _, txn := range tSet {
 			seenHeight, seen := tp.transactionHeights[txn.ID()]
 			if tp.blockHeight-seenHeight <= maxTxnAge || !seen {
 				validTxns = append(validTxns, txn)
 			} else {
-				delete(tp.transactionHeights, txn.ID())
+				tp.forgetTransaction(txn.ID())
+				tp.events.LogEvict(transactionEvent(txn))
 			}
 		}
 		unconfirmedSets[i] = validTxns
@@ -382,7 +621,13 @@ func (tp *TransactionPool) ProcessConsensusChange(cc modules.ConsensusChange) {
 			}
 
 			// Try adding the transaction back into the transaction pool.
-			tp.acceptTransactionSet([]types.Transaction{txn}, cc.TryTransactionSet) // Error is ignored.
+			err := tp.acceptTransactionSet([]types.Transaction{txn}, txnFn)
+			if err == nil {
+				// The transaction left the pool when it was confirmed, so
+				// it re-enters through the reorg.
+				tp.transactionOrigins[txn.ID()] = OriginReorg
+				tp.events.LogReorg(transactionEvent(txn))
+			}
 		}
 	}
 
@@ -402,15 +647,60 @@ func (tp *TransactionPool) ProcessConsensusChange(cc modules.ConsensusChange) {
 	// more rules need to be put in place.
 	for _, set := range unconfirmedSets {
 		for _, txn := range set {
-			err := tp.acceptTransactionSet([]types.Transaction{txn}, cc.TryTransactionSet)
+			err := tp.acceptTransactionSet([]types.Transaction{txn}, txnFn)
 			if err != nil {
 				// The transaction is no longer valid, delete it from the
 				// heights map to prevent a memory leak.
-				delete(tp.transactionHeights, txn.ID())
+				tp.forgetTransaction(txn.ID())
+			} else {
+				// The signatures of the transaction have been verified by
+				// txnFn.
+				delete(tp.unverified, txn.ID())
 			}
 		}
 	}
 
+	// Sets with missing parents are only held for the consensus set to catch
+	// up while it is not synced. Once it has caught up for the first time, the
+	// pool is replayed against it. Replaying needs the consensus set, which is
+	// locked during consensus changes, so it happens in a goroutine.
+	if cc.Synced && !tp.synced && !tp.replayedAfterSync {
+		tp.replayedAfterSync = true
+		go tp.threadedReplayAfterSync()
+	}
+	tp.synced = cc.Synced
+
+	// Submit any held transaction sets that have become final at the new
+	// height.
+	tp.promoteTimelockedSets(txnFn)
+
+	// Submit any held storage proofs whose proof windows have opened, and
+	// drop the ones that can no longer become valid.
+	tp.promoteProofSets(txnFn)
+
+	// Retry the sets that were held while the consensus set was not synced,
+	// and submit any orphan transaction sets whose parents have appeared.
+	tp.retryUnsyncedSets(txnFn)
+	tp.expireOrphanSets()
+	tp.noteAppearedObjects(cc)
+	tp.promoteOrphanSets(txnFn)
+
+	// The consensus change may have changed which transaction sets are valid.
+	tp.seen.reset()
+
+	// Forget the replacement counts and double spend attempts of objects that
+	// are no longer spent by any unconfirmed transaction.
+	for oid := range tp.replacementCounts {
+		if _, exists := tp.knownObjects[oid]; !exists {
+			delete(tp.replacementCounts, oid)
+		}
+	}
+	for oid := range tp.doubleSpends {
+		if _, exists := tp.knownObjects[oid]; !exists {
+			delete(tp.doubleSpends, oid)
+		}
+	}
+
 	// Inform subscribers that an update has executed.
 	tp.mu.Demote()
 	tp.updateSubscribersTransactions()
@@ -423,3 +713,73 @@ func (tp *TransactionPool) PurgeTransactionPool() {
 	tp.purge()
 	tp.mu.Unlock()
 }
+
+// A ReconcileReport lists the transactions that were removed from the
+// transaction pool by Reconcile.
+type ReconcileReport struct {
+	// Confirmed contains the transactions that were already on the
+	// blockchain.
+	Confirmed []types.TransactionID
+	// Invalid contains the transactions that are no longer valid given the
+	// current consensus set.
+	Invalid []types.TransactionID
+}
+
+// Reconcile checks every transaction in the transaction pool against the
+// current consensus set, removing transactions that have been confirmed or
+// that have become invalid. Consensus changes normally keep the pool up to
+// date, so Reconcile is a heavier recovery path for when the pool may have
+// fallen out of sync with the consensus set.
+func (tp *TransactionPool) Reconcile() (ReconcileReport, error) {
+	if err := tp.tg.Add(); err != nil {
+		return ReconcileReport{}, err
+	}
+	defer tp.tg.Done()
+	cs, ok := tp.consensusSet.(interface {
+		LockedTryTransactionSet(fn func(func(txns []types.Transaction) (modules.ConsensusChange, error)) error) error
+	})
+	if !ok {
+		return ReconcileReport{}, errors.New("consensus set does not support LockedTryTransactionSet method")
+	}
+
+	var report ReconcileReport
+	err := cs.LockedTryTransactionSet(func(txnFn func(txns []types.Transaction) (modules.ConsensusChange, error)) error {
+		tp.mu.Lock()
+		defer tp.mu.Unlock()
+
+		// Strip the confirmed transactions out of the unconfirmed sets.
+		var unconfirmedSets [][]types.Transaction
+		for _, tSet := range tp.transactionSets {
+			var newTSet []types.Transaction
+			for _, txn := range tSet {
+				if tp.transactionConfirmed(tp.dbTx, txn.ID()) {
+					report.Confirmed = append(report.Confirmed, txn.ID())
+					tp.forgetTransaction(txn.ID())
+					continue
+				}
+				newTSet = append(newTSet, txn)
+			}
+			unconfirmedSets = append(unconfirmedSets, newTSet)
+		}
+
+		// Re-add the remaining transactions one at a time, the same way that
+		// they are re-added after a consensus change.
+		tp.purgeSets()
+		for _, set := range unconfirmedSets {
+			for _, txn := range set {
+				err := tp.acceptTransactionSet([]types.Transaction{txn}, txnFn)
+				if err != nil {
+					report.Invalid = append(report.Invalid, txn.ID())
+					tp.forgetTransaction(txn.ID())
+					tp.events.LogEvict(transactionEvent(txn))
+				}
+			}
+		}
+		if len(report.Confirmed) > 0 || len(report.Invalid) > 0 {
+			tp.log.Printf("reconciled transaction pool: removed %v confirmed and %v invalid transactions\n", len(report.Confirmed), len(report.Invalid))
+		}
+		tp.updateSubscribersTransactions()
+		return nil
+	})
+	return report, err
+}
@@ -469,3 +469,319 @@ func TestDatabaseUpgrade(t *testing.T) {
 		t.Fatal("testers did not have the same block height after one minute")
 	}
 }
+
+// TestReconcile checks that Reconcile removes confirmed and invalid
+// transactions that have ended up in the transaction pool.
+func TestReconcile(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	tpt, err := createTpoolTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tpt.Close()
+
+	// Confirm a transaction that creates an output TransactionGraph can spend.
+	confirmed, err := tpt.wallet.SendSiacoins(types.SiacoinPrecision.Mul64(100), types.UnlockConditions{}.UnlockHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tpt.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := confirmed[len(confirmed)-1].SiacoinOutputID(0)
+	spend := func(fee uint64) []types.Transaction {
+		graphTxns, err := types.TransactionGraph(source, []types.TransactionGraphEdge{{
+			Dest:   1,
+			Fee:    types.SiacoinPrecision.Mul64(fee),
+			Source: 0,
+			Value:  types.SiacoinPrecision.Mul64(100 - fee),
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return graphTxns
+	}
+	err = tpt.tpool.AcceptTransactionSet(spend(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Simulate a desync by putting the confirmed transactions and a double
+	// spend directly into the pool.
+	tpt.tpool.mu.Lock()
+	tpt.tpool.addTransactionSet(confirmed, modules.ConsensusChange{})
+	tpt.tpool.addTransactionSet(spend(20), modules.ConsensusChange{})
+	tpt.tpool.mu.Unlock()
+
+	report, err := tpt.tpool.Reconcile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Confirmed) != len(confirmed) {
+		t.Fatalf("expected %v confirmed transactions, got %v", len(confirmed), len(report.Confirmed))
+	}
+	if len(report.Invalid) != 1 {
+		t.Fatal("expected 1 invalid transaction, got", len(report.Invalid))
+	}
+	if len(tpt.tpool.TransactionList()) != 1 {
+		t.Fatal("expected 1 transaction in the pool, got", len(tpt.tpool.TransactionList()))
+	}
+
+	// Reconciling an up to date pool should not remove anything.
+	report, err = tpt.tpool.Reconcile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Confirmed) != 0 || len(report.Invalid) != 0 {
+		t.Fatal("reconcile removed transactions from an up to date pool")
+	}
+}
+
+// TestConflictsWithBlock checks that ConflictsWithBlock finds the pool
+// transactions that are double spent by a block, and that they are removed
+// from the pool once the block is confirmed.
+func TestConflictsWithBlock(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	tpt, err := createTpoolTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tpt.Close()
+
+	// Confirm an output that TransactionGraph can spend.
+	txns, err := tpt.wallet.SendSiacoins(types.SiacoinPrecision.Mul64(100), types.UnlockConditions{}.UnlockHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tpt.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := txns[len(txns)-1].SiacoinOutputID(0)
+	spend := func(fee uint64) types.Transaction {
+		graphTxns, err := types.TransactionGraph(source, []types.TransactionGraphEdge{{
+			Dest:   1,
+			Fee:    types.SiacoinPrecision.Mul64(fee),
+			Source: 0,
+			Value:  types.SiacoinPrecision.Mul64(100 - fee),
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return graphTxns[0]
+	}
+
+	// Put one spend of the output in the pool, and another in a block.
+	poolTxn := spend(10)
+	err = tpt.tpool.AcceptTransactionSet([]types.Transaction{poolTxn})
+	if err != nil {
+		t.Fatal(err)
+	}
+	blockTxn := spend(20)
+	if conflicts := tpt.tpool.ConflictsWithBlock([]types.Transaction{poolTxn}); len(conflicts) != 0 {
+		t.Fatal("a pool transaction conflicts with itself")
+	}
+	conflicts := tpt.tpool.ConflictsWithBlock([]types.Transaction{blockTxn})
+	if len(conflicts) != 1 || conflicts[0].ID() != poolTxn.ID() {
+		t.Fatal("double spend was not detected:", conflicts)
+	}
+
+	// Confirm the double spend. The pool transaction should be dropped.
+	block, target, err := tpt.miner.BlockForWork()
+	if err != nil {
+		t.Fatal(err)
+	}
+	block.Transactions = []types.Transaction{blockTxn}
+	block.MinerPayouts = []types.SiacoinOutput{{
+		Value:      block.CalculateSubsidy(tpt.cs.Height() + 1),
+		UnlockHash: block.MinerPayouts[0].UnlockHash,
+	}}
+	solvedBlock, solved := tpt.miner.SolveBlock(block, target)
+	if !solved {
+		t.Fatal("failed to solve block")
+	}
+	err = tpt.cs.AcceptBlock(solvedBlock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, exists := tpt.tpool.Transaction(poolTxn.ID()); exists {
+		t.Fatal("double spent transaction is still in the pool")
+	}
+	if len(tpt.tpool.TransactionList()) != 0 {
+		t.Fatal("pool should be empty")
+	}
+}
+
+// mineTransactions mines a block containing only the provided transactions,
+// regardless of the contents of the transaction pool.
+func (tpt *tpoolTester) mineTransactions(txns []types.Transaction) error {
+	block, target, err := tpt.miner.BlockForWork()
+	if err != nil {
+		return err
+	}
+	block.Transactions = txns
+	block.MinerPayouts = []types.SiacoinOutput{{
+		Value:      block.CalculateSubsidy(tpt.cs.Height() + 1),
+		UnlockHash: block.MinerPayouts[0].UnlockHash,
+	}}
+	for {
+		solved, ok := tpt.miner.SolveBlock(block, target)
+		if ok {
+			return tpt.cs.AcceptBlock(solved)
+		}
+	}
+}
+
+// TestTargetedRevalidation checks that a block only causes the transaction
+// sets it affects to be revalidated.
+func TestTargetedRevalidation(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	tpt, err := createTpoolTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tpt.Close()
+
+	value := types.SiacoinPrecision.Mul64(100)
+	outputs := make([]types.SiacoinOutput, 3)
+	for i := range outputs {
+		outputs[i] = types.SiacoinOutput{Value: value, UnlockHash: types.UnlockConditions{}.UnlockHash()}
+	}
+	txns, err := tpt.wallet.SendSiacoinsMulti(outputs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tpt.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parent := txns[len(txns)-1]
+	var spends []types.Transaction
+	for i := range parent.SiacoinOutputs {
+		if parent.SiacoinOutputs[i].UnlockHash != (types.UnlockConditions{}).UnlockHash() {
+			continue
+		}
+		for _, fee := range []uint64{10, 20} {
+			graph, err := types.TransactionGraph(parent.SiacoinOutputID(uint64(i)), []types.TransactionGraphEdge{{
+				Dest:   1,
+				Fee:    types.SiacoinPrecision.Mul64(fee),
+				Source: 0,
+				Value:  value.Sub(types.SiacoinPrecision.Mul64(fee)),
+			}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			spends = append(spends, graph[0])
+		}
+	}
+	confirmed, untouched, doubleSpent, doubleSpend := spends[0], spends[2], spends[4], spends[5]
+	for _, txn := range []types.Transaction{confirmed, untouched, doubleSpent} {
+		err = tpt.tpool.AcceptTransactionSet([]types.Transaction{txn})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	tpt.tpool.mu.RLock()
+	untouchedID, _ := tpt.tpool.findTransactionSet(untouched.ID())
+	untouchedDiff := tpt.tpool.transactionSetDiffs[untouchedID]
+	tpt.tpool.mu.RUnlock()
+
+	// Mine a block that confirms one transaction and double spends another.
+	err = tpt.mineTransactions([]types.Transaction{confirmed, doubleSpend})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, txn := range []types.Transaction{confirmed, doubleSpent} {
+		if _, _, exists := tpt.tpool.Transaction(txn.ID()); exists {
+			t.Fatal("affected transaction is still in the pool")
+		}
+	}
+
+	// The third set was not touched by the block, so it should not have been
+	// revalidated.
+	tpt.tpool.mu.RLock()
+	setID, exists := tpt.tpool.findTransactionSet(untouched.ID())
+	diff := tpt.tpool.transactionSetDiffs[setID]
+	tpt.tpool.mu.RUnlock()
+	if !exists {
+		t.Fatal("unaffected transaction was removed from the pool")
+	}
+	if diff != untouchedDiff {
+		t.Fatal("unaffected transaction set was revalidated")
+	}
+}
+
+// BenchmarkProcessConsensusChange compares revalidating every transaction set
+// in a large pool after each block with revalidating only the sets affected by
+// the block, for blocks that do not contain any transactions.
+func BenchmarkProcessConsensusChange(b *testing.B) {
+	tpt, err := createTpoolTester(b.Name())
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer tpt.Close()
+
+	// Fill the pool with independent transaction sets. The sets are pinned so
+	// that they do not expire while the benchmark mines blocks.
+	value := types.SiacoinPrecision.Mul64(100)
+	outputs := make([]types.SiacoinOutput, 200)
+	for i := range outputs {
+		outputs[i] = types.SiacoinOutput{Value: value, UnlockHash: types.UnlockConditions{}.UnlockHash()}
+	}
+	txns, err := tpt.wallet.SendSiacoinsMulti(outputs)
+	if err != nil {
+		b.Fatal(err)
+	}
+	_, err = tpt.miner.AddBlock()
+	if err != nil {
+		b.Fatal(err)
+	}
+	parent := txns[len(txns)-1]
+	for i := range parent.SiacoinOutputs {
+		if parent.SiacoinOutputs[i].UnlockHash != (types.UnlockConditions{}).UnlockHash() {
+			continue
+		}
+		graph, err := types.TransactionGraph(parent.SiacoinOutputID(uint64(i)), []types.TransactionGraphEdge{{
+			Dest:   1,
+			Fee:    types.SiacoinPrecision,
+			Source: 0,
+			Value:  value.Sub(types.SiacoinPrecision),
+		}})
+		if err != nil {
+			b.Fatal(err)
+		}
+		err = tpt.tpool.AcceptTransactionSet(graph)
+		if err != nil {
+			b.Fatal(err)
+		}
+		err = tpt.tpool.Pin(graph[0].ID())
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	for _, full := range []bool{true, false} {
+		name := "Targeted"
+		if full {
+			name = "Full"
+		}
+		b.Run(name, func(b *testing.B) {
+			tpt.tpool.mu.Lock()
+			tpt.tpool.fullRevalidation = full
+			tpt.tpool.mu.Unlock()
+			for i := 0; i < b.N; i++ {
+				err := tpt.mineTransactions(nil)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package transactionpool
+
+import (
+	"errors"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// A ValidationFailure reports a transaction that was added to the transaction
+// pool by WarmUp, but whose signatures failed verification in the background.
+// The transaction, along with any transactions that depend on it, has been
+// evicted from the pool.
+type ValidationFailure struct {
+	ID  types.TransactionID
+	Err error
+}
+
+// WarmUp adds the provided transactions to the transaction pool without
+// verifying their signatures, which makes reloading a large pool much faster.
+// Each transaction must still be standard and must not conflict with the pool
+// or the consensus set. The signatures are verified afterwards in the
+// background, and every transaction that fails verification is evicted from
+// the pool, along with its dependents, and reported on the returned channel.
+// The channel is closed once every transaction has been verified.
+//
+// Until background verification completes, the pool may contain transactions
+// with invalid signatures, and transactions that conflict with them are
+// rejected. The sets containing unverified transactions are withheld from
+// subscribers and block templates, and transactions added by WarmUp are not
+// relayed to peers.
+func (tp *TransactionPool) WarmUp(txns []types.Transaction) (<-chan ValidationFailure, error) {
+	if err := tp.tg.Add(); err != nil {
+		return nil, err
+	}
+	defer tp.tg.Done()
+	cs, ok := tp.consensusSet.(interface {
+		LockedTryTrustedTransactionSet(fn func(func(txns []types.Transaction) (modules.ConsensusChange, error)) error) error
+	})
+	if !ok {
+		return nil, errors.New("consensus set does not support LockedTryTrustedTransactionSet method")
+	}
+
+	accepted, err := tp.warmUp(txns, cs.LockedTryTrustedTransactionSet)
+	if err != nil {
+		return nil, err
+	}
+	tp.log.Printf("warmed up the transaction pool with %v of %v transactions, verifying signatures in the background\n", len(accepted), len(txns))
+
+	failures := make(chan ValidationFailure, len(accepted))
+	go tp.threadedVerifySignatures(accepted, cs.LockedTryTrustedTransactionSet, failures)
+	return failures, nil
+}
+
+// warmUp adds the provided transactions to the transaction pool using a
+// validation function that does not verify signatures, and marks them as
+// unverified. The ids of the accepted transactions are returned.
+func (tp *TransactionPool) warmUp(txns []types.Transaction, lockedTry func(func(func(txns []types.Transaction) (modules.ConsensusChange, error)) error) error) ([]types.TransactionID, error) {
+	var accepted []types.TransactionID
+	err := lockedTry(func(txnFn func(txns []types.Transaction) (modules.ConsensusChange, error)) error {
+		tp.mu.Lock()
+		defer tp.mu.Unlock()
+		for _, txn := range txns {
+			err := tp.acceptTransactionSet([]types.Transaction{txn}, txnFn)
+			if err != nil {
+				continue
+			}
+			accepted = append(accepted, txn.ID())
+			tp.unverified[txn.ID()] = struct{}{}
+			tp.setOrigin([]types.Transaction{txn}, OriginDisk)
+			tp.events.LogAccept(transactionEvent(txn))
+		}
+		tp.updateSubscribersTransactions()
+		return nil
+	})
+	return accepted, err
+}
+
+// setUnverified returns true if the set contains a transaction whose
+// signatures have not been verified yet.
+func (tp *TransactionPool) setUnverified(tSet []types.Transaction) bool {
+	if len(tp.unverified) == 0 {
+		return false
+	}
+	for _, txn := range tSet {
+		if _, exists := tp.unverified[txn.ID()]; exists {
+			return true
+		}
+	}
+	return false
+}
+
+// threadedVerifySignatures verifies the signatures of the transactions that
+// were added to the pool without verifying them, evicting the transactions
+// that fail. Failures are sent on the provided channel, if it is not nil,
+// which is closed once every transaction has been verified or the transaction
+// pool is shutting down. The sets of the transactions that pass are then
+// released to subscribers and block templates.
+func (tp *TransactionPool) threadedVerifySignatures(ids []types.TransactionID, lockedTry func(func(func(txns []types.Transaction) (modules.ConsensusChange, error)) error) error, failures chan<- ValidationFailure) {
+	if failures != nil {
+		defer close(failures)
+	}
+	if err := tp.tg.Add(); err != nil {
+		return
+	}
+	defer tp.tg.Done()
+
+	var verified []types.TransactionID
+	for _, id := range ids {
+		select {
+		case <-tp.tg.StopChan():
+			return
+		default:
+		}
+
+		// Transactions that have left the pool in the meantime, for example
+		// because they were confirmed, no longer need to be verified.
+		tp.mu.RLock()
+		txn, _, exists := tp.findTransaction(id)
+		height := tp.blockHeight
+		tp.mu.RUnlock()
+		if !exists {
+			continue
+		}
+		err := tp.signatures.verify(txn, height)
+		if err == nil {
+			verified = append(verified, id)
+			continue
+		}
+
+		tp.log.Printf("WARN: transaction %v failed background signature verification: %v\n", id, err)
+		lockedTry(func(txnFn func(txns []types.Transaction) (modules.ConsensusChange, error)) error {
+			tp.mu.Lock()
+			defer tp.mu.Unlock()
+			tp.evictTransaction(id, txnFn)
+			tp.updateSubscribersTransactions()
+			return nil
+		})
+		if failures != nil {
+			failures <- ValidationFailure{ID: id, Err: err}
+		}
+	}
+
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	for _, id := range verified {
+		delete(tp.unverified, id)
+	}
+	tp.updateSubscribersTransactions()
+}
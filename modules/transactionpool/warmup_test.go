@@ -0,0 +1,250 @@
+package transactionpool
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestWarmUp checks that WarmUp adds transactions to the pool before their
+// signatures are verified, and that transactions with invalid signatures are
+// evicted and reported once they are verified.
+func TestWarmUp(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	tpt, err := createTpoolTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tpt.Close()
+
+	// Give the wallet two separate outputs to fund the transactions with.
+	uc, err := tpt.wallet.NextAddress()
+	if err != nil {
+		t.Fatal(err)
+	}
+	output := types.SiacoinOutput{Value: types.SiacoinPrecision.Mul64(10), UnlockHash: uc.UnlockHash()}
+	_, err = tpt.wallet.SendSiacoinsMulti([]types.SiacoinOutput{output, output})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tpt.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Create two signed transaction sets without submitting them.
+	signedSet := func() []types.Transaction {
+		builder, err := tpt.wallet.StartTransaction()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = builder.FundSiacoins(types.SiacoinPrecision)
+		if err != nil {
+			t.Fatal(err)
+		}
+		builder.AddMinerFee(types.SiacoinPrecision)
+		txns, err := builder.Sign(true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return txns
+	}
+	valid := signedSet()
+	invalid := signedSet()
+	bad := &invalid[len(invalid)-1]
+	bad.TransactionSignatures[0].Signature[0] ^= 1
+	badID := bad.ID()
+
+	txns := append(append([]types.Transaction{}, valid...), invalid...)
+	failures, err := tpt.tpool.WarmUp(txns)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var reported []ValidationFailure
+	for failure := range failures {
+		reported = append(reported, failure)
+	}
+	if len(reported) != 1 || reported[0].ID != badID || reported[0].Err == nil {
+		t.Fatal("expected a single failure for the corrupted transaction, got", reported)
+	}
+
+	// Only the corrupted transaction should have been evicted.
+	if _, _, exists := tpt.tpool.Transaction(badID); exists {
+		t.Fatal("transaction with an invalid signature is still in the pool")
+	}
+	for _, txn := range txns {
+		if txn.ID() == badID {
+			continue
+		}
+		if _, _, exists := tpt.tpool.Transaction(txn.ID()); !exists {
+			t.Fatal("valid transaction was evicted from the pool")
+		}
+	}
+}
+
+// TestWarmUpWindow checks that, while the signatures of the warmed up
+// transactions are being verified, the warmed up transactions are withheld
+// from block templates, and transactions submitted through
+// AcceptTransactionSet still have their signatures verified.
+func TestWarmUpWindow(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	tpt, err := createTpoolTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tpt.Close()
+	cs, ok := tpt.cs.(interface {
+		LockedTryTrustedTransactionSet(fn func(func(txns []types.Transaction) (modules.ConsensusChange, error)) error) error
+	})
+	if !ok {
+		t.Fatal("consensus set does not support LockedTryTrustedTransactionSet method")
+	}
+
+	// Give the wallet separate outputs to fund the transactions with.
+	uc, err := tpt.wallet.NextAddress()
+	if err != nil {
+		t.Fatal(err)
+	}
+	output := types.SiacoinOutput{Value: types.SiacoinPrecision.Mul64(10), UnlockHash: uc.UnlockHash()}
+	_, err = tpt.wallet.SendSiacoinsMulti([]types.SiacoinOutput{output, output})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tpt.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signedSet := func() []types.Transaction {
+		builder, err := tpt.wallet.StartTransaction()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = builder.FundSiacoins(types.SiacoinPrecision)
+		if err != nil {
+			t.Fatal(err)
+		}
+		builder.AddMinerFee(types.SiacoinPrecision)
+		txns, err := builder.Sign(true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return txns
+	}
+	warm := signedSet()
+	submitted := signedSet()
+	bad := &submitted[len(submitted)-1]
+	bad.TransactionSignatures[0].Signature[0] ^= 1
+
+	// Warm up the pool without starting the background verification, which
+	// keeps the verification window open.
+	accepted, err := tpt.tpool.warmUp(warm, cs.LockedTryTrustedTransactionSet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(accepted) != len(warm) {
+		t.Fatal("expected the warmed up transactions to be accepted, got", len(accepted))
+	}
+	if len(tpt.tpool.BlockTransactions()) != 0 {
+		t.Fatal("unverified transactions were included in a block template")
+	}
+	err = tpt.tpool.AcceptTransactionSet(submitted)
+	if err == nil || !strings.Contains(err.Error(), crypto.ErrInvalidSignature.Error()) {
+		t.Fatal("expected an invalid signature error during warm-up, got", err)
+	}
+
+	// Once verified, the warmed up transactions are released.
+	failures := make(chan ValidationFailure, len(accepted))
+	tpt.tpool.threadedVerifySignatures(accepted, cs.LockedTryTrustedTransactionSet, failures)
+	if len(failures) != 0 {
+		t.Fatal("valid transaction failed verification:", <-failures)
+	}
+	if len(tpt.tpool.BlockTransactions()) != len(warm) {
+		t.Fatal("verified transactions were not released to block templates")
+	}
+}
+
+// TestWarmUpConsensusChange checks that a consensus change fully validates
+// the transactions whose signatures have not been verified yet.
+func TestWarmUpConsensusChange(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	tpt, err := createTpoolTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tpt.Close()
+	cs, ok := tpt.cs.(interface {
+		LockedTryTrustedTransactionSet(fn func(func(txns []types.Transaction) (modules.ConsensusChange, error)) error) error
+	})
+	if !ok {
+		t.Fatal("consensus set does not support LockedTryTrustedTransactionSet method")
+	}
+
+	// Give the wallet separate outputs to fund the transactions with.
+	uc, err := tpt.wallet.NextAddress()
+	if err != nil {
+		t.Fatal(err)
+	}
+	output := types.SiacoinOutput{Value: types.SiacoinPrecision.Mul64(10), UnlockHash: uc.UnlockHash()}
+	_, err = tpt.wallet.SendSiacoinsMulti([]types.SiacoinOutput{output, output})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tpt.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signedSet := func() []types.Transaction {
+		builder, err := tpt.wallet.StartTransaction()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = builder.FundSiacoins(types.SiacoinPrecision)
+		if err != nil {
+			t.Fatal(err)
+		}
+		builder.AddMinerFee(types.SiacoinPrecision)
+		txns, err := builder.Sign(true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return txns
+	}
+	valid := signedSet()
+	invalid := signedSet()
+	bad := &invalid[len(invalid)-1]
+	bad.TransactionSignatures[0].Signature[0] ^= 1
+
+	// Warm up the pool without starting the background verification, then
+	// mine a block, which does not touch the warmed up transactions.
+	txns := append(append([]types.Transaction{}, valid...), invalid...)
+	_, err = tpt.tpool.warmUp(txns, cs.LockedTryTrustedTransactionSet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tpt.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The transaction with the invalid signature should have been evicted,
+	// and the valid transactions released to block templates.
+	if _, _, exists := tpt.tpool.Transaction(bad.ID()); exists {
+		t.Fatal("transaction with an invalid signature is still in the pool")
+	}
+	if len(tpt.tpool.unverified) != 0 {
+		t.Fatal("transactions are still marked as unverified:", len(tpt.tpool.unverified))
+	}
+	if len(tpt.tpool.BlockTransactions()) != len(txns)-1 {
+		t.Fatal("verified transactions were not released to block templates:", len(tpt.tpool.BlockTransactions()))
+	}
+}
@@ -292,6 +292,22 @@ func (t Transaction) validUnlockConditions(currentHeight BlockHeight) (err error
 // transaction. StandaloneValid will not check that all outputs being spent are
 // legal outputs, as it has no confirmed or unconfirmed set to look at.
 func (t Transaction) StandaloneValid(currentHeight BlockHeight) (err error) {
+	err = t.StandaloneValidWithoutSignatures(currentHeight)
+	if err != nil {
+		return
+	}
+	err = t.validSignatures(currentHeight)
+	if err != nil {
+		return
+	}
+	return
+}
+
+// StandaloneValidWithoutSignatures performs all of the checks of
+// StandaloneValid except for the signature checks. It should only be used on
+// transactions whose signatures are already known to be valid, for example
+// because the same transaction was previously verified by StandaloneValid.
+func (t Transaction) StandaloneValidWithoutSignatures(currentHeight BlockHeight) (err error) {
 	err = t.fitsInABlock(currentHeight)
 	if err != nil {
 		return
@@ -320,9 +336,5 @@ func (t Transaction) StandaloneValid(currentHeight BlockHeight) (err error) {
 	if err != nil {
 		return
 	}
-	err = t.validSignatures(currentHeight)
-	if err != nil {
-		return
-	}
 	return
 }